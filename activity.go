@@ -0,0 +1,73 @@
+/*
+ * Copyright 2019 Martin Helmich <martin@helmich.me>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/config"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// activityMetrics tracks whether a namespace has recently processed any log
+// lines. Instead of updating the gauge in the background, its value is
+// computed from the time of the last line whenever it is collected.
+type activityMetrics struct {
+	// lastLine needs to go first in the struct to guarantee alignment for
+	// atomic operations. It contains the time of the last line in
+	// nanoseconds since the epoch.
+	lastLine int64
+
+	window time.Duration
+	now    func() time.Time
+	active prometheus.GaugeFunc
+}
+
+func newActivityMetrics(cfg *config.NamespaceConfig) *activityMetrics {
+	a := &activityMetrics{
+		window: cfg.ActiveWindowDuration,
+		now:    time.Now,
+	}
+
+	a.active = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace:   cfg.NamespacePrefix,
+		ConstLabels: cfg.NamespaceLabels,
+		Name:        cfg.MetricName("namespace_active"),
+		Help:        "Whether the namespace has processed any log lines within the configured active window",
+	}, a.value)
+
+	return a
+}
+
+// observe records that a log line was processed
+func (a *activityMetrics) observe() {
+	atomic.StoreInt64(&a.lastLine, a.now().UnixNano())
+}
+
+func (a *activityMetrics) value() float64 {
+	lastLine := atomic.LoadInt64(&a.lastLine)
+	if lastLine == 0 {
+		return 0
+	}
+
+	if a.now().Sub(time.Unix(0, lastLine)) > a.window {
+		return 0
+	}
+
+	return 1
+}
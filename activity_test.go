@@ -0,0 +1,26 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestActivityMetricsReflectRecentLines(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	a := newActivityMetrics(&config.NamespaceConfig{Name: "test", ActiveWindowDuration: time.Minute})
+	a.now = func() time.Time { return now }
+
+	assert.Equal(t, 0.0, a.value())
+
+	a.observe()
+	assert.Equal(t, 1.0, a.value())
+
+	now = now.Add(2 * time.Minute)
+	assert.Equal(t, 0.0, a.value())
+}
@@ -0,0 +1,48 @@
+/*
+ * Copyright 2019 Martin Helmich <martin@helmich.me>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"runtime"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// version and commit describe the build of the exporter; they are set at
+// build time using "-ldflags '-X main.version=... -X main.commit=...'" (which
+// GoReleaser does by default)
+var (
+	version = "dev"
+	commit  = "unknown"
+)
+
+// newBuildInfo creates a gauge that describes the build of the exporter in
+// its labels
+func newBuildInfo() prometheus.Gauge {
+	g := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "nginxlog_exporter_build_info",
+		Help: "A metric with a constant '1' value labeled by the version, revision and Go version of the exporter",
+		ConstLabels: prometheus.Labels{
+			"version":   version,
+			"revision":  commit,
+			"goversion": runtime.Version(),
+		},
+	})
+	g.Set(1)
+
+	return g
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildInfo(t *testing.T) {
+	t.Parallel()
+
+	g := newBuildInfo()
+	assert.Equal(t, 1.0, testutil.ToFloat64(g))
+
+	var metric dto.Metric
+	require.Nil(t, g.Write(&metric))
+
+	labels := make(map[string]string)
+	for _, l := range metric.GetLabel() {
+		labels[l.GetName()] = l.GetValue()
+	}
+
+	assert.Equal(t, map[string]string{"version": "dev", "revision": "unknown", "goversion": runtime.Version()}, labels)
+}
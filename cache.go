@@ -0,0 +1,87 @@
+/*
+ * Copyright 2019 Martin Helmich <martin@helmich.me>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"sync/atomic"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/config"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// cacheMetrics counts requests by whether they were served from NGINX's
+// proxy cache or by an upstream server
+type cacheMetrics struct {
+	// fromCache and fromUpstream need to go first in the struct to guarantee
+	// alignment for atomic operations
+	fromCache    uint64
+	fromUpstream uint64
+
+	servedTotal *prometheus.CounterVec
+	hitRatio    prometheus.GaugeFunc
+}
+
+func newCacheMetrics(cfg *config.NamespaceConfig) *cacheMetrics {
+	c := &cacheMetrics{}
+
+	c.servedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace:   cfg.NamespacePrefix,
+		ConstLabels: cfg.NamespaceLabels,
+		Name:        cfg.MetricName("http_cache_served_total"),
+		Help:        "Amount of processed HTTP requests, by whether they were served from the cache or by an upstream",
+	}, []string{"served_by"})
+
+	c.hitRatio = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace:   cfg.NamespacePrefix,
+		ConstLabels: cfg.NamespaceLabels,
+		Name:        cfg.MetricName("http_cache_hit_ratio"),
+		Help:        "Ratio of requests that were served from the cache, since the exporter was started",
+	}, c.ratio)
+
+	return c
+}
+
+func (c *cacheMetrics) collectors() []prometheus.Collector {
+	return []prometheus.Collector{c.servedTotal, c.hitRatio}
+}
+
+// observe counts a single request. A request counts as served by an upstream
+// whenever an upstream was contacted; otherwise it counts as served from the
+// cache if the cache status says so. Requests that were neither (for
+// example, static files) are not counted. The request is counted n times
+// (see lineProcessor.observations).
+func (c *cacheMetrics) observe(cacheStatus string, upstreamContacted bool, n int) {
+	switch {
+	case upstreamContacted:
+		atomic.AddUint64(&c.fromUpstream, uint64(n))
+		c.servedTotal.WithLabelValues("upstream").Add(float64(n))
+	case cacheStatus == "HIT" || cacheStatus == "STALE" || cacheStatus == "UPDATING":
+		atomic.AddUint64(&c.fromCache, uint64(n))
+		c.servedTotal.WithLabelValues("cache").Add(float64(n))
+	}
+}
+
+func (c *cacheMetrics) ratio() float64 {
+	fromCache := atomic.LoadUint64(&c.fromCache)
+	total := fromCache + atomic.LoadUint64(&c.fromUpstream)
+
+	if total == 0 {
+		return 0
+	}
+
+	return float64(fromCache) / float64(total)
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheMetricsDistinguishCacheAndUpstream(t *testing.T) {
+	t.Parallel()
+
+	c := newCacheMetrics(&config.NamespaceConfig{})
+
+	c.observe("HIT", false, 1)
+	c.observe("HIT", false, 1)
+	c.observe("STALE", false, 1)
+	c.observe("MISS", true, 1)
+	c.observe("-", false, 1)
+
+	assert.Equal(t, 0.75, c.ratio())
+}
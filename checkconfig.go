@@ -0,0 +1,145 @@
+/*
+ * Copyright 2019 Martin Helmich <martin@helmich.me>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/config"
+)
+
+// checkConfig tests the configuration for all mistakes that would otherwise
+// only surface once the exporter is running (like invalid regular
+// expressions or label names, or missing log files), without starting any
+// listeners. It returns a description of each problem that was found.
+func checkConfig(cfg *config.Config, enableExperimental bool) []string {
+	var problems []string
+
+	if err := cfg.StabilityWarnings(); err != nil && !enableExperimental {
+		problems = append(problems, fmt.Sprintf("experimental feature used without enable_experimental: %s", err.Error()))
+	}
+
+	if err := cfg.Validate(); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	for i := range cfg.Namespaces {
+		nsCfg := cfg.Namespaces[i]
+
+		for _, p := range checkNamespace(&nsCfg) {
+			problems = append(problems, fmt.Sprintf("namespace %s: %s", nsCfg.Name, p))
+		}
+	}
+
+	return problems
+}
+
+// checkNamespace compiles a namespace and creates its metrics (which fails
+// for invalid label names), and checks that its log sources can be read
+func checkNamespace(nsCfg *config.NamespaceConfig) (problems []string) {
+	defer func() {
+		if r := recover(); r != nil {
+			problems = append(problems, fmt.Sprint(r))
+		}
+	}()
+
+	if err := nsCfg.Compile(); err != nil {
+		return []string{err.Error()}
+	}
+
+	if _, err := NewNSMetrics(nsCfg); err != nil {
+		problems = append(problems, fmt.Sprintf("could not create metrics: %s", err.Error()))
+	}
+
+	if nsCfg.GeoIP != nil {
+		if _, err := newGeoIPLookup(nsCfg.GeoIP); err != nil {
+			problems = append(problems, fmt.Sprintf("geoip: %s", err.Error()))
+		}
+	}
+
+	files, watchedDirectories := nsCfg.SourceData.FilePatterns()
+	for _, g := range nsCfg.SourceData.FileGroups {
+		files = append(files, g.Files...)
+	}
+
+	for _, f := range files {
+		if err := checkFilePattern(f); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	for _, d := range append(watchedDirectories, nsCfg.SourceData.Directories...) {
+		if info, err := os.Stat(d.Path); err != nil {
+			problems = append(problems, err.Error())
+		} else if !info.IsDir() {
+			problems = append(problems, fmt.Sprintf("%s is not a directory", d.Path))
+		}
+
+		if _, err := filepath.Match(d.Pattern, ""); err != nil {
+			problems = append(problems, fmt.Sprintf("invalid pattern '%s': %s", d.Pattern, err.Error()))
+		}
+	}
+
+	return problems
+}
+
+// checkFilePattern checks that a log file (or all files matching a pattern)
+// can be opened for reading
+func checkFilePattern(pattern string) error {
+	if pattern == config.StdinFilename {
+		return nil
+	}
+
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return fmt.Errorf("invalid file pattern '%s': %s", pattern, err.Error())
+	}
+
+	if len(matches) == 0 {
+		matches = []string{pattern}
+	}
+
+	for _, m := range matches {
+		f, err := os.Open(m)
+		if err != nil {
+			return err
+		}
+
+		f.Close()
+	}
+
+	return nil
+}
+
+// runConfigCheck checks the configuration, prints a report and returns the
+// exit code of the exporter
+func runConfigCheck(cfg *config.Config, enableExperimental bool) int {
+	problems := checkConfig(cfg, enableExperimental)
+	if len(problems) == 0 {
+		fmt.Println("configuration is valid")
+		return 0
+	}
+
+	fmt.Fprintf(os.Stderr, "configuration is invalid; found %d problem(s):\n\n", len(problems))
+	for _, p := range problems {
+		fmt.Fprintf(os.Stderr, "  - %s\n", p)
+	}
+
+	return 1
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckConfigReportsAllProblems(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "checkconfig")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	logFile := filepath.Join(dir, "access.log")
+	require.NoError(t, ioutil.WriteFile(logFile, nil, 0644))
+
+	cfg := config.Config{
+		Namespaces: []config.NamespaceConfig{
+			{
+				Name:       "valid",
+				Format:     "$request $status",
+				SourceData: config.SourceData{Files: []string{logFile, filepath.Join(dir, "*.log")}},
+			},
+			{
+				Name:       "missing",
+				Format:     "$request $status",
+				SourceData: config.SourceData{Files: []string{filepath.Join(dir, "missing.log")}},
+			},
+			{
+				Name:           "regex",
+				Format:         "$request $status",
+				RequestPattern: "(",
+			},
+		},
+	}
+
+	problems := checkConfig(&cfg, true)
+	require.Len(t, problems, 2)
+	assert.Contains(t, problems[0], "namespace missing: ")
+	assert.Contains(t, problems[0], "missing.log")
+	assert.Contains(t, problems[1], "namespace regex: ")
+
+	cfg.Namespaces = cfg.Namespaces[:1]
+	assert.Empty(t, checkConfig(&cfg, true))
+}
@@ -0,0 +1,116 @@
+/*
+ * Copyright 2019 Martin Helmich <martin@helmich.me>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/config"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// clockSkewSmoothing is the weight of each new observation in the moving
+// average of the clock skew. Since log timestamps only have a resolution of
+// one second, single observations are rather noisy.
+const clockSkewSmoothing = 0.05
+
+// clockSkewMetrics tracks the difference between the system time and the
+// timestamps of processed log lines, as exponentially weighted moving
+// average. Unless the exporter lags behind, this is the skew between the
+// clocks of the exporter host and the NGINX host (or the time zone
+// configuration of either of them).
+type clockSkewMetrics struct {
+	threshold float64
+	now       func() time.Time
+
+	mutex    sync.Mutex
+	skew     float64
+	observed bool
+
+	skewGauge prometheus.GaugeFunc
+	exceeded  prometheus.GaugeFunc
+}
+
+func newClockSkewMetrics(cfg *config.NamespaceConfig) *clockSkewMetrics {
+	c := &clockSkewMetrics{
+		threshold: cfg.ClockSkew.ThresholdDuration.Seconds(),
+		now:       time.Now,
+	}
+
+	c.skewGauge = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace:   cfg.NamespacePrefix,
+		ConstLabels: cfg.NamespaceLabels,
+		Name:        cfg.MetricName("clock_skew_seconds"),
+		Help:        "Smoothed difference between the system time and the timestamps of processed log lines",
+	}, c.value)
+
+	if c.threshold > 0 {
+		c.exceeded = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace:   cfg.NamespacePrefix,
+			ConstLabels: cfg.NamespaceLabels,
+			Name:        cfg.MetricName("clock_skew_exceeded"),
+			Help:        "Whether the smoothed clock skew exceeds the configured threshold",
+		}, c.exceededValue)
+	}
+
+	return c
+}
+
+func (c *clockSkewMetrics) collectors() []prometheus.Collector {
+	if c.exceeded == nil {
+		return []prometheus.Collector{c.skewGauge}
+	}
+
+	return []prometheus.Collector{c.skewGauge, c.exceeded}
+}
+
+// observe records the timestamp of a processed log line
+func (c *clockSkewMetrics) observe(ts time.Time) {
+	skew := c.now().Sub(ts).Seconds()
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if !c.observed {
+		c.skew = skew
+		c.observed = true
+		return
+	}
+
+	c.skew += clockSkewSmoothing * (skew - c.skew)
+}
+
+func (c *clockSkewMetrics) value() float64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if !c.observed {
+		return math.NaN()
+	}
+
+	return c.skew
+}
+
+func (c *clockSkewMetrics) exceededValue() float64 {
+	if math.Abs(c.value()) > c.threshold {
+		return 1
+	}
+
+	return 0
+}
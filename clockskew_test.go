@@ -0,0 +1,36 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClockSkewIsSmoothed(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	c := newClockSkewMetrics(&config.NamespaceConfig{
+		Name:      "test",
+		ClockSkew: &config.ClockSkewConfig{ThresholdDuration: 30 * time.Second},
+	})
+	c.now = func() time.Time { return now }
+
+	assert.True(t, math.IsNaN(c.value()))
+	assert.Equal(t, 0.0, c.exceededValue())
+
+	c.observe(now.Add(-60 * time.Second))
+	assert.Equal(t, 60.0, c.value())
+	assert.Equal(t, 1.0, c.exceededValue())
+
+	for i := 0; i < 100; i++ {
+		c.observe(now)
+	}
+
+	assert.InDelta(t, 0.0, c.value(), 1)
+	assert.Equal(t, 0.0, c.exceededValue())
+}
@@ -0,0 +1,87 @@
+/*
+ * Copyright 2019 Martin Helmich <martin@helmich.me>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// compatCollector exposes the values of a counter or gauge (vector) under a
+// different name, as untyped metric. It allows dashboards that were built for
+// other exporters to keep working. Since the label names of the source are
+// only known at collection time, this is an unchecked collector that does not
+// describe its metrics up front.
+type compatCollector struct {
+	name   string
+	help   string
+	source prometheus.Collector
+}
+
+func newCompatCollector(name string, sourceName string, source prometheus.Collector) *compatCollector {
+	return &compatCollector{
+		name:   name,
+		help:   "Legacy alias of " + sourceName,
+		source: source,
+	}
+}
+
+func (c *compatCollector) Describe(chan<- *prometheus.Desc) {}
+
+func (c *compatCollector) Collect(ch chan<- prometheus.Metric) {
+	metrics := make(chan prometheus.Metric)
+
+	go func() {
+		c.source.Collect(metrics)
+		close(metrics)
+	}()
+
+	for m := range metrics {
+		var pb dto.Metric
+		if err := m.Write(&pb); err != nil {
+			continue
+		}
+
+		var value float64
+		switch {
+		case pb.Counter != nil:
+			value = pb.Counter.GetValue()
+		case pb.Gauge != nil:
+			value = pb.Gauge.GetValue()
+		case pb.Untyped != nil:
+			value = pb.Untyped.GetValue()
+		default:
+			continue
+		}
+
+		names := make([]string, len(pb.Label))
+		values := make([]string, len(pb.Label))
+		for i, l := range pb.Label {
+			names[i] = l.GetName()
+			values[i] = l.GetValue()
+		}
+
+		desc := prometheus.NewDesc(c.name, c.help, names, nil)
+		metric, err := prometheus.NewConstMetric(desc, prometheus.UntypedValue, value, values...)
+		if err != nil {
+			ch <- prometheus.NewInvalidMetric(desc, err)
+			continue
+		}
+
+		ch <- metric
+	}
+}
@@ -0,0 +1,24 @@
+package config
+
+// FormatPresets contains log formats that can be configured by name instead
+// of spelling out the format string. Apache's "%"-directives are mapped to the
+// equivalent NGINX variables (like "%b" to "$body_bytes_sent"), so that the
+// metrics are filled from the same fields as for NGINX logs.
+var FormatPresets = map[string]string{
+	// NGINX' predefined "combined" format
+	"combined": `$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent "$http_referer" "$http_user_agent"`,
+
+	// Apache's "common" format: %h %l %u %t "%r" %>s %b
+	"apache_common": `$remote_addr $remote_logname $remote_user [$time_local] "$request" $status $body_bytes_sent`,
+
+	// Apache's "combined" format: %h %l %u %t "%r" %>s %b "%{Referer}i" "%{User-agent}i"
+	"apache_combined": `$remote_addr $remote_logname $remote_user [$time_local] "$request" $status $body_bytes_sent "$http_referer" "$http_user_agent"`,
+}
+
+// resolveFormatPreset replaces the format with the respective format string
+// if it is the name of a preset
+func (c *NamespaceConfig) resolveFormatPreset() {
+	if format, ok := FormatPresets[c.Format]; ok {
+		c.Format = format
+	}
+}
@@ -0,0 +1,78 @@
+package config
+
+import (
+	"strings"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/logging"
+)
+
+// SanitizeLabelName converts an arbitrary string into a valid Prometheus label
+// name (matching [a-zA-Z_][a-zA-Z0-9_]*). Each invalid character is replaced
+// with an underscore, and names starting with a digit are prefixed with one.
+func SanitizeLabelName(name string) string {
+	var b strings.Builder
+
+	for i, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_':
+			b.WriteRune(r)
+		case r >= '0' && r <= '9':
+			if i == 0 {
+				b.WriteRune('_')
+			}
+			b.WriteRune(r)
+		default:
+			b.WriteRune('_')
+		}
+	}
+
+	if b.Len() == 0 {
+		return "_"
+	}
+
+	return b.String()
+}
+
+func sanitizeLabelNameWithWarning(name string) string {
+	sanitized := SanitizeLabelName(name)
+	if sanitized != name {
+		logging.Warn("invalid label name; using a sanitized one instead", "label", name, "sanitized", sanitized)
+	}
+
+	return sanitized
+}
+
+// sanitizeLabelNames replaces all configured label names of a namespace
+// with valid Prometheus label names
+func (c *NamespaceConfig) sanitizeLabelNames() {
+	if c.NamespaceLabelName != "" {
+		c.NamespaceLabelName = sanitizeLabelNameWithWarning(c.NamespaceLabelName)
+	}
+
+	if len(c.Labels) > 0 {
+		labels := make(map[string]string, len(c.Labels))
+		for k, v := range c.Labels {
+			labels[sanitizeLabelNameWithWarning(k)] = v
+		}
+		c.Labels = labels
+	}
+
+	for i, g := range c.SourceData.FileGroups {
+		labels := make(map[string]string, len(g.Labels))
+		for k, v := range g.Labels {
+			labels[sanitizeLabelNameWithWarning(k)] = v
+		}
+		c.SourceData.FileGroups[i].Labels = labels
+	}
+
+	for i := range c.RelabelConfigs {
+		// the target label of filters is not used as label name
+		if !c.RelabelConfigs[i].FiltersLines() {
+			c.RelabelConfigs[i].TargetLabel = sanitizeLabelNameWithWarning(c.RelabelConfigs[i].TargetLabel)
+		}
+	}
+
+	if c.EndpointLabel != "" {
+		c.EndpointLabel = SanitizeLabelName(c.EndpointLabel)
+	}
+}
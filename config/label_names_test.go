@@ -0,0 +1,33 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSanitizeLabelName(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "request_uri", SanitizeLabelName("request_uri"))
+	assert.Equal(t, "x_forwarded_for", SanitizeLabelName("x-forwarded-for"))
+	assert.Equal(t, "_4xx", SanitizeLabelName("4xx"))
+	assert.Equal(t, "geo_country", SanitizeLabelName("geo.country"))
+	assert.Equal(t, "_", SanitizeLabelName(""))
+}
+
+func TestCompileSanitizesLabelNames(t *testing.T) {
+	t.Parallel()
+
+	c := NamespaceConfig{
+		Name:               "test",
+		NamespaceLabelName: "v-host",
+		Labels:             map[string]string{"app-name": "foo"},
+		RelabelConfigs:     []RelabelConfig{{TargetLabel: "user-agent", SourceValue: "http_user_agent"}},
+	}
+
+	assert.Nil(t, c.Compile())
+	assert.Equal(t, map[string]string{"v_host": "test"}, c.NamespaceLabels)
+	assert.Equal(t, []string{"app_name"}, c.OrderedLabelNames)
+	assert.Equal(t, "user_agent", c.RelabelConfigs[0].TargetLabel)
+}
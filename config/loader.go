@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"reflect"
 	"strings"
 )
 
@@ -19,9 +20,17 @@ const (
 
 // LoadConfigFromFile fills a configuration object (passed as parameter) with
 // values read from a configuration file (pass as parameter by filename). The
-// configuration file needs to be in HCL format.
+// configuration file needs to be in HCL or YAML format. Instead of a file
+// name, a HTTP(S) or S3 URL may be given to fetch the file from.
 func LoadConfigFromFile(config *Config, filename string) error {
-	var typ FileFormat
+	if IsConfigURL(filename) {
+		return loadConfigFromURL(config, filename)
+	}
+
+	typ, err := fileFormatFromName(filename)
+	if err != nil {
+		return err
+	}
 
 	reader, err := os.Open(filename)
 	if err != nil {
@@ -30,15 +39,19 @@ func LoadConfigFromFile(config *Config, filename string) error {
 
 	defer reader.Close()
 
+	return LoadConfigFromStream(config, reader, typ)
+}
+
+// fileFormatFromName determines the format of a configuration file from the
+// extension of its name
+func fileFormatFromName(filename string) (FileFormat, error) {
 	if strings.HasSuffix(filename, ".hcl") {
-		typ = TypeHCL
+		return TypeHCL, nil
 	} else if strings.HasSuffix(filename, ".yaml") || strings.HasSuffix(filename, ".yml") {
-		typ = TypeYAML
-	} else {
-		return fmt.Errorf("config file '%s' has unsupported file type", filename)
+		return TypeYAML, nil
 	}
 
-	return LoadConfigFromStream(config, reader, typ)
+	return 0, fmt.Errorf("config file '%s' has unsupported file type", filename)
 }
 
 // LoadConfigFromStream fills a configuration object (passed as parameter) with
@@ -57,6 +70,10 @@ func LoadConfigFromStream(config *Config, stream io.Reader, typ FileFormat) erro
 		return fmt.Errorf("unsupported config type %d", typ)
 	}
 
+	if err := expandEnvironment(reflect.ValueOf(config)); err != nil {
+		return err
+	}
+
 	for i := range config.Namespaces {
 		config.Namespaces[i].ResolveDeprecations()
 	}
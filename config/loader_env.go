@@ -0,0 +1,160 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// unexpandedFields lists the fields that contain regular expressions and
+// their replacements, in which "${name}" refers to a (named) capture group
+// instead of an environment variable
+var unexpandedFields = map[reflect.Type]map[string]bool{
+	reflect.TypeOf(RelabelValueMatch{}):   {"RegexpString": true, "Replacement": true},
+	reflect.TypeOf(MetricRelabelConfig{}): {"Regex": true, "Replacement": true},
+}
+
+// expandEnvironment replaces references to environment variables in all
+// string values of a configuration (including the elements of lists and the
+// values of maps). Variables are referenced as "${VAR}", or as
+// "${VAR:-default}" to use a default value if VAR is not set; a reference to
+// a variable that is not set (and has no default) is an error. "$$" denotes a
+// literal "$". Unbraced references (like "$VAR") are not replaced, since they
+// cannot be told apart from the NGINX variables in log formats. The regular
+// expressions and replacements of relabelings are not expanded at all (see
+// unexpandedFields), and neither are references to capture groups (like
+// "${1}") elsewhere.
+func expandEnvironment(v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			return expandEnvironment(v.Elem())
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if unexpandedFields[v.Type()][v.Type().Field(i).Name] {
+				continue
+			}
+
+			if f := v.Field(i); f.CanSet() {
+				if err := expandEnvironment(f); err != nil {
+					return err
+				}
+			}
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			if err := expandEnvironment(v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if v.Type().Elem().Kind() != reflect.String {
+			return nil
+		}
+
+		for _, k := range v.MapKeys() {
+			expanded, err := expandEnvironmentString(v.MapIndex(k).String())
+			if err != nil {
+				return err
+			}
+
+			v.SetMapIndex(k, reflect.ValueOf(expanded).Convert(v.Type().Elem()))
+		}
+	case reflect.String:
+		if v.CanSet() {
+			expanded, err := expandEnvironmentString(v.String())
+			if err != nil {
+				return err
+			}
+
+			v.SetString(expanded)
+		}
+	}
+
+	return nil
+}
+
+// expandEnvironmentString replaces the references to environment variables
+// in a single string (see expandEnvironment)
+func expandEnvironmentString(s string) (string, error) {
+	if !strings.Contains(s, "$") {
+		return s, nil
+	}
+
+	var b strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+
+		switch s[i+1] {
+		case '$':
+			b.WriteByte('$')
+			i++
+		case '{':
+			end := strings.IndexByte(s[i:], '}')
+			if end < 0 {
+				return "", fmt.Errorf("unterminated reference to an environment variable in '%s'", s)
+			}
+
+			ref := s[i+2 : i+end]
+			if !isEnvironmentReference(ref) {
+				b.WriteString(s[i : i+end+1])
+				i += end
+				continue
+			}
+
+			value, err := lookupEnvironment(ref)
+			if err != nil {
+				return "", err
+			}
+
+			b.WriteString(value)
+			i += end
+		default:
+			b.WriteByte('$')
+		}
+	}
+
+	return b.String(), nil
+}
+
+// isEnvironmentReference tests if ref (the text between "${" and "}") starts
+// with a valid environment variable name, as opposed to e.g. a capture group
+// index
+func isEnvironmentReference(ref string) bool {
+	for i, c := range ref {
+		switch {
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+		case c >= '0' && c <= '9' && i > 0:
+		case c == ':' && i > 0:
+			return strings.HasPrefix(ref[i:], ":-")
+		default:
+			return false
+		}
+	}
+
+	return ref != ""
+}
+
+// lookupEnvironment resolves a reference of the form "VAR" or "VAR:-default"
+func lookupEnvironment(ref string) (string, error) {
+	name, def, hasDefault := ref, "", false
+	if i := strings.Index(ref, ":-"); i >= 0 {
+		name, def, hasDefault = ref[:i], ref[i+2:], true
+	}
+
+	value, ok := os.LookupEnv(name)
+	switch {
+	case ok:
+		return value, nil
+	case hasDefault:
+		return def, nil
+	default:
+		return "", fmt.Errorf("environment variable '%s' is not set (use '${%s:-default}' to set a default value)", name, name)
+	}
+}
@@ -0,0 +1,122 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const HCLEnvironmentInput = `
+listen {
+  port = 4040
+}
+
+consul {
+  enable = true
+  address = "${TEST_NGINXLOG_CONSUL:-localhost:8500}"
+
+  service {
+    id = "exporter-${TEST_NGINXLOG_HOST}"
+    tags = ["env=${TEST_NGINXLOG_ENV}", "cost=$$5"]
+  }
+}
+
+namespace "nginx" {
+  format = "$remote_addr - $remote_user [$time_local] \"$request\" $status"
+  source_files = ["/var/log/${TEST_NGINXLOG_HOST}/access.log"]
+  labels {
+    host = "${TEST_NGINXLOG_HOST}"
+  }
+
+  relabel "class" {
+    from = "status"
+    match "^(\\d)\\d\\d$" {
+      replacement = "${1}xx"
+    }
+  }
+
+  relabel "request_uri" {
+    from = "request_uri"
+    match "^/(?P<resource>[a-z]+)/\\d+" {
+      replacement = "/${resource}/:id"
+    }
+  }
+}
+`
+
+func TestExpandsEnvironmentVariablesInConfigFile(t *testing.T) {
+	require.Nil(t, os.Setenv("TEST_NGINXLOG_HOST", "web-1"))
+	require.Nil(t, os.Setenv("TEST_NGINXLOG_ENV", "prod"))
+	defer os.Unsetenv("TEST_NGINXLOG_HOST")
+	defer os.Unsetenv("TEST_NGINXLOG_ENV")
+
+	buf := bytes.NewBufferString(HCLEnvironmentInput)
+	cfg := Config{}
+
+	err := LoadConfigFromStream(&cfg, buf, TypeHCL)
+	require.Nil(t, err, "unexpected error: %v", err)
+
+	assert.Equal(t, "localhost:8500", cfg.Consul.Address)
+	assert.Equal(t, "exporter-web-1", cfg.Consul.Service.ID)
+	assert.Equal(t, []string{"env=prod", "cost=$5"}, cfg.Consul.Service.Tags)
+
+	require.Len(t, cfg.Namespaces, 1)
+	ns := cfg.Namespaces[0]
+	assert.Equal(t, "$remote_addr - $remote_user [$time_local] \"$request\" $status", ns.Format)
+	assert.Equal(t, []string{"/var/log/web-1/access.log"}, ns.SourceFiles)
+	assert.Equal(t, "web-1", ns.Labels["host"])
+	require.Len(t, ns.RelabelConfigs, 2)
+	require.Len(t, ns.RelabelConfigs[0].Matches, 1)
+	assert.Equal(t, "${1}xx", ns.RelabelConfigs[0].Matches[0].Replacement)
+	require.Len(t, ns.RelabelConfigs[1].Matches, 1)
+	assert.Equal(t, "/${resource}/:id", ns.RelabelConfigs[1].Matches[0].Replacement)
+}
+
+func TestRejectsUnsetEnvironmentVariablesInConfigFile(t *testing.T) {
+	t.Parallel()
+
+	buf := bytes.NewBufferString(`
+namespace "nginx" {
+  source_files = ["/var/log/${TEST_NGINXLOG_UNSET}/access.log"]
+}
+`)
+	cfg := Config{}
+
+	err := LoadConfigFromStream(&cfg, buf, TypeHCL)
+	require.NotNil(t, err)
+	assert.Contains(t, err.Error(), "TEST_NGINXLOG_UNSET")
+}
+
+func TestExpandEnvironmentString(t *testing.T) {
+	t.Parallel()
+
+	os.Setenv("TEST_NGINXLOG_EXPAND", "value")
+
+	for input, expected := range map[string]string{
+		"":                                 "",
+		"plain":                            "plain",
+		"${TEST_NGINXLOG_EXPAND}":          "value",
+		"a${TEST_NGINXLOG_EXPAND}b":        "avalueb",
+		"${TEST_NGINXLOG_UNSET:-fallback}": "fallback",
+		"${TEST_NGINXLOG_UNSET:-}":         "",
+		"${TEST_NGINXLOG_EXPAND:-other}":   "value",
+		"$TEST_NGINXLOG_EXPAND":            "$TEST_NGINXLOG_EXPAND",
+		"$$":                               "$",
+		"$${TEST_NGINXLOG_EXPAND}":         "${TEST_NGINXLOG_EXPAND}",
+		"${1}xx":                           "${1}xx",
+		"trailing $":                       "trailing $",
+	} {
+		actual, err := expandEnvironmentString(input)
+		if assert.Nil(t, err, "unexpected error for '%s': %v", input, err) {
+			assert.Equal(t, expected, actual, "input '%s'", input)
+		}
+	}
+
+	for _, input := range []string{"${TEST_NGINXLOG_UNSET}", "${TEST_NGINXLOG_EXPAND"} {
+		_, err := expandEnvironmentString(input)
+		assert.NotNil(t, err, "expected error for '%s'", input)
+	}
+}
@@ -8,6 +8,7 @@ func LoadConfigFromFlags(config *Config, flags *StartupFlags) error {
 		Address:         "0.0.0.0",
 		MetricsEndpoint: flags.MetricsEndpoint,
 	}
+	config.OneShot = flags.OneShot
 	config.Namespaces = []NamespaceConfig{
 		{
 			Format: flags.Format,
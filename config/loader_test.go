@@ -3,6 +3,7 @@ package config
 import (
 	"bytes"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -28,6 +29,16 @@ consul {
   }
 }
 
+worker_pool {
+  size = 4
+  queue_size = 100
+}
+
+file_sd {
+  path = "/var/lib/exporter/metrics.prom"
+  interval = "30s"
+}
+
 namespace "nginx" {
   source_files = [
     "test.log",
@@ -78,6 +89,14 @@ consul:
       - foo
       - bar
 
+worker_pool:
+  size: 4
+  queue_size: 100
+
+file_sd:
+  path: "/var/lib/exporter/metrics.prom"
+  interval: "30s"
+
 namespaces:
   - name: nginx
     source_files:
@@ -114,6 +133,14 @@ func assertConfigContents(t *testing.T, cfg Config) {
 	assert.Equal(t, "https", cfg.Consul.Scheme)
 	assert.Equal(t, "asdfasfdasf", cfg.Consul.Token)
 
+	require.NotNil(t, cfg.WorkerPool)
+	assert.Equal(t, 4, cfg.WorkerPool.Size)
+	assert.Equal(t, 100, cfg.WorkerPool.QueueSize)
+
+	require.NotNil(t, cfg.FileExport)
+	assert.Equal(t, "/var/lib/exporter/metrics.prom", cfg.FileExport.Path)
+	assert.Equal(t, "30s", cfg.FileExport.Interval)
+
 	require.Len(t, cfg.Namespaces, 1)
 
 	n := cfg.Namespaces[0]
@@ -271,3 +298,487 @@ func TestLoadsNSLabeledYAMLConfigFile(t *testing.T) {
 	assert.Nil(t, err, "unexpected error: %v", err)
 	assertLabeledConfigContents(t, cfg)
 }
+
+const HCLDirectorySourceInput = `
+namespace "nginx" {
+  format = "$remote_addr - $remote_user [$time_local] \"$request\" $status $body_bytes_sent \"$http_referer\" \"$http_user_agent\" \"$http_x_forwarded_for\""
+
+  source {
+    directory "/var/log/nginx" {
+      pattern = "*.access.log"
+    }
+  }
+}
+`
+
+const YAMLDirectorySourceInput = `
+namespaces:
+  - name: nginx
+    format: "$remote_addr - $remote_user [$time_local] \"$request\" $status $body_bytes_sent \"$http_referer\" \"$http_user_agent\" \"$http_x_forwarded_for\""
+    source:
+      directories:
+        - path: /var/log/nginx
+          pattern: "*.access.log"
+`
+
+func assertDirectorySourceConfigContents(t *testing.T, cfg Config) {
+	require.Len(t, cfg.Namespaces, 1)
+	require.Len(t, cfg.Namespaces[0].SourceData.Directories, 1)
+
+	d := cfg.Namespaces[0].SourceData.Directories[0]
+	assert.Equal(t, "/var/log/nginx", d.Path)
+	assert.Equal(t, "*.access.log", d.Pattern)
+}
+
+func TestLoadsDirectorySourceFromHCLConfigFile(t *testing.T) {
+	t.Parallel()
+
+	buf := bytes.NewBufferString(HCLDirectorySourceInput)
+	cfg := Config{}
+
+	err := LoadConfigFromStream(&cfg, buf, TypeHCL)
+	assert.Nil(t, err, "unexpected error: %v", err)
+	assertDirectorySourceConfigContents(t, cfg)
+}
+
+func TestLoadsDirectorySourceFromYAMLConfigFile(t *testing.T) {
+	t.Parallel()
+
+	buf := bytes.NewBufferString(YAMLDirectorySourceInput)
+	cfg := Config{}
+
+	err := LoadConfigFromStream(&cfg, buf, TypeYAML)
+	assert.Nil(t, err, "unexpected error: %v", err)
+	assertDirectorySourceConfigContents(t, cfg)
+}
+
+const HCLFileGroupSourceInput = `
+namespace "nginx" {
+  format = "$remote_addr - $remote_user [$time_local] \"$request\" $status $body_bytes_sent \"$http_referer\" \"$http_user_agent\" \"$http_x_forwarded_for\""
+
+  source {
+    file_group "checkout" {
+      files = ["/var/log/nginx/checkout-*.log"]
+      labels = {
+        service = "checkout"
+      }
+    }
+
+    file_group "search" {
+      files = ["/var/log/nginx/search.log"]
+      labels = {
+        service = "search"
+      }
+    }
+  }
+}
+`
+
+const YAMLFileGroupSourceInput = `
+namespaces:
+  - name: nginx
+    format: "$remote_addr - $remote_user [$time_local] \"$request\" $status $body_bytes_sent \"$http_referer\" \"$http_user_agent\" \"$http_x_forwarded_for\""
+    source:
+      file_groups:
+        - name: checkout
+          files: ["/var/log/nginx/checkout-*.log"]
+          labels:
+            service: checkout
+        - name: search
+          files: ["/var/log/nginx/search.log"]
+          labels:
+            service: search
+`
+
+func assertFileGroupSourceConfigContents(t *testing.T, cfg Config) {
+	require.Len(t, cfg.Namespaces, 1)
+	require.Len(t, cfg.Namespaces[0].SourceData.FileGroups, 2)
+
+	g := cfg.Namespaces[0].SourceData.FileGroups
+	assert.Equal(t, "checkout", g[0].Name)
+	assert.Equal(t, "search", g[1].Name)
+	assert.Equal(t, FileSource{"/var/log/nginx/checkout-*.log"}, g[0].Files)
+	assert.Equal(t, map[string]string{"service": "checkout"}, g[0].Labels)
+	assert.Equal(t, FileSource{"/var/log/nginx/search.log"}, g[1].Files)
+	assert.Equal(t, map[string]string{"service": "search"}, g[1].Labels)
+}
+
+func TestLoadsFileGroupSourceFromHCLConfigFile(t *testing.T) {
+	t.Parallel()
+
+	buf := bytes.NewBufferString(HCLFileGroupSourceInput)
+	cfg := Config{}
+
+	err := LoadConfigFromStream(&cfg, buf, TypeHCL)
+	assert.Nil(t, err, "unexpected error: %v", err)
+	assertFileGroupSourceConfigContents(t, cfg)
+}
+
+func TestLoadsFileGroupSourceFromYAMLConfigFile(t *testing.T) {
+	t.Parallel()
+
+	buf := bytes.NewBufferString(YAMLFileGroupSourceInput)
+	cfg := Config{}
+
+	err := LoadConfigFromStream(&cfg, buf, TypeYAML)
+	assert.Nil(t, err, "unexpected error: %v", err)
+	assertFileGroupSourceConfigContents(t, cfg)
+}
+
+func TestValidateRejectsConfigWithoutNamespaces(t *testing.T) {
+	t.Parallel()
+
+	buf := bytes.NewBufferString("namespaces: []\n")
+	cfg := Config{}
+
+	require.Nil(t, LoadConfigFromStream(&cfg, buf, TypeYAML))
+	assert.NotNil(t, cfg.Validate())
+
+	cfg.EmptyNamespaces = "warn"
+	assert.Nil(t, cfg.Validate())
+
+	cfg.EmptyNamespaces = "ignore"
+	assert.NotNil(t, cfg.Validate())
+}
+
+const HCLMetricRelabelInput = `
+namespace "nginx" {
+  format = "$remote_addr - $remote_user [$time_local] \"$request\" $status $body_bytes_sent \"$http_referer\" \"$http_user_agent\" \"$http_x_forwarded_for\""
+
+  metric_relabel "drop" {
+    source_labels = ["__name__"]
+    regex = "nginx_http_response_size_bytes"
+  }
+
+  metric_relabel "replace" {
+    source_labels = ["status"]
+    regex = "(\\d)\\d\\d"
+    replacement = "${1}xx"
+    target_label = "class"
+  }
+}
+`
+
+func TestLoadsMetricRelabelConfigsFromHCLConfigFile(t *testing.T) {
+	t.Parallel()
+
+	buf := bytes.NewBufferString(HCLMetricRelabelInput)
+	cfg := Config{}
+
+	err := LoadConfigFromStream(&cfg, buf, TypeHCL)
+	require.Nil(t, err, "unexpected error: %v", err)
+	require.Len(t, cfg.Namespaces, 1)
+
+	n := cfg.Namespaces[0]
+	require.Nil(t, n.Compile())
+	require.Len(t, n.MetricRelabelConfigs, 2)
+
+	drop := n.MetricRelabelConfigs[0]
+	assert.Equal(t, "drop", drop.Action)
+	assert.Equal(t, []string{"__name__"}, drop.SourceLabels)
+	assert.Equal(t, "$1", *drop.Replacement)
+	assert.Equal(t, ";", *drop.Separator)
+
+	replace := n.MetricRelabelConfigs[1]
+	assert.Equal(t, "replace", replace.Action)
+	assert.Equal(t, "${1}xx", *replace.Replacement)
+	assert.Equal(t, "class", replace.TargetLabel)
+	assert.True(t, replace.CompiledRegex.MatchString("200"))
+	assert.False(t, replace.CompiledRegex.MatchString("2000"))
+}
+
+const HCLSummaryObjectivesInput = `
+namespace "nginx" {
+  format = "$remote_addr $status"
+
+  summary_objectives = {
+    "0.5" = 0.05
+    "0.99" = 0.001
+  }
+  summary_max_age = "5m"
+}
+`
+
+func TestLoadsSummaryObjectivesFromHCLConfigFile(t *testing.T) {
+	t.Parallel()
+
+	buf := bytes.NewBufferString(HCLSummaryObjectivesInput)
+	cfg := Config{}
+
+	err := LoadConfigFromStream(&cfg, buf, TypeHCL)
+	require.Nil(t, err, "unexpected error: %v", err)
+	require.Len(t, cfg.Namespaces, 1)
+
+	n := cfg.Namespaces[0]
+	require.Nil(t, n.Compile())
+	assert.Equal(t, map[float64]float64{0.5: 0.05, 0.99: 0.001}, n.CompiledSummaryObjectives)
+}
+
+const HCLKubernetesInput = `
+kubernetes {
+  enable = true
+  pod = "nginx-0"
+  labels = {
+    team = "web"
+  }
+}
+`
+
+func TestLoadsKubernetesConfigFromHCLConfigFile(t *testing.T) {
+	t.Parallel()
+
+	buf := bytes.NewBufferString(HCLKubernetesInput)
+	cfg := Config{}
+
+	err := LoadConfigFromStream(&cfg, buf, TypeHCL)
+	require.Nil(t, err, "unexpected error: %v", err)
+
+	assert.True(t, cfg.Kubernetes.Enable)
+	assert.Equal(t, "nginx-0", cfg.Kubernetes.Pod)
+	assert.Equal(t, map[string]string{"team": "web"}, cfg.Kubernetes.Labels)
+}
+
+func TestValidateRejectsMultipleRegistrations(t *testing.T) {
+	t.Parallel()
+
+	cfg := Config{
+		Namespaces: []NamespaceConfig{{Name: "test"}},
+		Consul:     ConsulConfig{Enable: true},
+		Etcd:       EtcdConfig{Enable: true},
+	}
+	assert.Error(t, cfg.Validate())
+
+	cfg.Consul.Enable = false
+	assert.NoError(t, cfg.Validate())
+
+	cfg.Etcd.LeaseTTL = "oops"
+	assert.Error(t, cfg.Validate())
+}
+
+func TestValidateRequiresAbsoluteMetricsEndpoint(t *testing.T) {
+	t.Parallel()
+
+	cfg := Config{
+		Listen:     ListenConfig{MetricsEndpoint: "metrics"},
+		Namespaces: []NamespaceConfig{{Name: "test"}},
+	}
+	assert.Error(t, cfg.Validate())
+
+	cfg.Listen.MetricsEndpoint = "/app1/metrics"
+	assert.NoError(t, cfg.Validate())
+}
+
+func TestUpstreamAddrLabelIsExperimental(t *testing.T) {
+	t.Parallel()
+
+	cfg := Config{Namespaces: []NamespaceConfig{{Name: "test", UpstreamAddrLabel: true}}}
+	assert.Error(t, cfg.StabilityWarnings())
+
+	cfg.EnableExperimentalFeatures = true
+	assert.NoError(t, cfg.StabilityWarnings())
+
+	n := NamespaceConfig{Name: "test", UpstreamAddrSelect: "random"}
+	assert.Error(t, n.Compile())
+}
+
+func TestValidateChecksLogFormatAndLevel(t *testing.T) {
+	t.Parallel()
+
+	cfg := Config{Namespaces: []NamespaceConfig{{Name: "test"}}, LogFormat: "logfmt", LogLevel: "warn"}
+	assert.NoError(t, cfg.Validate())
+
+	cfg.LogFormat = "xml"
+	assert.EqualError(t, cfg.Validate(), "log_format: must be 'text', 'json' or 'logfmt', is 'xml'")
+
+	cfg.LogFormat = "json"
+	cfg.LogLevel = "debug"
+	assert.EqualError(t, cfg.Validate(), "log_level: must be 'info', 'warn' or 'error', is 'debug'")
+}
+
+func TestClientIPLabelIsExperimental(t *testing.T) {
+	t.Parallel()
+
+	cfg := Config{Namespaces: []NamespaceConfig{{Name: "test", ClientIPLabel: true}}}
+	assert.Error(t, cfg.StabilityWarnings())
+
+	cfg.EnableExperimentalFeatures = true
+	assert.NoError(t, cfg.StabilityWarnings())
+}
+
+func TestValidateRequiresCertAndKeyTogether(t *testing.T) {
+	t.Parallel()
+
+	cfg := Config{Namespaces: []NamespaceConfig{{Name: "nginx"}}}
+	cfg.Listen.CertFile = "cert.pem"
+	assert.NotNil(t, cfg.Validate())
+
+	cfg.Listen.KeyFile = "key.pem"
+	assert.Nil(t, cfg.Validate())
+	assert.True(t, cfg.Listen.TLSEnabled())
+
+	cfg.Listen.CertFile = ""
+	cfg.Listen.KeyFile = ""
+	cfg.Listen.ClientCAFile = "ca.pem"
+	assert.NotNil(t, cfg.Validate())
+}
+
+func TestValidateRejectsInvalidBasicAuth(t *testing.T) {
+	t.Parallel()
+
+	cfg := Config{Namespaces: []NamespaceConfig{{Name: "nginx"}}}
+	cfg.Listen.BasicAuth = &BasicAuthConfig{Username: "prometheus", PasswordHash: "secret"}
+	assert.NotNil(t, cfg.Validate())
+
+	cfg.Listen.BasicAuth.PasswordHash = "$2y$10$9.AdYqHvXrzHsLmhqtZyXOsoDd0wgYBVOV9/1Sg/taW3BzXmze2Rm"
+	assert.Nil(t, cfg.Validate())
+
+	cfg.Listen.BasicAuth.Username = ""
+	assert.NotNil(t, cfg.Validate())
+}
+
+func TestValidateRejectsMultipleStdinSources(t *testing.T) {
+	t.Parallel()
+
+	cfg := Config{Namespaces: []NamespaceConfig{
+		{Name: "a", SourceData: SourceData{Files: FileSource{"-"}}},
+	}}
+	assert.Nil(t, cfg.Validate())
+
+	cfg.Namespaces = append(cfg.Namespaces, NamespaceConfig{
+		Name:       "b",
+		SourceData: SourceData{FileGroups: []FileGroupSource{{Name: "g", Files: FileSource{"-"}}}},
+	})
+	assert.NotNil(t, cfg.Validate())
+}
+
+func TestValidateRequiresPushgatewayURL(t *testing.T) {
+	t.Parallel()
+
+	cfg := Config{EmptyNamespaces: "warn", Pushgateway: &PushgatewayConfig{Job: "nginx"}}
+	assert.NotNil(t, cfg.Validate())
+
+	cfg.Pushgateway.URL = "http://pushgateway:9091"
+	assert.Nil(t, cfg.Validate())
+
+	cfg.Pushgateway.Interval = "0s"
+	assert.NotNil(t, cfg.Validate())
+}
+
+func TestValidateChecksStatsDConfig(t *testing.T) {
+	t.Parallel()
+
+	cfg := Config{EmptyNamespaces: "warn", StatsD: &StatsDConfig{Prefix: "nginx"}}
+	assert.EqualError(t, cfg.Validate(), "statsd: address must be set")
+
+	cfg.StatsD.Address = "localhost:8125"
+	assert.Nil(t, cfg.Validate())
+	assert.Equal(t, "udp", cfg.StatsD.ProtocolOrDefault())
+
+	cfg.StatsD.Protocol = "http"
+	assert.EqualError(t, cfg.Validate(), "statsd: protocol must be 'udp' or 'tcp', is 'http'")
+
+	cfg.StatsD.Protocol = "tcp"
+	cfg.StatsD.Tagging = "influxdb"
+	assert.EqualError(t, cfg.Validate(), "statsd: tagging must be 'dogstatsd', is 'influxdb'")
+}
+
+func TestValidateChecksDrainPeriod(t *testing.T) {
+	t.Parallel()
+
+	cfg := Config{EmptyNamespaces: "warn"}
+	assert.Nil(t, cfg.Validate())
+
+	period, err := cfg.DrainPeriodOrDefault()
+	assert.Nil(t, err)
+	assert.Equal(t, time.Duration(0), period)
+
+	cfg.DrainPeriod = "5s"
+	assert.Nil(t, cfg.Validate())
+
+	cfg.DrainPeriod = "-5s"
+	assert.EqualError(t, cfg.Validate(), "drain_period must not be negative, is '-5s'")
+}
+
+func TestValidateChecksOTLPConfig(t *testing.T) {
+	t.Parallel()
+
+	cfg := Config{EmptyNamespaces: "warn", OTLP: &OTLPConfig{Insecure: true}}
+	assert.EqualError(t, cfg.Validate(), "otlp: endpoint must be set")
+
+	cfg.OTLP.Endpoint = "localhost:4318"
+	assert.Nil(t, cfg.Validate())
+
+	interval, err := cfg.OTLP.IntervalOrDefault()
+	assert.Nil(t, err)
+	assert.Equal(t, 15*time.Second, interval)
+
+	cfg.OTLP.Interval = "-1s"
+	assert.EqualError(t, cfg.Validate(), "otlp: interval must be positive, is '-1s'")
+}
+
+func TestValidateRejectsOneShotSourcesNotReadFromBeginning(t *testing.T) {
+	t.Parallel()
+
+	cfg := Config{OneShot: true, Namespaces: []NamespaceConfig{
+		{Name: "a", SourceData: SourceData{Files: FileSource{"-"}}},
+		{Name: "b", SourceData: SourceData{Files: FileSource{"/var/log/nginx/access.log.1"}, ReadFrom: "end"}},
+	}}
+	assert.NotNil(t, cfg.Validate())
+
+	cfg.Namespaces[1].SourceData.ReadFrom = "beginning"
+	assert.Nil(t, cfg.Validate())
+
+	cfg.Namespaces[1].SourceData.ReadFrom = ""
+	assert.Nil(t, cfg.Validate())
+
+	cfg.Namespaces[1].SourceData.Syslog = &SyslogSource{}
+	assert.NotNil(t, cfg.Validate())
+}
+
+const HCLTailInput = `
+namespace "a" {
+  tail {
+    poll = false
+    reopen = false
+  }
+}
+
+namespace "b" {
+  tail {
+    poll_interval = "1s"
+  }
+}
+`
+
+func TestLoadsTailConfigFromHCLConfigFile(t *testing.T) {
+	t.Parallel()
+
+	buf := bytes.NewBufferString(HCLTailInput)
+	cfg := Config{}
+
+	err := LoadConfigFromStream(&cfg, buf, TypeHCL)
+	require.Nil(t, err, "unexpected error: %v", err)
+	require.Len(t, cfg.Namespaces, 2)
+
+	assert.False(t, cfg.Namespaces[0].Tail.PollEnabled())
+	assert.False(t, cfg.Namespaces[0].Tail.ReOpenEnabled())
+	assert.True(t, cfg.Namespaces[1].Tail.PollEnabled())
+	assert.True(t, cfg.Namespaces[1].Tail.ReOpenEnabled())
+
+	interval, err := cfg.PollInterval()
+	require.Nil(t, err)
+	assert.Equal(t, time.Second, interval)
+}
+
+func TestValidateRejectsDifferentPollIntervals(t *testing.T) {
+	t.Parallel()
+
+	cfg := Config{Namespaces: []NamespaceConfig{
+		{Name: "a", Tail: &TailConfig{PollInterval: "1s"}},
+		{Name: "b", Tail: &TailConfig{PollInterval: "1000ms"}},
+	}}
+	assert.Nil(t, cfg.Validate())
+
+	cfg.Namespaces[1].Tail.PollInterval = "2s"
+	assert.NotNil(t, cfg.Validate())
+}
@@ -0,0 +1,194 @@
+package config
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// URLAuthorizationEnv is the environment variable that contains the value of
+// the Authorization header that is sent when loading the configuration file
+// from a HTTP(S) URL
+const URLAuthorizationEnv = "CONFIG_FILE_AUTHORIZATION"
+
+// emptyPayloadHash is the SHA256 hash of an empty request body
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+var urlClient = &http.Client{Timeout: 30 * time.Second}
+
+// IsConfigURL tests if a configuration file name is a URL (instead of a local
+// file name)
+func IsConfigURL(filename string) bool {
+	return strings.HasPrefix(filename, "http://") ||
+		strings.HasPrefix(filename, "https://") ||
+		strings.HasPrefix(filename, "s3://")
+}
+
+// loadConfigFromURL fills a configuration object with values read from a
+// configuration file that is fetched from a HTTP(S) or S3 URL
+func loadConfigFromURL(config *Config, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("config file URL '%s' is invalid: %s", rawURL, err.Error())
+	}
+
+	typ, err := fileFormatFromName(u.Path)
+	if err != nil {
+		return err
+	}
+
+	var req *http.Request
+
+	switch u.Scheme {
+	case "http", "https":
+		req, err = http.NewRequest("GET", u.String(), nil)
+		if err != nil {
+			return err
+		}
+
+		if auth := os.Getenv(URLAuthorizationEnv); auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+	case "s3":
+		req, err = newS3Request(u, time.Now())
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("config file URL '%s' has unsupported scheme '%s'", rawURL, u.Scheme)
+	}
+
+	res, err := urlClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not fetch config file from '%s': %s", rawURL, err.Error())
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("could not fetch config file from '%s': server responded with status %s", rawURL, res.Status)
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return fmt.Errorf("could not fetch config file from '%s': %s", rawURL, err.Error())
+	}
+
+	return LoadConfigFromStream(config, bytes.NewReader(body), typ)
+}
+
+// newS3Request builds a request for fetching an object (given by a URL
+// like "s3://bucket/key") from S3. The region and credentials are read from
+// the usual AWS environment variables; without credentials, the request is
+// not signed (which works for public objects only).
+func newS3Request(u *url.URL, now time.Time) (*http.Request, error) {
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	host := fmt.Sprintf("%s.s3.%s.amazonaws.com", u.Host, region)
+
+	req, err := http.NewRequest("GET", "https://"+host+u.EscapedPath(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	accessKey := os.Getenv("AWS_ACCESS_KEY_ID")
+	secretKey := os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if accessKey == "" || secretKey == "" {
+		return req, nil
+	}
+
+	req.Header.Set("X-Amz-Content-Sha256", emptyPayloadHash)
+	if token := os.Getenv("AWS_SESSION_TOKEN"); token != "" {
+		req.Header.Set("X-Amz-Security-Token", token)
+	}
+
+	signS3Request(req, accessKey, secretKey, region, now)
+	return req, nil
+}
+
+// signS3Request signs a request (without body) to S3 using AWS Signature
+// Version 4, covering the host and all headers that are set on the request
+func signS3Request(req *http.Request, accessKey, secretKey, region string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	scope := path.Join(date, region, "s3", "aws4_request")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalPath := req.URL.EscapedPath()
+	if canonicalPath == "" {
+		canonicalPath = "/"
+	}
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalPath,
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		emptyPayloadHash,
+	}, "\n")
+
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hexSHA256(canonicalRequest),
+	}, "\n")
+
+	key := []byte("AWS4" + secretKey)
+	for _, part := range []string{date, region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature,
+	))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func hexSHA256(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
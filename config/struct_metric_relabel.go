@@ -0,0 +1,64 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// MetricRelabelConfig describes how the series of a namespace are relabeled
+// (or dropped) when they are exposed, similar to Prometheus'
+// metric_relabel_configs. The metric name is available as "__name__" label.
+type MetricRelabelConfig struct {
+	Action       string   `hcl:",key" yaml:"action"`
+	SourceLabels []string `hcl:"source_labels" yaml:"source_labels"`
+	Separator    *string  `hcl:"separator" yaml:"separator"`
+	Regex        string   `hcl:"regex" yaml:"regex"`
+	TargetLabel  string   `hcl:"target_label" yaml:"target_label"`
+	Replacement  *string  `hcl:"replacement" yaml:"replacement"`
+
+	CompiledRegex *regexp.Regexp
+}
+
+// Compile validates the configuration, fills in default values (like
+// Prometheus does) and compiles the regular expression
+func (c *MetricRelabelConfig) Compile() error {
+	if c.Action == "" {
+		c.Action = "replace"
+	}
+
+	if c.Separator == nil {
+		separator := ";"
+		c.Separator = &separator
+	}
+
+	if c.Replacement == nil {
+		replacement := "$1"
+		c.Replacement = &replacement
+	}
+
+	if c.Regex == "" {
+		c.Regex = "(.*)"
+	}
+
+	switch c.Action {
+	case "replace":
+		if c.TargetLabel == "" {
+			return fmt.Errorf("metric_relabel: action 'replace' requires a target_label")
+		}
+	case "keep", "drop":
+	case "labelkeep", "labeldrop":
+		if c.TargetLabel != "" || len(c.SourceLabels) > 0 {
+			return fmt.Errorf("metric_relabel: action '%s' does not support source_labels or target_label", c.Action)
+		}
+	default:
+		return fmt.Errorf("metric_relabel: unknown action '%s'", c.Action)
+	}
+
+	r, err := regexp.Compile("^(?:" + c.Regex + ")$")
+	if err != nil {
+		return fmt.Errorf("metric_relabel: could not compile regex '%s': %s", c.Regex, err.Error())
+	}
+
+	c.CompiledRegex = r
+	return nil
+}
@@ -2,50 +2,520 @@ package config
 
 import (
 	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"runtime"
 	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
 )
 
+var statusClassPattern = regexp.MustCompile("^[1-5]xx$")
+
 // NamespaceConfig is a struct describing single metric namespaces
 type NamespaceConfig struct {
 	Name string `hcl:",key"`
 
 	NamespaceLabelName string `hcl:"namespace_label" yaml:"namespace_label"`
 	NamespaceLabels    map[string]string
+	InstanceLabels     map[string]string
+
+	// ReadOnce is set if the log sources should be read once up to their
+	// end (see Config.OneShot)
+	ReadOnce bool
 
 	MetricsOverride *struct {
 		Prefix string `hcl:"prefix" yaml:"prefix"`
+		Suffix string `hcl:"suffix" yaml:"suffix"`
 	} `hcl:"metrics_override" yaml:"metrics_override"`
 	NamespacePrefix string
 
 	SourceFiles      []string          `hcl:"source_files" yaml:"source_files"`
 	SourceData       SourceData        `hcl:"source" yaml:"source"`
 	Format           string            `hcl:"format"`
+	FormatType       string            `hcl:"format_type" yaml:"format_type"`
 	Labels           map[string]string `hcl:"labels"`
 	RelabelConfigs   []RelabelConfig   `hcl:"relabel" yaml:"relabel_configs"`
 	HistogramBuckets []float64         `hcl:"histogram_buckets" yaml:"histogram_buckets"`
 
+	// ExemplarField is the log field (like "http_x_request_id") whose value
+	// is attached as trace_id exemplar to the observations of the latency
+	// histograms
+	ExemplarField string `hcl:"exemplar_field" yaml:"exemplar_field"`
+
+	SummaryObjectives         map[string]float64 `hcl:"summary_objectives" yaml:"summary_objectives"`
+	SummaryMaxAge             string             `hcl:"summary_max_age" yaml:"summary_max_age"`
+	SummaryAgeBuckets         uint32             `hcl:"summary_age_buckets" yaml:"summary_age_buckets"`
+	CompiledSummaryObjectives map[float64]float64
+	SummaryMaxAgeDuration     time.Duration
+
+	RequestSizeLatency *RequestSizeLatencyConfig `hcl:"request_size_latency" yaml:"request_size_latency"`
+	RequestsByHour     bool                      `hcl:"requests_by_hour" yaml:"requests_by_hour"`
+	StatusClassMetrics bool                      `hcl:"status_class_metrics" yaml:"status_class_metrics"`
+	StatusClassLabel   bool                      `hcl:"status_class_label" yaml:"status_class_label"`
+	ResponseSizeGauges bool                      `hcl:"response_size_gauges" yaml:"response_size_gauges"`
+	EndpointLabel      string                    `hcl:"endpoint_label" yaml:"endpoint_label"`
+	CacheMetrics       bool                      `hcl:"cache_metrics" yaml:"cache_metrics"`
+	CacheStatusLabel   bool                      `hcl:"cache_status_label" yaml:"cache_status_label"`
+	UpstreamLatency    *UpstreamLatencyConfig    `hcl:"upstream_latency" yaml:"upstream_latency"`
+	SNILabel           *SNILabelConfig           `hcl:"sni_label" yaml:"sni_label"`
+	RefererLabel       *RefererLabelConfig       `hcl:"referer_label" yaml:"referer_label"`
+	GeoIP              *GeoIPConfig              `hcl:"geoip" yaml:"geoip"`
+
+	CountUnmatchedRequests bool `hcl:"count_unmatched_requests" yaml:"count_unmatched_requests"`
+	TopMethods             int  `hcl:"top_methods" yaml:"top_methods"`
+	WithoutMethodMetrics   bool `hcl:"without_method_metrics" yaml:"without_method_metrics"`
+	NormalizeMethod        bool `hcl:"normalize_method" yaml:"normalize_method"`
+	NormalizeOtherMethod   bool `hcl:"normalize_other_method" yaml:"normalize_other_method"`
+	UpstreamStatusLatency  bool `hcl:"upstream_status_latency" yaml:"upstream_status_latency"`
+
+	// UpstreamAttempts adds a histogram of the number of upstream servers
+	// that were contacted for each request
+	UpstreamAttempts bool `hcl:"upstream_attempts" yaml:"upstream_attempts"`
+
+	// DetailedUpstreamMetrics adds metrics for the connect and header times
+	// of upstream servers (from $upstream_connect_time and
+	// $upstream_header_time)
+	DetailedUpstreamMetrics bool `hcl:"detailed_upstream_metrics" yaml:"detailed_upstream_metrics"`
+
+	// MaxSeries limits the number of distinct label value combinations of
+	// the per-line metrics; further combinations are counted in a single
+	// series instead, whose "over_limit" label is "true"
+	MaxSeries int `hcl:"max_series" yaml:"max_series"`
+
+	RequestPattern         string `hcl:"request_pattern" yaml:"request_pattern"`
+	CompiledRequestPattern *regexp.Regexp
+	MissingRequest         string `hcl:"missing_request" yaml:"missing_request"`
+
+	ProtocolLabel  bool   `hcl:"protocol_label" yaml:"protocol_label"`
+	ProtocolSource string `hcl:"protocol_source" yaml:"protocol_source"`
+
+	BytesField string  `hcl:"bytes_field" yaml:"bytes_field"`
+	SampleRate float64 `hcl:"sample_rate" yaml:"sample_rate"`
+
+	// SampleEvery makes the exporter process only every n-th log line, and
+	// count it as n lines (for logs with too many lines to process them all)
+	SampleEvery int `hcl:"sample_every" yaml:"sample_every"`
+
+	// UpstreamTimeAggregation describes how the response times of multiple
+	// upstreams are combined into the observed upstream time; either "sum"
+	// (the default), "last" or "max".
+	UpstreamTimeAggregation string `hcl:"upstream_time_aggregation" yaml:"upstream_time_aggregation"`
+
+	// UpstreamAddrLabel adds an "upstream_addr" label with the address of
+	// the upstream that handled a request; if multiple upstreams were
+	// contacted, UpstreamAddrSelect chooses either the "first" or the "last"
+	// (the default) one.
+	UpstreamAddrLabel  bool   `hcl:"upstream_addr_label" yaml:"upstream_addr_label"`
+	UpstreamAddrSelect string `hcl:"upstream_addr_select" yaml:"upstream_addr_select"`
+
+	// ClientIPLabel adds a "client_ip" label with the first address from
+	// $http_x_forwarded_for, or $remote_addr if that header is empty
+	ClientIPLabel bool `hcl:"client_ip_label" yaml:"client_ip_label"`
+
+	// TimeFormat is the layout (in the format of Go's time package) of the
+	// "time_local" or "time_iso8601" field, if it differs from NGINX' default
+	TimeFormat        string `hcl:"time_format" yaml:"time_format"`
+	LastLineTimestamp bool   `hcl:"last_line_timestamp" yaml:"last_line_timestamp"`
+
+	Multiline *MultilineConfig `hcl:"multiline" yaml:"multiline"`
+	Tail      *TailConfig      `hcl:"tail" yaml:"tail"`
+	ClockSkew *ClockSkewConfig `hcl:"clock_skew" yaml:"clock_skew"`
+	ZeroInit  *ZeroInitConfig  `hcl:"zero_init" yaml:"zero_init"`
+
+	// WorkerPool describes a pool of goroutines that processes the lines of
+	// this namespace only, instead of the shared worker pool
+	WorkerPool *WorkerPoolConfig `hcl:"worker_pool" yaml:"worker_pool"`
+
+	ActiveWindow         string `hcl:"active_window" yaml:"active_window"`
+	ActiveWindowDuration time.Duration
+
+	ParseRatioWindow         string `hcl:"parse_ratio_window" yaml:"parse_ratio_window"`
+	ParseRatioWindowDuration time.Duration
+
+	SlowLineThreshold         string `hcl:"slow_line_threshold" yaml:"slow_line_threshold"`
+	SlowLineThresholdDuration time.Duration
+
+	IdleTimeout         string `hcl:"idle_timeout" yaml:"idle_timeout"`
+	IdleTimeoutDuration time.Duration
+	IdleResetMetrics    bool `hcl:"idle_reset_metrics" yaml:"idle_reset_metrics"`
+
+	LatencyStatusFilter    []string `hcl:"latency_status_filter" yaml:"latency_status_filter"`
+	LatencyStatusFilterMap map[string]struct{}
+
+	Compat map[string]string `hcl:"compat" yaml:"compat"`
+
+	MetricRelabelConfigs []MetricRelabelConfig `hcl:"metric_relabel" yaml:"metric_relabel_configs"`
+
 	PrintLog bool `hcl:"print_log" yaml:"print_log"`
+	Shadow   bool `hcl:"shadow" yaml:"shadow"`
 
 	OrderedLabelNames  []string
 	OrderedLabelValues []string
 }
 
 type SourceData struct {
-	Files  FileSource    `hcl:"files" yaml:"files"`
-	Syslog *SyslogSource `hcl:"syslog" yaml:"syslog"`
+	Files       FileSource        `hcl:"files" yaml:"files"`
+	Directories []DirectorySource `hcl:"directory" yaml:"directories"`
+	Syslog      *SyslogSource     `hcl:"syslog" yaml:"syslog"`
+	FileGroups  []FileGroupSource `hcl:"file_group" yaml:"file_groups"`
+
+	// Symlinks describes how files that are symbolic links are followed;
+	// either "follow" (follow the link when it is repointed, the default)
+	// or "pin" (keep following the original link target).
+	Symlinks string `hcl:"symlinks" yaml:"symlinks"`
+
+	// WatchDirectory enables watching the directories of glob patterns in
+	// Files, so that matching files that are created later are followed,
+	// too (like a DirectorySource).
+	WatchDirectory bool `hcl:"watch_directory" yaml:"watch_directory"`
+
+	// ReadFrom describes where reading of files that already exist starts;
+	// either "end" (the default), "beginning", or "saved" (the offset that
+	// was saved in PositionsFile, when the exporter was stopped).
+	ReadFrom      string `hcl:"read_from" yaml:"read_from"`
+	PositionsFile string `hcl:"positions_file" yaml:"positions_file"`
+}
+
+// isFilePattern returns true if a file name contains glob meta characters;
+// like in filepath.Match, the backslash only escapes characters where it is
+// not the path separator (so not on Windows)
+func isFilePattern(filename string) bool {
+	meta := `*?[`
+	if filepath.Separator != '\\' {
+		meta += `\`
+	}
+
+	return strings.ContainsAny(filename, meta)
+}
+
+// FilePatterns returns the files that should be followed; with
+// WatchDirectory, glob patterns are returned as watched directories instead.
+func (s *SourceData) FilePatterns() ([]string, []DirectorySource) {
+	if !s.WatchDirectory {
+		return s.Files, nil
+	}
+
+	var files []string
+	var directories []DirectorySource
+
+	for _, f := range s.Files {
+		if !isFilePattern(f) {
+			files = append(files, f)
+			continue
+		}
+
+		directories = append(directories, DirectorySource{Path: filepath.Dir(f), Pattern: filepath.Base(f)})
+	}
+
+	return files, directories
+}
+
+// StdinFilename is the file name that denotes the standard input as log
+// source
+const StdinFilename = "-"
+
+// MinSampleRate is the lowest allowed value of the sample_rate option; since
+// histograms are observed once per request that a log line accounts for, lower
+// rates would make every line cost thousands of observations
+const MinSampleRate = 0.001
+
+// stdinSources returns how often the standard input is used as log source
+func (s *SourceData) stdinSources() int {
+	n := 0
+	files := append([]string{}, s.Files...)
+	for _, g := range s.FileGroups {
+		files = append(files, g.Files...)
+	}
+
+	for _, f := range files {
+		if f == StdinFilename {
+			n++
+		}
+	}
+
+	return n
+}
+
+// validateOneShot checks if all log sources can be read to their end once
+// (see Config.OneShot); this is only possible for files (which are always
+// read from their beginning), and the standard input
+func (s *SourceData) validateOneShot() error {
+	if s.Syslog != nil {
+		return errors.New("syslog sources cannot be read once")
+	}
+
+	if len(s.Directories) > 0 || s.WatchDirectory {
+		return errors.New("watched directories cannot be read once")
+	}
+
+	switch s.ReadFrom {
+	case "", "beginning":
+	default:
+		return fmt.Errorf("files can only be read once from their beginning, but read_from is '%s'", s.ReadFrom)
+	}
+
+	return nil
 }
 
 type FileSource []string
 
+// FileGroupSource describes a (named) group of files whose lines carry
+// additional static labels. The files may be given as glob patterns, which
+// are expanded when the exporter starts.
+type FileGroupSource struct {
+	Name   string            `hcl:",key" yaml:"name"`
+	Files  FileSource        `hcl:"files" yaml:"files"`
+	Labels map[string]string `hcl:"labels" yaml:"labels"`
+}
+
+// DirectorySource describes a directory that is watched for log files. All
+// files matching the pattern are followed, including files that are created
+// after the exporter was started.
+type DirectorySource struct {
+	Path    string `hcl:",key" yaml:"path"`
+	Pattern string `hcl:"pattern" yaml:"pattern"`
+}
+
 type SyslogSource struct {
 	ListenAddress string   `hcl:"listen_address" yaml:"listen_address"`
 	Format        string   `hcl:"format" yaml:"format"`
 	Tags          []string `hcl:"tags" yaml:"tags"`
+
+	// ListenAddresses contains additional addresses to listen on (for
+	// example, to accept messages via both UDP and TCP)
+	ListenAddresses []string `hcl:"listen_addresses" yaml:"listen_addresses"`
+}
+
+// Addresses returns all addresses that the syslog server should listen on
+func (s *SyslogSource) Addresses() []string {
+	var addresses []string
+	if s.ListenAddress != "" {
+		addresses = append(addresses, s.ListenAddress)
+	}
+
+	return append(addresses, s.ListenAddresses...)
+}
+
+// RequestSizeLatencyConfig describes how response times should additionally be
+// partitioned by the size of the request that caused them. The thresholds
+// are pointers, so that an explicit 0 can be told apart from an unset value.
+type RequestSizeLatencyConfig struct {
+	Field      string   `hcl:"field" yaml:"field"`
+	SmallBelow *float64 `hcl:"small_below" yaml:"small_below"`
+	LargeAbove *float64 `hcl:"large_above" yaml:"large_above"`
+}
+
+// UpstreamLatencyConfig describes how upstream response times should
+// additionally be observed per upstream address
+type UpstreamLatencyConfig struct {
+	Upstreams []string `hcl:"upstreams" yaml:"upstreams"`
+
+	UpstreamsMap map[string]struct{}
+}
+
+// MultilineConfig describes how log entries that span multiple lines should
+// be joined before parsing
+type MultilineConfig struct {
+	StartPattern string `hcl:"start_pattern" yaml:"start_pattern"`
+
+	CompiledStartPattern *regexp.Regexp
+}
+
+// Compile compiles the start pattern for later use
+func (c *MultilineConfig) Compile() error {
+	if c.StartPattern == "" {
+		return errors.New("multiline: start_pattern must not be empty")
+	}
+
+	r, err := regexp.Compile(c.StartPattern)
+	if err != nil {
+		return fmt.Errorf("multiline: could not compile start_pattern '%s': %s", c.StartPattern, err.Error())
+	}
+
+	c.CompiledStartPattern = r
+	return nil
+}
+
+// TailConfig describes how the log files of a namespace are followed
+type TailConfig struct {
+	// Poll and ReOpen correspond to the options of the same name of
+	// tail.Options; both are enabled unless disabled explicitly.
+	Poll   *bool `hcl:"poll" yaml:"poll"`
+	ReOpen *bool `hcl:"reopen" yaml:"reopen"`
+
+	// PollInterval is the interval in which files are polled for changes;
+	// it applies to all namespaces.
+	PollInterval         string `hcl:"poll_interval" yaml:"poll_interval"`
+	PollIntervalDuration time.Duration
+}
+
+// PollEnabled returns true if files should be polled for changes
+func (c *TailConfig) PollEnabled() bool {
+	return c == nil || c.Poll == nil || *c.Poll
+}
+
+// ReOpenEnabled returns true if files should be opened again when they are
+// recreated
+func (c *TailConfig) ReOpenEnabled() bool {
+	return c == nil || c.ReOpen == nil || *c.ReOpen
+}
+
+// Compile parses the poll interval, and checks that polling is enabled if
+// it is required
+func (c *TailConfig) Compile() error {
+	if c.PollInterval != "" {
+		d, err := time.ParseDuration(c.PollInterval)
+		if err != nil {
+			return fmt.Errorf("tail: invalid poll_interval '%s': %s", c.PollInterval, err.Error())
+		}
+
+		if d <= 0 {
+			return fmt.Errorf("tail: poll_interval must be positive, is '%s'", c.PollInterval)
+		}
+
+		if !c.PollEnabled() {
+			return errors.New("tail: poll_interval requires poll to be enabled")
+		}
+
+		c.PollIntervalDuration = d
+	}
+
+	// without polling, deleted files are not detected on Windows, since
+	// they cannot be opened anymore while they are still being read
+	if !c.PollEnabled() && c.ReOpenEnabled() && runtime.GOOS == "windows" {
+		return errors.New("tail: reopen requires poll to be enabled on Windows")
+	}
+
+	return nil
+}
+
+// ZeroInitConfig describes that the request counters should be initialized
+// with zero for all known label combinations when the exporter starts
+type ZeroInitConfig struct {
+	// Status contains the status codes that the counters are initialized for,
+	// unless the values of the "status" label are restricted by a whitelist.
+	Status []string `hcl:"status" yaml:"status"`
+}
+
+// StatusOrDefault returns the configured status codes, or "200", "404" and
+// "500" if none are configured
+func (c *ZeroInitConfig) StatusOrDefault() []string {
+	if len(c.Status) > 0 {
+		return c.Status
+	}
+
+	return []string{"200", "404", "500"}
+}
+
+// ClockSkewConfig describes how the difference between the timestamps of log
+// lines and the system time should be exported
+type ClockSkewConfig struct {
+	Threshold         string `hcl:"threshold" yaml:"threshold"`
+	ThresholdDuration time.Duration
+}
+
+// Compile parses the (optional) threshold
+func (c *ClockSkewConfig) Compile() error {
+	if c.Threshold == "" {
+		return nil
+	}
+
+	threshold, err := time.ParseDuration(c.Threshold)
+	if err != nil {
+		return fmt.Errorf("clock_skew: invalid threshold '%s': %s", c.Threshold, err.Error())
+	}
+
+	if threshold <= 0 {
+		return fmt.Errorf("clock_skew: threshold must be positive, is '%s'", c.Threshold)
+	}
+
+	c.ThresholdDuration = threshold
+	return nil
+}
+
+// RefererLabelConfig describes how requests should be classified by whether
+// their referer is one of the site's own domains ("internal"), another site
+// ("external") or missing ("none"), exported as "referer" label
+type RefererLabelConfig struct {
+	Domains []string `hcl:"domains" yaml:"domains"`
+}
+
+// relabelConfig builds the relabel configuration that maps the (synthetic)
+// "referer_class" field to the "referer" label
+func (c *RefererLabelConfig) relabelConfig() RelabelConfig {
+	return RelabelConfig{
+		TargetLabel: "referer",
+		SourceValue: "referer_class",
+	}
+}
+
+// GeoIPConfig describes how requests should be labeled by the location of
+// their client (the "remote_addr" field), as looked up in a MaxMind database.
+// Countries that are not in the (optional) allowlist are mapped to "other";
+// the city is only exported if enabled, since it has a high cardinality.
+type GeoIPConfig struct {
+	Database  string   `hcl:"database" yaml:"database"`
+	Countries []string `hcl:"countries" yaml:"countries"`
+	City      bool     `hcl:"city" yaml:"city"`
+}
+
+// relabelConfigs builds the relabel configurations that map the (synthetic)
+// "geoip_country" and "geoip_city" fields to labels of the same name.
+// Clients whose location is not known are mapped to "unknown".
+func (c *GeoIPConfig) relabelConfigs() []RelabelConfig {
+	configs := []RelabelConfig{{
+		TargetLabel: "geoip_country",
+		SourceValue: "geoip_country",
+		Whitelist:   c.Countries,
+		EmptyValue:  "unknown",
+	}}
+
+	if c.City {
+		configs = append(configs, RelabelConfig{
+			TargetLabel: "geoip_city",
+			SourceValue: "geoip_city",
+			EmptyValue:  "unknown",
+		})
+	}
+
+	return configs
+}
+
+// SNILabelConfig describes how the TLS server name (SNI) of a request should
+// be exported as "sni" label
+type SNILabelConfig struct {
+	ServerNames []string `hcl:"server_names" yaml:"server_names"`
+}
+
+// relabelConfig builds the relabel configuration that maps the
+// "ssl_server_name" field to the "sni" label. Server names that are not in
+// the (optional) allowlist are mapped to "other", and requests without SNI
+// to "none".
+func (c *SNILabelConfig) relabelConfig() RelabelConfig {
+	return RelabelConfig{
+		TargetLabel: "sni",
+		SourceValue: "ssl_server_name",
+		Whitelist:   c.ServerNames,
+		EmptyValue:  "none",
+	}
 }
 
 // StabilityWarnings tests if the NamespaceConfig uses any configuration settings
 // that are not yet declared "stable"
 func (c *NamespaceConfig) StabilityWarnings() error {
+	if c.UpstreamAddrLabel {
+		return errors.New("you are using the 'upstream_addr_label' configuration parameter (which adds a label value for every upstream address)")
+	}
+
+	if c.ClientIPLabel {
+		return errors.New("you are using the 'client_ip_label' configuration parameter (which adds a label value for every client address)")
+	}
+
 	if len(c.RelabelConfigs) > 0 {
 		return errors.New("you are using the 'relabel' configuration parameter")
 	}
@@ -83,14 +553,313 @@ func (c *NamespaceConfig) ResolveDeprecations() {
 // Compile compiles the configuration (mostly regular expressions that are used
 // in configuration variables) for later use
 func (c *NamespaceConfig) Compile() error {
+	c.sanitizeLabelNames()
+	c.resolveFormatPreset()
+
+	if c.SNILabel != nil && c.relabelTarget("sni") == nil {
+		c.RelabelConfigs = append(c.RelabelConfigs, c.SNILabel.relabelConfig())
+	}
+
+	if c.RequestPattern != "" {
+		if err := c.compileRequestPattern(); err != nil {
+			return err
+		}
+	}
+
+	if c.SourceData.Syslog != nil && len(c.SourceData.Syslog.Addresses()) == 0 {
+		return errors.New("syslog: listen_address must be set")
+	}
+
+	if c.SourceData.WatchDirectory {
+		for _, f := range c.SourceData.Files {
+			if isFilePattern(f) && isFilePattern(filepath.Dir(f)) {
+				return fmt.Errorf("files: patterns may only match file names when watch_directory is set, not directories (in '%s')", f)
+			}
+		}
+	}
+
+	switch c.SourceData.ReadFrom {
+	case "", "end", "beginning":
+	case "saved":
+		if c.SourceData.PositionsFile == "" {
+			return errors.New("read_from: positions_file must be set to read from saved positions")
+		}
+	default:
+		return fmt.Errorf("read_from: must be 'end', 'beginning' or 'saved', is '%s'", c.SourceData.ReadFrom)
+	}
+
+	switch c.SourceData.Symlinks {
+	case "", "follow", "pin":
+	default:
+		return fmt.Errorf("symlinks: must be 'follow' or 'pin', is '%s'", c.SourceData.Symlinks)
+	}
+
+	switch c.FormatType {
+	case "", "text", "json":
+	default:
+		return fmt.Errorf("format_type: must be 'text' or 'json', is '%s'", c.FormatType)
+	}
+
+	switch c.ProtocolSource {
+	case "", "server_protocol", "request":
+	default:
+		return fmt.Errorf("protocol_source: must be 'server_protocol' or 'request', is '%s'", c.ProtocolSource)
+	}
+
+	switch c.MissingRequest {
+	case "", "proceed", "skip", "count":
+	default:
+		return fmt.Errorf("missing_request: must be 'proceed', 'skip' or 'count', is '%s'", c.MissingRequest)
+	}
+
+	switch c.UpstreamTimeAggregation {
+	case "", "sum", "last", "max":
+	default:
+		return fmt.Errorf("upstream_time_aggregation: must be 'sum', 'last' or 'max', is '%s'", c.UpstreamTimeAggregation)
+	}
+
+	if c.RefererLabel != nil {
+		for i, d := range c.RefererLabel.Domains {
+			c.RefererLabel.Domains[i] = strings.ToLower(strings.TrimPrefix(d, "."))
+		}
+
+		if c.relabelTarget("referer") == nil {
+			c.RelabelConfigs = append(c.RelabelConfigs, c.RefererLabel.relabelConfig())
+		}
+	}
+
+	if c.GeoIP != nil {
+		if c.GeoIP.Database == "" {
+			return errors.New("geoip: database must be set")
+		}
+
+		for _, r := range c.GeoIP.relabelConfigs() {
+			if c.relabelTarget(r.TargetLabel) == nil {
+				c.RelabelConfigs = append(c.RelabelConfigs, r)
+			}
+		}
+	}
+
+	if c.ProtocolLabel && c.relabelTarget("protocol") == nil {
+		c.RelabelConfigs = append(c.RelabelConfigs, RelabelConfig{
+			TargetLabel: "protocol",
+			SourceValue: "server_protocol",
+		})
+	}
+
+	switch c.UpstreamAddrSelect {
+	case "", "first", "last":
+	default:
+		return fmt.Errorf("upstream_addr_select: must be 'first' or 'last', is '%s'", c.UpstreamAddrSelect)
+	}
+
+	if c.UpstreamAddrLabel && c.relabelTarget("upstream_addr") == nil {
+		c.RelabelConfigs = append(c.RelabelConfigs, RelabelConfig{
+			TargetLabel: "upstream_addr",
+			SourceValue: "upstream_addr.selected",
+			EmptyValue:  "none",
+		})
+	}
+
+	if c.ClientIPLabel && c.relabelTarget("client_ip") == nil {
+		c.RelabelConfigs = append(c.RelabelConfigs, RelabelConfig{
+			TargetLabel: "client_ip",
+			SourceValue: "client_ip",
+			EmptyValue:  "none",
+		})
+	}
+
+	if c.CacheStatusLabel && c.relabelTarget("upstream_cache_status") == nil {
+		c.RelabelConfigs = append(c.RelabelConfigs, RelabelConfig{
+			TargetLabel: "upstream_cache_status",
+			SourceValue: "upstream_cache_status",
+		})
+	}
+
+	if c.StatusClassLabel && c.relabelTarget("status_class") == nil {
+		c.RelabelConfigs = append(c.RelabelConfigs, RelabelConfig{
+			TargetLabel: "status_class",
+			SourceValue: "status_class",
+		})
+	}
+
+	if c.MaxSeries > 0 && c.relabelTarget("over_limit") == nil {
+		c.RelabelConfigs = append(c.RelabelConfigs, RelabelConfig{
+			TargetLabel: "over_limit",
+			SourceValue: "over_limit",
+		})
+	}
+
 	for i := range c.RelabelConfigs {
 		if err := c.RelabelConfigs[i].Compile(); err != nil {
-			return nil
+			return err
+		}
+	}
+
+	if err := c.addGroupLabels(); err != nil {
+		return err
+	}
+
+	if err := c.compileSummaryOptions(); err != nil {
+		return err
+	}
+
+	for i := 1; i < len(c.HistogramBuckets); i++ {
+		if c.HistogramBuckets[i] <= c.HistogramBuckets[i-1] {
+			return fmt.Errorf("histogram_buckets: must be strictly increasing, but %v is followed by %v", c.HistogramBuckets[i-1], c.HistogramBuckets[i])
 		}
 	}
-	if c.NamespaceLabelName != "" {
+
+	if c.NamespaceLabelName != "" || len(c.InstanceLabels) > 0 {
 		c.NamespaceLabels = make(map[string]string)
-		c.NamespaceLabels[c.NamespaceLabelName] = c.Name
+
+		for name, value := range c.InstanceLabels {
+			c.NamespaceLabels[name] = value
+		}
+
+		if c.NamespaceLabelName != "" {
+			c.NamespaceLabels[c.NamespaceLabelName] = c.Name
+		}
+	}
+
+	for _, g := range c.SourceData.FileGroups {
+		if len(g.Files) == 0 {
+			return fmt.Errorf("file_group '%s': no files given", g.Name)
+		}
+
+		for name := range g.Labels {
+			if _, ok := c.NamespaceLabels[name]; ok {
+				return fmt.Errorf("file_group '%s': label '%s' is already used as namespace label", g.Name, name)
+			}
+		}
+	}
+
+	for i := range c.MetricRelabelConfigs {
+		if err := c.MetricRelabelConfigs[i].Compile(); err != nil {
+			return err
+		}
+	}
+
+	if c.RequestSizeLatency != nil {
+		if err := c.RequestSizeLatency.Compile(); err != nil {
+			return err
+		}
+	}
+
+	if c.UpstreamLatency != nil {
+		c.UpstreamLatency.Compile()
+	}
+
+	if c.TopMethods < 0 {
+		return fmt.Errorf("top_methods: must not be negative, is %d", c.TopMethods)
+	}
+
+	if c.SampleRate != 0 && (c.SampleRate < MinSampleRate || c.SampleRate > 1) {
+		return fmt.Errorf("sample_rate: must be between %g and 1, is %g", MinSampleRate, c.SampleRate)
+	}
+
+	if c.SampleEvery < 0 {
+		return fmt.Errorf("sample_every: must not be negative, is %d", c.SampleEvery)
+	}
+
+	if c.MaxSeries < 0 {
+		return fmt.Errorf("max_series: must not be negative, is %d", c.MaxSeries)
+	}
+
+	if c.Multiline != nil {
+		if err := c.Multiline.Compile(); err != nil {
+			return err
+		}
+	}
+
+	if c.Tail != nil {
+		if err := c.Tail.Compile(); err != nil {
+			return err
+		}
+	}
+
+	if c.ClockSkew != nil {
+		if err := c.ClockSkew.Compile(); err != nil {
+			return err
+		}
+	}
+
+	if c.ActiveWindow != "" {
+		window, err := time.ParseDuration(c.ActiveWindow)
+		if err != nil {
+			return fmt.Errorf("active_window: invalid duration '%s': %s", c.ActiveWindow, err.Error())
+		}
+
+		if window <= 0 {
+			return fmt.Errorf("active_window: duration must be positive, is '%s'", c.ActiveWindow)
+		}
+
+		c.ActiveWindowDuration = window
+	}
+
+	if c.ParseRatioWindow != "" {
+		window, err := time.ParseDuration(c.ParseRatioWindow)
+		if err != nil {
+			return fmt.Errorf("parse_ratio_window: invalid duration '%s': %s", c.ParseRatioWindow, err.Error())
+		}
+
+		if window <= 0 {
+			return fmt.Errorf("parse_ratio_window: duration must be positive, is '%s'", c.ParseRatioWindow)
+		}
+
+		c.ParseRatioWindowDuration = window
+	}
+
+	if c.SlowLineThreshold != "" {
+		threshold, err := time.ParseDuration(c.SlowLineThreshold)
+		if err != nil {
+			return fmt.Errorf("slow_line_threshold: invalid duration '%s': %s", c.SlowLineThreshold, err.Error())
+		}
+
+		if threshold <= 0 {
+			return fmt.Errorf("slow_line_threshold: duration must be positive, is '%s'", c.SlowLineThreshold)
+		}
+
+		c.SlowLineThresholdDuration = threshold
+	}
+
+	if c.IdleTimeout != "" {
+		timeout, err := time.ParseDuration(c.IdleTimeout)
+		if err != nil {
+			return fmt.Errorf("idle_timeout: invalid duration '%s': %s", c.IdleTimeout, err.Error())
+		}
+
+		if timeout <= 0 {
+			return fmt.Errorf("idle_timeout: duration must be positive, is '%s'", c.IdleTimeout)
+		}
+
+		c.IdleTimeoutDuration = timeout
+	}
+
+	c.LatencyStatusFilterMap = make(map[string]struct{}, len(c.LatencyStatusFilter))
+	for _, class := range c.LatencyStatusFilter {
+		if !statusClassPattern.MatchString(class) {
+			return fmt.Errorf("latency_status_filter: '%s' is not a status class like '2xx'", class)
+		}
+
+		c.LatencyStatusFilterMap[class] = struct{}{}
+	}
+
+	for name := range c.Compat {
+		if !model.IsValidMetricName(model.LabelValue(name)) {
+			return fmt.Errorf("compat: '%s' is not a valid metric name", name)
+		}
+	}
+
+	if c.EndpointLabel != "" {
+		r := c.relabelTarget(c.EndpointLabel)
+		if r == nil {
+			return fmt.Errorf("endpoint_label '%s' does not refer to a relabel configuration", c.EndpointLabel)
+		}
+
+		if r.DisableLabel {
+			return fmt.Errorf("endpoint_label '%s' refers to a relabel configuration with disable_label = true", c.EndpointLabel)
+		}
 	}
 
 	c.OrderLabels()
@@ -102,12 +871,224 @@ func (c *NamespaceConfig) Compile() error {
 	return nil
 }
 
-// OrderLabels builds two lists of label keys and values, ordered by label name
+// defaultSummaryObjectives are the quantiles (and their allowed errors) that
+// summaries expose unless configured otherwise
+var defaultSummaryObjectives = map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001}
+
+// compileSummaryOptions parses the quantiles of the summary_objectives option
+// (which are given as strings, since HCL only supports string keys) and the
+// summary_max_age
+func (c *NamespaceConfig) compileSummaryOptions() error {
+	c.CompiledSummaryObjectives = defaultSummaryObjectives
+
+	if len(c.SummaryObjectives) > 0 {
+		c.CompiledSummaryObjectives = make(map[float64]float64, len(c.SummaryObjectives))
+
+		for quantile, allowedError := range c.SummaryObjectives {
+			q, err := strconv.ParseFloat(quantile, 64)
+			if err != nil || q <= 0 || q >= 1 {
+				return fmt.Errorf("summary_objectives: '%s' is not a quantile between 0 and 1", quantile)
+			}
+
+			if allowedError <= 0 || allowedError >= 1 {
+				return fmt.Errorf("summary_objectives: allowed error of quantile %s must be between 0 and 1, is %f", quantile, allowedError)
+			}
+
+			c.CompiledSummaryObjectives[q] = allowedError
+		}
+	}
+
+	if c.SummaryMaxAge != "" {
+		maxAge, err := time.ParseDuration(c.SummaryMaxAge)
+		if err != nil {
+			return fmt.Errorf("summary_max_age: invalid duration '%s': %s", c.SummaryMaxAge, err.Error())
+		}
+
+		if maxAge <= 0 {
+			return fmt.Errorf("summary_max_age: duration must be positive, is '%s'", c.SummaryMaxAge)
+		}
+
+		c.SummaryMaxAgeDuration = maxAge
+	}
+
+	return nil
+}
+
+// BytesFieldOrDefault returns the name of the log field that response sizes
+// are read from. Unless configured otherwise, this is "body_bytes_sent", or
+// "bytes_sent" if only the latter is contained in the log format.
+func (c *NamespaceConfig) BytesFieldOrDefault() string {
+	if c.BytesField != "" {
+		return c.BytesField
+	}
+
+	if !strings.Contains(c.Format, "$body_bytes_sent") && strings.Contains(c.Format, "$bytes_sent") {
+		return "bytes_sent"
+	}
+
+	return "body_bytes_sent"
+}
+
+// SampleWeight returns the number of requests that each log line represents,
+// according to the sample_rate option
+func (c *NamespaceConfig) SampleWeight() float64 {
+	if c.SampleRate <= 0 {
+		return 1
+	}
+
+	return 1 / c.SampleRate
+}
+
+// addGroupLabels adds a (compiled) relabel configuration for each named group
+// of relabel configurations with the group_labels option, which maps the
+// group's value to a label of the same name. Groups may not be named like any
+// other label of the metrics.
+func (c *NamespaceConfig) addGroupLabels() error {
+	var groups []RelabelConfig
+
+	for _, r := range c.RelabelConfigs {
+		for _, name := range r.GroupNames {
+			if existing := c.relabelTarget(name); existing != nil {
+				// added by a previous compilation
+				if existing.SourceValue == r.GroupField(name) {
+					continue
+				}
+
+				return fmt.Errorf("relabel '%s': group '%s' is already used as label", r.TargetLabel, name)
+			}
+
+			if c.isStaticLabel(name) {
+				return fmt.Errorf("relabel '%s': group '%s' is already used as label", r.TargetLabel, name)
+			}
+
+			groups = append(groups, RelabelConfig{TargetLabel: name, SourceValue: r.GroupField(name)})
+		}
+	}
+
+	for i := range groups {
+		if err := groups[i].Compile(); err != nil {
+			return err
+		}
+	}
+
+	c.RelabelConfigs = append(c.RelabelConfigs, groups...)
+	return nil
+}
+
+// isStaticLabel tests if a label name is used by a label that is not added by
+// a relabel configuration (like "method", "status" or the labels option)
+func (c *NamespaceConfig) isStaticLabel(name string) bool {
+	switch name {
+	case "method", "status":
+		return true
+	case "endpoint":
+		if c.EndpointLabel != "" {
+			return true
+		}
+	}
+
+	if _, ok := c.Labels[name]; ok {
+		return true
+	}
+
+	if _, ok := c.InstanceLabels[name]; ok {
+		return true
+	}
+
+	if c.NamespaceLabelName == name {
+		return true
+	}
+
+	for _, g := range c.SourceData.FileGroups {
+		if _, ok := g.Labels[name]; ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// compileRequestPattern compiles the request_pattern option, which may only
+// contain the named groups "method", "uri" and "protocol"
+func (c *NamespaceConfig) compileRequestPattern() error {
+	r, err := regexp.Compile(c.RequestPattern)
+	if err != nil {
+		return fmt.Errorf("request_pattern: could not compile regexp '%s': %s", c.RequestPattern, err.Error())
+	}
+
+	for _, name := range r.SubexpNames() {
+		switch name {
+		case "", "method", "uri", "protocol":
+		default:
+			return fmt.Errorf("request_pattern: unsupported group '%s'; supported groups are 'method', 'uri' and 'protocol'", name)
+		}
+	}
+
+	c.CompiledRequestPattern = r
+	return nil
+}
+
+// ObservesLatencyFor tests if response times of requests with a given status
+// class (like "2xx") should be observed, according to the
+// latency_status_filter option. Without filter, all requests are observed.
+func (c *NamespaceConfig) ObservesLatencyFor(class string) bool {
+	if len(c.LatencyStatusFilterMap) == 0 {
+		return true
+	}
+
+	_, ok := c.LatencyStatusFilterMap[class]
+	return ok
+}
+
+// relabelTarget returns the relabel configuration that adds the given label,
+// or nil if there is none
+func (c *NamespaceConfig) relabelTarget(label string) *RelabelConfig {
+	for i := range c.RelabelConfigs {
+		if c.RelabelConfigs[i].TargetLabel == label && !c.RelabelConfigs[i].FiltersLines() {
+			return &c.RelabelConfigs[i]
+		}
+	}
+
+	return nil
+}
+
+// MetricName returns the name of a metric, with the suffix from the
+// metrics_override option applied (if any). The suffix is inserted before a
+// trailing "_total", so that counters keep their conventional name ending.
+func (c *NamespaceConfig) MetricName(name string) string {
+	if c.MetricsOverride == nil || c.MetricsOverride.Suffix == "" {
+		return name
+	}
+
+	suffix := "_" + strings.TrimPrefix(c.MetricsOverride.Suffix, "_")
+
+	if strings.HasSuffix(name, "_total") {
+		return strings.TrimSuffix(name, "_total") + suffix + "_total"
+	}
+
+	return name + suffix
+}
+
+// OrderLabels builds two lists of label keys and values, ordered by label name.
+// The label names also include all labels of file groups; their values are
+// empty unless set by the labels option.
 func (c *NamespaceConfig) OrderLabels() {
-	keys := make([]string, 0, len(c.Labels))
-	values := make([]string, len(c.Labels))
+	names := make(map[string]struct{}, len(c.Labels))
 
 	for k := range c.Labels {
+		names[k] = struct{}{}
+	}
+
+	for _, g := range c.SourceData.FileGroups {
+		for k := range g.Labels {
+			names[k] = struct{}{}
+		}
+	}
+
+	keys := make([]string, 0, len(names))
+	values := make([]string, len(names))
+
+	for k := range names {
 		keys = append(keys, k)
 	}
 
@@ -120,3 +1101,79 @@ func (c *NamespaceConfig) OrderLabels() {
 	c.OrderedLabelNames = keys
 	c.OrderedLabelValues = values
 }
+
+// FileGroupLabelValues returns the static label values (in the same order as
+// OrderedLabelNames) for the lines of a file group
+func (c *NamespaceConfig) FileGroupLabelValues(g *FileGroupSource) []string {
+	values := make([]string, len(c.OrderedLabelValues))
+
+	for i, k := range c.OrderedLabelNames {
+		if v, ok := g.Labels[k]; ok {
+			values[i] = v
+		} else {
+			values[i] = c.OrderedLabelValues[i]
+		}
+	}
+
+	return values
+}
+
+// Compile fills in default values and validates the size thresholds
+func (c *RequestSizeLatencyConfig) Compile() error {
+	if c.Field == "" {
+		c.Field = "request_length"
+	}
+
+	if c.SmallBelow == nil {
+		smallBelow := 1024.0
+		c.SmallBelow = &smallBelow
+	}
+
+	if c.LargeAbove == nil {
+		largeAbove := 1024.0 * 1024
+		c.LargeAbove = &largeAbove
+	}
+
+	if *c.SmallBelow > *c.LargeAbove {
+		return fmt.Errorf("request_size_latency: small_below (%f) must not be greater than large_above (%f)", *c.SmallBelow, *c.LargeAbove)
+	}
+
+	return nil
+}
+
+// Class maps a request size (in bytes) to one of the size classes "small",
+// "medium" or "large"
+func (c *RequestSizeLatencyConfig) Class(size float64) string {
+	if size < *c.SmallBelow {
+		return "small"
+	}
+
+	if size > *c.LargeAbove {
+		return "large"
+	}
+
+	return "medium"
+}
+
+// Compile builds the lookup table for the upstream allowlist
+func (c *UpstreamLatencyConfig) Compile() {
+	c.UpstreamsMap = make(map[string]struct{}, len(c.Upstreams))
+	for _, u := range c.Upstreams {
+		c.UpstreamsMap[u] = struct{}{}
+	}
+}
+
+// UpstreamLabel maps an upstream address to its label value; addresses that
+// are not in the allowlist are mapped to "other". If no allowlist is
+// configured, all addresses are used as-is.
+func (c *UpstreamLatencyConfig) UpstreamLabel(addr string) string {
+	if len(c.UpstreamsMap) == 0 {
+		return addr
+	}
+
+	if _, ok := c.UpstreamsMap[addr]; ok {
+		return addr
+	}
+
+	return "other"
+}
@@ -1,7 +1,10 @@
 package config
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -16,3 +19,410 @@ func TestSourceFilesAreMappedToNewSourceConfig(t *testing.T) {
 
 	require.Equal(t, FileSource{"bar.log", "baz.log"}, c.SourceData.Files)
 }
+
+func TestRequestSizeLatencyDefaultsAndClasses(t *testing.T) {
+	c := &RequestSizeLatencyConfig{}
+
+	require.Nil(t, c.Compile())
+	require.Equal(t, "request_length", c.Field)
+
+	require.Equal(t, "small", c.Class(100))
+	require.Equal(t, "medium", c.Class(4096))
+	require.Equal(t, "large", c.Class(2*1024*1024))
+}
+
+func TestRequestSizeLatencyRejectsInvertedThresholds(t *testing.T) {
+	smallBelow, largeAbove := 2048.0, 1024.0
+	c := &RequestSizeLatencyConfig{SmallBelow: &smallBelow, LargeAbove: &largeAbove}
+
+	require.NotNil(t, c.Compile())
+}
+
+func TestRequestSizeLatencyKeepsExplicitZeroThresholds(t *testing.T) {
+	zero := 0.0
+	c := &RequestSizeLatencyConfig{SmallBelow: &zero, LargeAbove: &zero}
+
+	require.Nil(t, c.Compile())
+	require.Equal(t, 0.0, *c.SmallBelow)
+	require.Equal(t, 0.0, *c.LargeAbove)
+
+	require.Equal(t, "medium", c.Class(0))
+	require.Equal(t, "large", c.Class(1))
+}
+
+func TestEndpointLabelMustReferToRelabelConfig(t *testing.T) {
+	c := &NamespaceConfig{
+		Name:          "foo",
+		EndpointLabel: "request_uri",
+	}
+
+	require.NotNil(t, c.Compile())
+
+	c.RelabelConfigs = []RelabelConfig{{TargetLabel: "request_uri", SourceValue: "request"}}
+
+	require.Nil(t, c.Compile())
+}
+
+func TestMetricNameAppliesSuffix(t *testing.T) {
+	c := &NamespaceConfig{Name: "foo"}
+
+	require.Equal(t, "http_response_size_bytes", c.MetricName("http_response_size_bytes"))
+
+	c.MetricsOverride = &struct {
+		Prefix string `hcl:"prefix" yaml:"prefix"`
+		Suffix string `hcl:"suffix" yaml:"suffix"`
+	}{Prefix: "foo", Suffix: "v2"}
+
+	require.Equal(t, "http_response_size_bytes_v2", c.MetricName("http_response_size_bytes"))
+	require.Equal(t, "http_response_count_v2_total", c.MetricName("http_response_count_total"))
+}
+
+func TestUpstreamLabelUsesAllowlist(t *testing.T) {
+	c := &UpstreamLatencyConfig{}
+	c.Compile()
+
+	require.Equal(t, "10.0.0.1:80", c.UpstreamLabel("10.0.0.1:80"))
+
+	c.Upstreams = []string{"10.0.0.1:80"}
+	c.Compile()
+
+	require.Equal(t, "10.0.0.1:80", c.UpstreamLabel("10.0.0.1:80"))
+	require.Equal(t, "other", c.UpstreamLabel("10.0.0.2:80"))
+}
+
+func TestLatencyStatusFilter(t *testing.T) {
+	c := &NamespaceConfig{Name: "foo"}
+
+	require.Nil(t, c.Compile())
+	require.True(t, c.ObservesLatencyFor("5xx"))
+
+	c.LatencyStatusFilter = []string{"2xx", "3xx"}
+
+	require.Nil(t, c.Compile())
+	require.True(t, c.ObservesLatencyFor("2xx"))
+	require.False(t, c.ObservesLatencyFor("5xx"))
+	require.False(t, c.ObservesLatencyFor(""))
+
+	c.LatencyStatusFilter = []string{"200"}
+
+	require.NotNil(t, c.Compile())
+}
+
+func TestSNILabelAddsRelabeling(t *testing.T) {
+	c := &NamespaceConfig{
+		Name:     "foo",
+		SNILabel: &SNILabelConfig{ServerNames: []string{"example.com"}},
+	}
+
+	require.Nil(t, c.Compile())
+	require.Nil(t, c.Compile())
+
+	require.Len(t, c.RelabelConfigs, 1)
+	require.Equal(t, "sni", c.RelabelConfigs[0].TargetLabel)
+	require.Equal(t, "ssl_server_name", c.RelabelConfigs[0].SourceValue)
+	require.Equal(t, "none", c.RelabelConfigs[0].EmptyValue)
+	require.True(t, c.RelabelConfigs[0].WhitelistExists)
+}
+
+func TestBytesFieldFallsBackToBytesSent(t *testing.T) {
+	c := &NamespaceConfig{Format: "$remote_addr $status $body_bytes_sent"}
+	require.Equal(t, "body_bytes_sent", c.BytesFieldOrDefault())
+
+	c.Format = "$remote_addr $status $bytes_sent"
+	require.Equal(t, "bytes_sent", c.BytesFieldOrDefault())
+
+	c.Format = "$remote_addr $status"
+	require.Equal(t, "body_bytes_sent", c.BytesFieldOrDefault())
+
+	c.BytesField = "upstream_bytes_received"
+	require.Equal(t, "upstream_bytes_received", c.BytesFieldOrDefault())
+}
+
+func TestActiveWindowIsParsed(t *testing.T) {
+	c := &NamespaceConfig{Name: "foo", ActiveWindow: "5m"}
+
+	require.Nil(t, c.Compile())
+	require.Equal(t, 5*time.Minute, c.ActiveWindowDuration)
+
+	c.ActiveWindow = "five minutes"
+	require.NotNil(t, c.Compile())
+}
+
+func TestInstanceLabelsAreAddedToNamespaceLabels(t *testing.T) {
+	c := &NamespaceConfig{
+		Name:               "foo",
+		NamespaceLabelName: "vhost",
+		InstanceLabels:     map[string]string{"node": "web-1"},
+	}
+
+	require.Nil(t, c.Compile())
+	require.Equal(t, map[string]string{"vhost": "foo", "node": "web-1"}, c.NamespaceLabels)
+}
+
+func TestInstanceLabelDefaultsToHostname(t *testing.T) {
+	hostname, err := os.Hostname()
+	require.Nil(t, err)
+
+	labels, err := (&InstanceLabelConfig{}).Labels()
+	require.Nil(t, err)
+	require.Equal(t, map[string]string{"instance": hostname}, labels)
+
+	labels, err = (&InstanceLabelConfig{Name: "node", Value: "web-1"}).Labels()
+	require.Nil(t, err)
+	require.Equal(t, map[string]string{"node": "web-1"}, labels)
+}
+
+func TestSampleWeight(t *testing.T) {
+	c := &NamespaceConfig{Name: "foo"}
+
+	require.Nil(t, c.Compile())
+	require.Equal(t, 1.0, c.SampleWeight())
+
+	c.SampleRate = 0.25
+
+	require.Nil(t, c.Compile())
+	require.Equal(t, 4.0, c.SampleWeight())
+
+	c.SampleRate = 2
+
+	require.NotNil(t, c.Compile())
+
+	c.SampleRate = 0.0001
+
+	require.NotNil(t, c.Compile())
+}
+
+func TestRequestPatternOnlyAllowsKnownGroups(t *testing.T) {
+	c := &NamespaceConfig{Name: "foo", RequestPattern: `^(?P<method>\S+) (?P<uri>\S+)`}
+	require.Nil(t, c.Compile())
+	require.NotNil(t, c.CompiledRequestPattern)
+
+	c.RequestPattern = `^(?P<verb>\S+)`
+	require.NotNil(t, c.Compile())
+}
+
+func TestFileGroupLabelsAreAddedToStaticLabels(t *testing.T) {
+	c := &NamespaceConfig{
+		Name:   "foo",
+		Labels: map[string]string{"app": "shop"},
+		SourceData: SourceData{
+			FileGroups: []FileGroupSource{
+				{Name: "checkout", Files: FileSource{"checkout.log"}, Labels: map[string]string{"service": "checkout"}},
+				{Name: "search", Files: FileSource{"search.log"}, Labels: map[string]string{"service": "search", "app": "search"}},
+			},
+		},
+	}
+
+	require.Nil(t, c.Compile())
+	require.Equal(t, []string{"app", "service"}, c.OrderedLabelNames)
+	require.Equal(t, []string{"shop", ""}, c.OrderedLabelValues)
+
+	require.Equal(t, []string{"shop", "checkout"}, c.FileGroupLabelValues(&c.SourceData.FileGroups[0]))
+	require.Equal(t, []string{"search", "search"}, c.FileGroupLabelValues(&c.SourceData.FileGroups[1]))
+}
+
+func TestFileGroupLabelsMustNotShadowNamespaceLabel(t *testing.T) {
+	c := &NamespaceConfig{
+		Name:               "foo",
+		NamespaceLabelName: "vhost",
+		SourceData: SourceData{
+			FileGroups: []FileGroupSource{
+				{Name: "checkout", Files: FileSource{"checkout.log"}, Labels: map[string]string{"vhost": "checkout"}},
+			},
+		},
+	}
+
+	require.NotNil(t, c.Compile())
+}
+
+func TestGroupLabelsMustNotShadowOtherLabels(t *testing.T) {
+	for _, group := range []string{"status", "method", "app"} {
+		c := &NamespaceConfig{
+			Name:   "foo",
+			Labels: map[string]string{"app": "shop"},
+			RelabelConfigs: []RelabelConfig{{
+				TargetLabel: "request_uri",
+				SourceValue: "request_uri",
+				Matches:     []RelabelValueMatch{{RegexpString: "^/(?P<" + group + ">[a-z]+)", Replacement: "/$" + group}},
+				GroupLabels: true,
+			}},
+		}
+
+		require.NotNil(t, c.Compile(), group)
+	}
+}
+
+func TestFormatPresetsAreResolved(t *testing.T) {
+	c := &NamespaceConfig{Name: "foo", Format: "apache_combined"}
+
+	require.Nil(t, c.Compile())
+	require.Equal(t, FormatPresets["apache_combined"], c.Format)
+
+	c = &NamespaceConfig{Name: "foo", Format: "$remote_addr $status"}
+
+	require.Nil(t, c.Compile())
+	require.Equal(t, "$remote_addr $status", c.Format)
+}
+
+func TestMetricRelabelConfigsAreValidated(t *testing.T) {
+	c := &NamespaceConfig{Name: "foo", MetricRelabelConfigs: []MetricRelabelConfig{{Action: "rename"}}}
+	require.NotNil(t, c.Compile())
+
+	c = &NamespaceConfig{Name: "foo", MetricRelabelConfigs: []MetricRelabelConfig{{Action: "replace"}}}
+	require.NotNil(t, c.Compile())
+
+	c = &NamespaceConfig{Name: "foo", MetricRelabelConfigs: []MetricRelabelConfig{{Action: "drop", Regex: "("}}}
+	require.NotNil(t, c.Compile())
+}
+
+func TestHistogramBucketsMustBeIncreasing(t *testing.T) {
+	c := &NamespaceConfig{Name: "foo", HistogramBuckets: []float64{.1, 1, 10, 30}}
+	require.Nil(t, c.Compile())
+
+	c = &NamespaceConfig{Name: "foo", HistogramBuckets: []float64{.1, 1, 1, 10}}
+	require.NotNil(t, c.Compile())
+
+	c = &NamespaceConfig{Name: "foo", HistogramBuckets: []float64{10, 1}}
+	require.NotNil(t, c.Compile())
+}
+
+func TestInvalidRelabelConfigIsRejected(t *testing.T) {
+	c := &NamespaceConfig{
+		Name: "foo",
+		RelabelConfigs: []RelabelConfig{
+			{TargetLabel: "request_uri", SourceValue: "request", Matches: []RelabelValueMatch{{RegexpString: "("}}},
+		},
+	}
+
+	require.NotNil(t, c.Compile())
+}
+
+func TestSummaryOptionsAreCompiled(t *testing.T) {
+	c := &NamespaceConfig{Name: "foo"}
+	require.Nil(t, c.Compile())
+	require.Equal(t, map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001}, c.CompiledSummaryObjectives)
+	require.Equal(t, time.Duration(0), c.SummaryMaxAgeDuration)
+
+	c = &NamespaceConfig{
+		Name:              "foo",
+		SummaryObjectives: map[string]float64{"0.5": 0.05, "0.999": 0.0001},
+		SummaryMaxAge:     "5m",
+	}
+	require.Nil(t, c.Compile())
+	require.Equal(t, map[float64]float64{0.5: 0.05, 0.999: 0.0001}, c.CompiledSummaryObjectives)
+	require.Equal(t, 5*time.Minute, c.SummaryMaxAgeDuration)
+
+	c = &NamespaceConfig{Name: "foo", SummaryObjectives: map[string]float64{"p99": 0.001}}
+	require.NotNil(t, c.Compile())
+}
+
+func TestInvalidMissingRequestModeIsRejected(t *testing.T) {
+	c := &NamespaceConfig{Name: "foo", MissingRequest: "skip"}
+	require.Nil(t, c.Compile())
+
+	c = &NamespaceConfig{Name: "foo", MissingRequest: "ignore"}
+	require.NotNil(t, c.Compile())
+}
+
+func TestSyslogSourceListensOnAllAddresses(t *testing.T) {
+	s := &SyslogSource{ListenAddress: "udp://127.0.0.1:5531", ListenAddresses: []string{"tcp://127.0.0.1:5531"}}
+	require.Equal(t, []string{"udp://127.0.0.1:5531", "tcp://127.0.0.1:5531"}, s.Addresses())
+
+	c := &NamespaceConfig{Name: "foo", SourceData: SourceData{Syslog: &SyslogSource{Tags: []string{"nginx"}}}}
+	require.NotNil(t, c.Compile())
+}
+
+func TestWatchDirectoryWatchesDirectoriesOfFilePatterns(t *testing.T) {
+	s := &SourceData{Files: FileSource{"/var/log/nginx/access.log", "/var/log/nginx/access.log.*"}}
+	files, directories := s.FilePatterns()
+	require.Equal(t, []string{"/var/log/nginx/access.log", "/var/log/nginx/access.log.*"}, files)
+	require.Empty(t, directories)
+
+	s.WatchDirectory = true
+	files, directories = s.FilePatterns()
+	require.Equal(t, []string{"/var/log/nginx/access.log"}, files)
+	require.Equal(t, []DirectorySource{{Path: "/var/log/nginx", Pattern: "access.log.*"}}, directories)
+
+	c := &NamespaceConfig{Name: "foo", SourceData: SourceData{Files: FileSource{"/var/log/*/access.log"}, WatchDirectory: true}}
+	require.NotNil(t, c.Compile())
+}
+
+func TestBackslashesAreOnlyGlobMetaCharactersWithoutWindowsPaths(t *testing.T) {
+	require.True(t, isFilePattern("/var/log/nginx/*.log"))
+	require.False(t, isFilePattern("/var/log/nginx/access.log"))
+
+	// on Windows, backslashes separate the directories of paths
+	require.Equal(t, filepath.Separator != '\\', isFilePattern(`C:\nginx\logs\access.log`))
+}
+
+func TestReadFromSavedRequiresPositionsFile(t *testing.T) {
+	c := &NamespaceConfig{Name: "foo", SourceData: SourceData{ReadFrom: "saved"}}
+	require.NotNil(t, c.Compile())
+
+	c = &NamespaceConfig{Name: "foo", SourceData: SourceData{ReadFrom: "saved", PositionsFile: "/var/lib/exporter/positions.json"}}
+	require.Nil(t, c.Compile())
+
+	c = &NamespaceConfig{Name: "foo", SourceData: SourceData{ReadFrom: "start"}}
+	require.NotNil(t, c.Compile())
+}
+
+func TestRelabelActionsRequireRegex(t *testing.T) {
+	c := &NamespaceConfig{Name: "foo", RelabelConfigs: []RelabelConfig{{SourceValue: "request_uri", Action: "drop"}}}
+	require.NotNil(t, c.Compile())
+
+	c = &NamespaceConfig{Name: "foo", RelabelConfigs: []RelabelConfig{{SourceValue: "request_uri", Action: "ignore", Regex: "/healthz"}}}
+	require.NotNil(t, c.Compile())
+
+	c = &NamespaceConfig{Name: "foo", RelabelConfigs: []RelabelConfig{{SourceValue: "request_uri", Action: "drop", Regex: "/healthz"}}}
+	require.Nil(t, c.Compile())
+	require.True(t, c.RelabelConfigs[0].FiltersLines())
+
+	// filters add no label, so their target label is not sanitized
+	require.Equal(t, "", c.RelabelConfigs[0].TargetLabel)
+}
+
+func TestRelabelFiltersDoNotShadowLabels(t *testing.T) {
+	c := &NamespaceConfig{
+		Name:             "foo",
+		StatusClassLabel: true,
+		RelabelConfigs:   []RelabelConfig{{TargetLabel: "status_class", SourceValue: "status", Action: "keep", Regex: "2.."}},
+	}
+	require.Nil(t, c.Compile())
+
+	target := c.relabelTarget("status_class")
+	require.NotNil(t, target)
+	require.False(t, target.FiltersLines())
+}
+
+func TestTailOptionsDefaultToPollingAndReopening(t *testing.T) {
+	var c *TailConfig
+	require.True(t, c.PollEnabled())
+	require.True(t, c.ReOpenEnabled())
+
+	disabled := false
+	c = &TailConfig{Poll: &disabled}
+	require.False(t, c.PollEnabled())
+	require.True(t, c.ReOpenEnabled())
+}
+
+func TestTailPollIntervalRequiresPolling(t *testing.T) {
+	disabled := false
+
+	c := &NamespaceConfig{Name: "foo", Tail: &TailConfig{PollInterval: "1s"}}
+	require.Nil(t, c.Compile())
+	require.Equal(t, time.Second, c.Tail.PollIntervalDuration)
+
+	c = &NamespaceConfig{Name: "foo", Tail: &TailConfig{PollInterval: "1s", Poll: &disabled}}
+	require.NotNil(t, c.Compile())
+
+	c = &NamespaceConfig{Name: "foo", Tail: &TailConfig{PollInterval: "0s"}}
+	require.NotNil(t, c.Compile())
+}
+
+func TestCompatNamesMustBeValidMetricNames(t *testing.T) {
+	c := &NamespaceConfig{Name: "foo", Compat: map[string]string{"legacy_requests": "http_response_count_total"}}
+	require.Nil(t, c.Compile())
+
+	c = &NamespaceConfig{Name: "foo", Compat: map[string]string{"legacy-requests": "http_response_count_total"}}
+	require.EqualError(t, c.Compile(), "compat: 'legacy-requests' is not a valid metric name")
+}
@@ -14,6 +14,35 @@ type RelabelConfig struct {
 	Matches     []RelabelValueMatch `hcl:"match"`
 	Split       int                 `hcl:"split"`
 
+	PathSegments int                 `hcl:"path_segments" yaml:"path_segments"`
+	Replacements []RelabelValueMatch `hcl:"replace" yaml:"replace"`
+	DisableLabel bool                `hcl:"disable_label" yaml:"disable_label"`
+
+	// Action is either "replace" (the default), which maps the source value
+	// to the target label, or "keep" or "drop", which add no label, but only
+	// keep (or drop) the log lines whose source value matches Regex. The
+	// target label is not used by the latter (and may be empty).
+	Action        string `hcl:"action" yaml:"action"`
+	Regex         string `hcl:"regex" yaml:"regex"`
+	CompiledRegex *regexp.Regexp
+
+	// GroupLabels enables exporting the named groups of the match statements
+	// as labels of their own. GroupNames contains the names of all groups
+	// of all statements, in the order of their first occurrence.
+	GroupLabels bool `hcl:"group_labels" yaml:"group_labels"`
+	GroupNames  []string
+
+	// EmptyValue is used as label value when the source value is empty (or
+	// "-", which is what NGINX logs for empty variables).
+	EmptyValue string
+
+	// Uppercase converts the source value to upper case before it is mapped.
+	Uppercase bool
+
+	// OtherValue is used as label value for source values that are not in
+	// the whitelist; if empty, "other" is used.
+	OtherValue string
+
 	WhitelistExists bool
 	WhitelistMap    map[string]interface{}
 }
@@ -35,14 +64,90 @@ func (c *RelabelConfig) Compile() error {
 		c.WhitelistMap[c.Whitelist[i]] = nil
 	}
 
-	for i := range c.Matches {
-		if c.Matches[i].RegexpString != "" {
-			r, err := regexp.Compile(c.Matches[i].RegexpString)
+	switch c.Action {
+	case "", "replace":
+	case "keep", "drop":
+		if c.Regex == "" {
+			return fmt.Errorf("relabel: action '%s' requires a regex", c.Action)
+		}
+
+		r, err := regexp.Compile("^(?:" + c.Regex + ")$")
+		if err != nil {
+			return fmt.Errorf("relabel: could not compile regex '%s': %s", c.Regex, err.Error())
+		}
+
+		c.CompiledRegex = r
+	default:
+		return fmt.Errorf("relabel: action must be 'replace', 'keep' or 'drop', is '%s'", c.Action)
+	}
+
+	if err := compileValueMatches(c.Matches); err != nil {
+		return err
+	}
+
+	c.GroupNames = nil
+	if c.GroupLabels {
+		c.GroupNames = groupNames(c.Matches)
+	}
+
+	return compileValueMatches(c.Replacements)
+}
+
+// GroupField returns the name of the (synthetic) field that contains the
+// value of a named group of the match statements
+func (c *RelabelConfig) GroupField(group string) string {
+	return c.TargetLabel + "." + group
+}
+
+// groupNames returns the names of all named groups of compiled match
+// statements, without duplicates
+func groupNames(matches []RelabelValueMatch) []string {
+	var names []string
+	found := make(map[string]struct{})
+
+	for i := range matches {
+		if matches[i].CompiledRegexp == nil {
+			continue
+		}
+
+		for _, name := range matches[i].CompiledRegexp.SubexpNames() {
+			if _, ok := found[name]; ok || name == "" {
+				continue
+			}
+
+			found[name] = struct{}{}
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+// OtherValueOrDefault returns the label value of source values that are not
+// in the whitelist
+func (c *RelabelConfig) OtherValueOrDefault() string {
+	if c.OtherValue != "" {
+		return c.OtherValue
+	}
+
+	return "other"
+}
+
+// FiltersLines returns true if the configuration keeps or drops log lines,
+// instead of adding a label
+func (c *RelabelConfig) FiltersLines() bool {
+	return c.Action == "keep" || c.Action == "drop"
+}
+
+func compileValueMatches(matches []RelabelValueMatch) error {
+	for i := range matches {
+		if matches[i].RegexpString != "" {
+			r, err := regexp.Compile(matches[i].RegexpString)
 			if err != nil {
-				return fmt.Errorf("could not compile regexp '%s': %s", c.Matches[i].RegexpString, err.Error())
+				return fmt.Errorf("could not compile regexp '%s': %s", matches[i].RegexpString, err.Error())
 			}
 
-			c.Matches[i].CompiledRegexp = r
+			matches[i].CompiledRegexp = r
 		}
 	}
 
@@ -1,5 +1,16 @@
 package config
 
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/logging"
+	"golang.org/x/crypto/bcrypt"
+)
+
 // StartupFlags is a struct containing options that can be passed via the
 // command line
 type StartupFlags struct {
@@ -13,14 +24,52 @@ type StartupFlags struct {
 
 	CPUProfile string
 	MemProfile string
+
+	DisableGoCollector      bool
+	DisableProcessCollector bool
+
+	CheckConfig bool
+	OneShot     bool
 }
 
 // Config models the application's configuration
 type Config struct {
 	Listen                     ListenConfig
 	Consul                     ConsulConfig
-	Namespaces                 []NamespaceConfig `hcl:"namespace"`
-	EnableExperimentalFeatures bool              `hcl:"enable_experimental" yaml:"enable_experimental"`
+	Etcd                       EtcdConfig
+	Kubernetes                 KubernetesConfig
+	Namespaces                 []NamespaceConfig    `hcl:"namespace"`
+	WorkerPool                 *WorkerPoolConfig    `hcl:"worker_pool" yaml:"worker_pool"`
+	FileExport                 *FileExportConfig    `hcl:"file_sd" yaml:"file_sd"`
+	InstanceLabel              *InstanceLabelConfig `hcl:"instance_label" yaml:"instance_label"`
+	DebugLines                 *DebugLinesConfig    `hcl:"debug_lines" yaml:"debug_lines"`
+	Pushgateway                *PushgatewayConfig   `hcl:"pushgateway" yaml:"pushgateway"`
+	StatsD                     *StatsDConfig        `hcl:"statsd" yaml:"statsd"`
+	OTLP                       *OTLPConfig          `hcl:"otlp" yaml:"otlp"`
+	EnableExperimentalFeatures bool                 `hcl:"enable_experimental" yaml:"enable_experimental"`
+
+	// OneShot makes the exporter read all log sources once from their
+	// beginning up to their end (instead of following them), and exit
+	// afterwards.
+	OneShot bool `hcl:"one_shot" yaml:"one_shot"`
+
+	// DrainPeriod is the time that log lines are still processed for when the
+	// exporter is stopped (or, in one-shot mode, has read all log sources),
+	// before the metrics are flushed for the last time (like the final write
+	// of the file_sd file, or the final push to the Pushgateway).
+	DrainPeriod string `hcl:"drain_period" yaml:"drain_period"`
+
+	// EmptyNamespaces describes what happens if no namespaces are configured;
+	// either "error" (refuse to start, the default) or "warn" (start with a
+	// warning, but never report being ready).
+	EmptyNamespaces string `hcl:"empty_namespaces" yaml:"empty_namespaces"`
+
+	// LogFormat is the format of the exporter's own log messages; either
+	// "text" (the default), "json" or "logfmt". LogLevel is the minimum
+	// level of the messages that are logged; either "info" (the default),
+	// "warn" or "error".
+	LogFormat string `hcl:"log_format" yaml:"log_format"`
+	LogLevel  string `hcl:"log_level" yaml:"log_level"`
 
 	// In YAML, the EnableExperimentalFeatures property was originally set by the
 	// "enableexperimentalfeatures" property (although documented as "enable_experimental").
@@ -28,11 +77,262 @@ type Config struct {
 	EnableExperimentalFeaturesOld bool `yaml:"enableexperimentalfeatures"`
 }
 
+// UsesExemplars returns true if any namespace attaches exemplars to its
+// latency histograms (see NamespaceConfig.ExemplarField)
+func (c *Config) UsesExemplars() bool {
+	for i := range c.Namespaces {
+		if c.Namespaces[i].ExemplarField != "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// DrainPeriodOrDefault returns the configured drain period, or zero (meaning
+// that the metrics are flushed immediately when the exporter is stopped) if
+// no drain period was configured.
+func (c *Config) DrainPeriodOrDefault() (time.Duration, error) {
+	if c.DrainPeriod == "" {
+		return 0, nil
+	}
+
+	period, err := time.ParseDuration(c.DrainPeriod)
+	if err != nil {
+		return 0, fmt.Errorf("invalid drain_period '%s': %s", c.DrainPeriod, err.Error())
+	}
+
+	if period < 0 {
+		return 0, fmt.Errorf("drain_period must not be negative, is '%s'", c.DrainPeriod)
+	}
+
+	return period, nil
+}
+
+// PollInterval returns the interval in which log files are polled for
+// changes (see TailConfig), or zero if none is configured. Since the interval
+// applies to all namespaces, it is an error if namespaces configure
+// different intervals.
+func (c *Config) PollInterval() (time.Duration, error) {
+	var interval time.Duration
+
+	for i := range c.Namespaces {
+		t := c.Namespaces[i].Tail
+		if t == nil || t.PollInterval == "" {
+			continue
+		}
+
+		d, err := time.ParseDuration(t.PollInterval)
+		if err != nil {
+			return 0, fmt.Errorf("namespace %s: tail: invalid poll_interval '%s': %s", c.Namespaces[i].Name, t.PollInterval, err.Error())
+		}
+
+		if interval != 0 && d != interval {
+			return 0, fmt.Errorf("tail: poll_interval must be the same for all namespaces, but both %s and %s are configured", interval, d)
+		}
+
+		interval = d
+	}
+
+	return interval, nil
+}
+
 // ListenConfig is a struct describing the built-in webserver configuration
 type ListenConfig struct {
-	Port            int
-	Address         string
-	MetricsEndpoint string `hcl:"metrics_endpoint" yaml:"metrics_endpoint"`
+	Port                 int
+	Address              string
+	MetricsEndpoint      string `hcl:"metrics_endpoint" yaml:"metrics_endpoint"`
+	MaxConcurrentScrapes int    `hcl:"max_concurrent_scrapes" yaml:"max_concurrent_scrapes"`
+	CertFile             string `hcl:"cert_file" yaml:"cert_file"`
+	KeyFile              string `hcl:"key_file" yaml:"key_file"`
+	ClientCAFile         string `hcl:"client_ca_file" yaml:"client_ca_file"`
+
+	BasicAuth *BasicAuthConfig `hcl:"basic_auth" yaml:"basic_auth"`
+}
+
+// BasicAuthConfig describes the credentials that are required for scraping
+// the metrics endpoint
+type BasicAuthConfig struct {
+	Username string `hcl:"username" yaml:"username"`
+
+	// PasswordHash is the bcrypt hash of the password
+	PasswordHash string `hcl:"password_hash" yaml:"password_hash"`
+}
+
+// WorkerPoolConfig describes a pool of goroutines that is shared by all
+// namespaces (or used by a single one) for processing log lines
+type WorkerPoolConfig struct {
+	Size      int `hcl:"size" yaml:"size"`
+	QueueSize int `hcl:"queue_size" yaml:"queue_size"`
+
+	// DropWhenFull makes the pool drop lines when its queue is full, instead
+	// of pausing reading from the log sources; this is only supported for
+	// the worker pools of namespaces.
+	DropWhenFull bool `hcl:"drop_when_full" yaml:"drop_when_full"`
+}
+
+// FileExportConfig describes a file that the current metrics should
+// periodically be written to (in the Prometheus text format)
+type FileExportConfig struct {
+	Path     string `hcl:"path" yaml:"path"`
+	Interval string `hcl:"interval" yaml:"interval"`
+}
+
+// IntervalOrDefault returns the configured export interval, or a default
+// value of 15 seconds if no interval was configured.
+func (c *FileExportConfig) IntervalOrDefault() (time.Duration, error) {
+	if c.Interval == "" {
+		return 15 * time.Second, nil
+	}
+
+	interval, err := time.ParseDuration(c.Interval)
+	if err != nil {
+		return 0, fmt.Errorf("file_sd: invalid interval '%s': %s", c.Interval, err.Error())
+	}
+
+	if interval <= 0 {
+		return 0, fmt.Errorf("file_sd: interval must be positive, is '%s'", c.Interval)
+	}
+
+	return interval, nil
+}
+
+// PushgatewayConfig describes a Prometheus Pushgateway that the current
+// metrics should periodically be pushed to
+type PushgatewayConfig struct {
+	URL      string `hcl:"url" yaml:"url"`
+	Job      string `hcl:"job" yaml:"job"`
+	Interval string `hcl:"interval" yaml:"interval"`
+
+	// DisableHTTP disables the HTTP server, so that the metrics are only
+	// pushed to the Pushgateway.
+	DisableHTTP bool `hcl:"disable_http" yaml:"disable_http"`
+}
+
+// JobOrDefault returns the configured job name, or "nginxlog_exporter" if no
+// job name was configured.
+func (c *PushgatewayConfig) JobOrDefault() string {
+	if c.Job == "" {
+		return "nginxlog_exporter"
+	}
+
+	return c.Job
+}
+
+// IntervalOrDefault returns the configured push interval, or a default value
+// of 15 seconds if no interval was configured.
+func (c *PushgatewayConfig) IntervalOrDefault() (time.Duration, error) {
+	if c.Interval == "" {
+		return 15 * time.Second, nil
+	}
+
+	interval, err := time.ParseDuration(c.Interval)
+	if err != nil {
+		return 0, fmt.Errorf("pushgateway: invalid interval '%s': %s", c.Interval, err.Error())
+	}
+
+	if interval <= 0 {
+		return 0, fmt.Errorf("pushgateway: interval must be positive, is '%s'", c.Interval)
+	}
+
+	return interval, nil
+}
+
+// StatsDConfig describes a StatsD server that the metrics of every log line
+// should be sent to
+type StatsDConfig struct {
+	Address string `hcl:"address" yaml:"address"`
+
+	// Prefix is prepended (separated by a dot) to the names of all metrics
+	Prefix string `hcl:"prefix" yaml:"prefix"`
+
+	// Protocol is either "udp" (the default) or "tcp"
+	Protocol string `hcl:"protocol" yaml:"protocol"`
+
+	// Tagging describes how the labels of the metrics are sent; either ""
+	// (not at all, since plain StatsD does not support tags) or "dogstatsd"
+	// (as DogStatsD tags)
+	Tagging string `hcl:"tagging" yaml:"tagging"`
+
+	// DisableHTTP disables the HTTP server, so that the metrics are only
+	// sent to the StatsD server.
+	DisableHTTP bool `hcl:"disable_http" yaml:"disable_http"`
+}
+
+// ProtocolOrDefault returns the configured protocol, or "udp" if no protocol
+// was configured.
+func (c *StatsDConfig) ProtocolOrDefault() string {
+	if c.Protocol == "" {
+		return "udp"
+	}
+
+	return c.Protocol
+}
+
+// OTLPConfig describes an OpenTelemetry collector that the metrics should
+// periodically be exported to (via OTLP over HTTP)
+type OTLPConfig struct {
+	// Endpoint is the host and port of the collector, like "localhost:4318"
+	Endpoint string `hcl:"endpoint" yaml:"endpoint"`
+	Interval string `hcl:"interval" yaml:"interval"`
+
+	// Insecure disables TLS for the connection to the collector
+	Insecure bool `hcl:"insecure" yaml:"insecure"`
+}
+
+// IntervalOrDefault returns the configured export interval, or a default
+// value of 15 seconds if no interval was configured.
+func (c *OTLPConfig) IntervalOrDefault() (time.Duration, error) {
+	if c.Interval == "" {
+		return 15 * time.Second, nil
+	}
+
+	interval, err := time.ParseDuration(c.Interval)
+	if err != nil {
+		return 0, fmt.Errorf("otlp: invalid interval '%s': %s", c.Interval, err.Error())
+	}
+
+	if interval <= 0 {
+		return 0, fmt.Errorf("otlp: interval must be positive, is '%s'", c.Interval)
+	}
+
+	return interval, nil
+}
+
+// InstanceLabelConfig describes a label identifying the exporter instance that
+// is added to all metrics
+type InstanceLabelConfig struct {
+	Name  string `hcl:"name" yaml:"name"`
+	Value string `hcl:"value" yaml:"value"`
+}
+
+// Labels returns the instance label as a set of constant labels. The label
+// name defaults to "instance", and its value to the host name.
+func (c *InstanceLabelConfig) Labels() (map[string]string, error) {
+	name := c.Name
+	if name == "" {
+		name = "instance"
+	}
+
+	value := c.Value
+	if value == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("instance_label: could not determine host name: %s", err.Error())
+		}
+
+		value = hostname
+	}
+
+	return map[string]string{sanitizeLabelNameWithWarning(name): value}, nil
+}
+
+// DebugLinesConfig describes how many of the most recent log lines of each
+// namespace are retained for debugging, and the token that is required for
+// retrieving them (none if empty)
+type DebugLinesConfig struct {
+	Size  int    `hcl:"size" yaml:"size"`
+	Token string `hcl:"token" yaml:"token"`
 }
 
 // ConsulConfig describes the connection to a Consul server that the exporter should
@@ -44,6 +344,65 @@ type ConsulConfig struct {
 	Scheme     string
 	Token      string
 	Service    ConsulServiceConfig
+	Check      *ConsulCheckConfig `hcl:"check" yaml:"check"`
+}
+
+// ConsulCheckConfig describes the health check that Consul should use for
+// checking the exporter's readiness endpoint. All durations are given in the
+// Consul duration format (like "10s").
+type ConsulCheckConfig struct {
+	Interval                       string `hcl:"interval" yaml:"interval"`
+	Timeout                        string `hcl:"timeout" yaml:"timeout"`
+	DeregisterCriticalServiceAfter string `hcl:"deregister_critical_service_after" yaml:"deregister_critical_service_after"`
+}
+
+// EtcdConfig describes the etcd cluster that the exporter should register
+// itself at. The service is written to the key "<key_prefix>/<name>/<id>",
+// with a lease of the given TTL (in the Go duration format, like "30s").
+type EtcdConfig struct {
+	Enable    bool
+	Endpoints []string
+	KeyPrefix string `hcl:"key_prefix" yaml:"key_prefix"`
+	LeaseTTL  string `hcl:"lease_ttl" yaml:"lease_ttl"`
+	Service   EtcdServiceConfig
+}
+
+// EtcdServiceConfig describes the service that the exporter should register
+// in etcd
+type EtcdServiceConfig struct {
+	ID      string
+	Name    string
+	Address string
+	Tags    []string
+}
+
+// LeaseTTLOrDefault returns the configured lease TTL, or a default value of
+// 30 seconds if no TTL was configured.
+func (c *EtcdConfig) LeaseTTLOrDefault() (time.Duration, error) {
+	if c.LeaseTTL == "" {
+		return 30 * time.Second, nil
+	}
+
+	ttl, err := time.ParseDuration(c.LeaseTTL)
+	if err != nil {
+		return 0, fmt.Errorf("etcd: invalid lease_ttl '%s': %s", c.LeaseTTL, err.Error())
+	}
+
+	if ttl < time.Second {
+		return 0, fmt.Errorf("etcd: lease_ttl must be at least one second, is '%s'", c.LeaseTTL)
+	}
+
+	return ttl, nil
+}
+
+// KubernetesConfig describes how the exporter should announce itself to
+// Prometheus' Kubernetes service discovery when running in a cluster. The
+// namespace and pod default to those of the exporter's own pod.
+type KubernetesConfig struct {
+	Enable    bool
+	Namespace string
+	Pod       string
+	Labels    map[string]string
 }
 
 // ConsulServiceConfig describes the Consul service that the exporter should use
@@ -70,6 +429,141 @@ func (c *Config) StabilityWarnings() error {
 	return nil
 }
 
+// Validate tests the configuration for mistakes that are not caught while
+// loading it, like a configuration file that contains no namespaces at all
+func (c *Config) Validate() error {
+	switch c.EmptyNamespaces {
+	case "", "error", "warn":
+	default:
+		return fmt.Errorf("empty_namespaces: must be 'error' or 'warn', is '%s'", c.EmptyNamespaces)
+	}
+
+	if _, err := logging.ParseFormat(c.LogFormat); err != nil {
+		return fmt.Errorf("log_format: %s", err.Error())
+	}
+
+	if _, err := logging.ParseLevel(c.LogLevel); err != nil {
+		return fmt.Errorf("log_level: %s", err.Error())
+	}
+
+	if len(c.Namespaces) == 0 && c.EmptyNamespaces != "warn" {
+		return errors.New("no namespaces are configured")
+	}
+
+	stdinSources := 0
+	for i := range c.Namespaces {
+		stdinSources += c.Namespaces[i].SourceData.stdinSources()
+	}
+
+	if stdinSources > 1 {
+		return fmt.Errorf("the standard input ('%s') can only be used as source once, but is used %d times", StdinFilename, stdinSources)
+	}
+
+	if c.WorkerPool != nil && c.WorkerPool.DropWhenFull {
+		return errors.New("worker_pool: drop_when_full is only supported for the worker pools of namespaces")
+	}
+
+	registrations := 0
+	for _, enabled := range []bool{c.Consul.Enable, c.Etcd.Enable, c.Kubernetes.Enable} {
+		if enabled {
+			registrations++
+		}
+	}
+
+	if registrations > 1 {
+		return errors.New("only one of consul, etcd and kubernetes can be enabled")
+	}
+
+	if c.Etcd.Enable {
+		if _, err := c.Etcd.LeaseTTLOrDefault(); err != nil {
+			return err
+		}
+	}
+
+	if _, err := c.PollInterval(); err != nil {
+		return err
+	}
+
+	if _, err := c.DrainPeriodOrDefault(); err != nil {
+		return err
+	}
+
+	if c.Pushgateway != nil {
+		if c.Pushgateway.URL == "" {
+			return errors.New("pushgateway: url must be set")
+		}
+
+		if _, err := c.Pushgateway.IntervalOrDefault(); err != nil {
+			return err
+		}
+	}
+
+	if c.StatsD != nil {
+		if c.StatsD.Address == "" {
+			return errors.New("statsd: address must be set")
+		}
+
+		switch c.StatsD.Protocol {
+		case "", "udp", "tcp":
+		default:
+			return fmt.Errorf("statsd: protocol must be 'udp' or 'tcp', is '%s'", c.StatsD.Protocol)
+		}
+
+		switch c.StatsD.Tagging {
+		case "", "dogstatsd":
+		default:
+			return fmt.Errorf("statsd: tagging must be 'dogstatsd', is '%s'", c.StatsD.Tagging)
+		}
+	}
+
+	if c.OTLP != nil {
+		if c.OTLP.Endpoint == "" {
+			return errors.New("otlp: endpoint must be set")
+		}
+
+		if _, err := c.OTLP.IntervalOrDefault(); err != nil {
+			return err
+		}
+	}
+
+	if c.OneShot {
+		for i := range c.Namespaces {
+			if err := c.Namespaces[i].SourceData.validateOneShot(); err != nil {
+				return fmt.Errorf("one_shot: namespace %s: %s", c.Namespaces[i].Name, err.Error())
+			}
+		}
+	}
+
+	if e := c.Listen.MetricsEndpoint; e != "" && !strings.HasPrefix(e, "/") {
+		return fmt.Errorf("listen: metrics_endpoint must start with '/', is '%s'", e)
+	}
+
+	if (c.Listen.CertFile == "") != (c.Listen.KeyFile == "") {
+		return errors.New("listen: cert_file and key_file must be set together")
+	}
+
+	if c.Listen.ClientCAFile != "" && !c.Listen.TLSEnabled() {
+		return errors.New("listen: client_ca_file requires cert_file and key_file")
+	}
+
+	if a := c.Listen.BasicAuth; a != nil {
+		if a.Username == "" {
+			return errors.New("listen.basic_auth: username must be set")
+		}
+
+		if _, err := bcrypt.Cost([]byte(a.PasswordHash)); err != nil {
+			return fmt.Errorf("listen.basic_auth: invalid password_hash: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// TLSEnabled returns true if the HTTP server should serve HTTPS
+func (l *ListenConfig) TLSEnabled() bool {
+	return l.CertFile != "" && l.KeyFile != ""
+}
+
 // MetricsEndpointOrDefault returns the configured metrics endpoint or the
 // default value if no configuration was provided.
 func (l *ListenConfig) MetricsEndpointOrDefault() string {
@@ -78,4 +572,4 @@ func (l *ListenConfig) MetricsEndpointOrDefault() string {
 	}
 
 	return l.MetricsEndpoint
-}
\ No newline at end of file
+}
@@ -0,0 +1,93 @@
+/*
+ * Copyright 2019 Martin Helmich <martin@helmich.me>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"sync"
+)
+
+// debugLine is a raw log line retained for debugging, along with whether it
+// could be parsed
+type debugLine struct {
+	Line   string `json:"line"`
+	Parsed bool   `json:"parsed"`
+}
+
+// lineRing retains the most recent log lines of a namespace in a ring
+// buffer of a fixed size
+type lineRing struct {
+	mutex sync.Mutex
+	lines []debugLine
+	next  int
+	full  bool
+}
+
+func newLineRing(size int) *lineRing {
+	return &lineRing{lines: make([]debugLine, size)}
+}
+
+func (r *lineRing) add(line string, parsed bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.lines[r.next] = debugLine{Line: line, Parsed: parsed}
+	r.next = (r.next + 1) % len(r.lines)
+
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// snapshot returns a copy of the retained lines, oldest first
+func (r *lineRing) snapshot() []debugLine {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if !r.full {
+		return append([]debugLine{}, r.lines[:r.next]...)
+	}
+
+	return append(append([]debugLine{}, r.lines[r.next:]...), r.lines[:r.next]...)
+}
+
+// debugLinesHandler serves the retained lines of the namespace given by the
+// "namespace" query parameter as JSON, as returned by rings. If token is not
+// empty, requests need to present it as bearer token.
+func debugLinesHandler(rings func(namespace string) *lineRing, token string) http.Handler {
+	expected := []byte("Bearer " + token)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		ring := rings(r.URL.Query().Get("namespace"))
+		if ring == nil {
+			http.Error(w, "unknown namespace", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(ring.snapshot()); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLineRingRetainsMostRecentLines(t *testing.T) {
+	t.Parallel()
+
+	r := newLineRing(2)
+	assert.Empty(t, r.snapshot())
+
+	r.add("a", true)
+	assert.Equal(t, []debugLine{{"a", true}}, r.snapshot())
+
+	r.add("b", false)
+	r.add("c", true)
+	assert.Equal(t, []debugLine{{"b", false}, {"c", true}}, r.snapshot())
+}
+
+func TestDebugLinesHandlerRequiresToken(t *testing.T) {
+	t.Parallel()
+
+	ring := newLineRing(10)
+	ring.add("foo", true)
+
+	rings := map[string]*lineRing{"app": ring}
+	h := debugLinesHandler(func(namespace string) *lineRing { return rings[namespace] }, "secret")
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/lines?namespace=app", nil))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	req := httptest.NewRequest("GET", "/debug/lines?namespace=app", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var lines []debugLine
+	require.Nil(t, json.Unmarshal(rec.Body.Bytes(), &lines))
+	assert.Equal(t, []debugLine{{"foo", true}}, lines)
+
+	req = httptest.NewRequest("GET", "/debug/lines?namespace=other", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
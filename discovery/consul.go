@@ -1,15 +1,20 @@
 package discovery
 
 import (
+	"fmt"
+	"net"
+	"strconv"
+
 	"github.com/hashicorp/consul/api"
 	"github.com/martin-helmich/prometheus-nginxlog-exporter/config"
 )
 
 // ConsulRegistrator is a helper struct that handles Consul service registration
 type ConsulRegistrator struct {
-	config    *config.Config
-	client    *api.Client
-	serviceID string
+	config      *config.Config
+	client      *api.Client
+	serviceID   string
+	serviceName string
 }
 
 func getDefault(a string, b string) string {
@@ -37,31 +42,71 @@ func NewConsulRegistrator(cfg *config.Config) (*ConsulRegistrator, error) {
 	serviceID := getDefault(cfg.Consul.Service.ID, name)
 
 	return &ConsulRegistrator{
-		config:    cfg,
-		client:    client,
-		serviceID: serviceID,
+		config:      cfg,
+		client:      client,
+		serviceID:   serviceID,
+		serviceName: name,
 	}, nil
 }
 
-// RegisterConsul registers the exporter instance at Consul
-func (r *ConsulRegistrator) RegisterConsul() error {
-	registration := api.AgentServiceRegistration{
-		ID:      r.serviceID,
-		Address: r.config.Consul.Service.Address,
-		Port:    r.config.Listen.Port,
-		Name:    getDefault(r.config.Consul.Service.Name, "nginx-exporter"),
-		Tags:    r.config.Consul.Service.Tags,
+// serviceCheck extends api.AgentServiceCheck by fields that are not known to
+// the (quite old) version of the Consul API client that is used
+type serviceCheck struct {
+	api.AgentServiceCheck
+	DeregisterCriticalServiceAfter string `json:",omitempty"`
+}
+
+type serviceRegistration struct {
+	api.AgentServiceRegistration
+	Check *serviceCheck `json:",omitempty"`
+}
+
+// Register registers the exporter instance at Consul
+func (r *ConsulRegistrator) Register() error {
+	registration := serviceRegistration{
+		AgentServiceRegistration: api.AgentServiceRegistration{
+			ID:      r.serviceID,
+			Address: r.config.Consul.Service.Address,
+			Port:    r.config.Listen.Port,
+			Name:    r.serviceName,
+			Tags:    r.config.Consul.Service.Tags,
+		},
+		Check: r.check(),
 	}
 
-	err := r.client.Agent().ServiceRegister(&registration)
-	if err != nil {
-		return err
+	// the registration is sent as raw request, since the API client cannot
+	// send the additional check fields
+	_, err := r.client.Raw().Write("/v1/agent/service/register", &registration, nil, nil)
+	return err
+}
+
+// check builds an HTTP health check against the exporter's readiness endpoint,
+// if a check is configured
+func (r *ConsulRegistrator) check() *serviceCheck {
+	cfg := r.config.Consul.Check
+	if cfg == nil {
+		return nil
+	}
+
+	host := r.config.Consul.Service.Address
+	if host == "" {
+		host = r.config.Listen.Address
+	}
+	if host == "" || host == "0.0.0.0" {
+		host = "127.0.0.1"
 	}
 
-	return nil
+	return &serviceCheck{
+		AgentServiceCheck: api.AgentServiceCheck{
+			HTTP:     fmt.Sprintf("http://%s/ready", net.JoinHostPort(host, strconv.Itoa(r.config.Listen.Port))),
+			Interval: getDefault(cfg.Interval, "10s"),
+			Timeout:  getDefault(cfg.Timeout, "5s"),
+		},
+		DeregisterCriticalServiceAfter: cfg.DeregisterCriticalServiceAfter,
+	}
 }
 
-// UnregisterConsul deregisters the exporter from Consul again
-func (r *ConsulRegistrator) UnregisterConsul() error {
+// Unregister deregisters the exporter from Consul again
+func (r *ConsulRegistrator) Unregister() error {
 	return r.client.Agent().ServiceDeregister(r.serviceID)
 }
@@ -0,0 +1,28 @@
+package discovery
+
+import (
+	"testing"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckUsesReadinessEndpoint(t *testing.T) {
+	cfg := config.Config{
+		Listen: config.ListenConfig{Address: "0.0.0.0", Port: 4040},
+		Consul: config.ConsulConfig{
+			Check: &config.ConsulCheckConfig{DeregisterCriticalServiceAfter: "1m"},
+		},
+	}
+
+	r := &ConsulRegistrator{config: &cfg}
+	c := r.check()
+
+	assert.Equal(t, "http://127.0.0.1:4040/ready", c.HTTP)
+	assert.Equal(t, "10s", c.Interval)
+	assert.Equal(t, "5s", c.Timeout)
+	assert.Equal(t, "1m", c.DeregisterCriticalServiceAfter)
+
+	cfg.Consul.Check = nil
+	assert.Nil(t, r.check())
+}
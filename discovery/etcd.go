@@ -0,0 +1,218 @@
+package discovery
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/config"
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/logging"
+)
+
+// EtcdRegistrator is a helper struct that handles service registration in
+// etcd. The service is written as key with a lease, which is kept alive for
+// as long as the exporter is registered. The etcd cluster is accessed via its
+// JSON gateway (the "/v3" HTTP API).
+type EtcdRegistrator struct {
+	config      *config.Config
+	client      *http.Client
+	endpoints   []string
+	key         string
+	ttl         time.Duration
+	serviceID   string
+	serviceName string
+
+	lease int64
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// etcdService is the value of the service key
+type etcdService struct {
+	ID      string   `json:"id"`
+	Name    string   `json:"name"`
+	Address string   `json:"address"`
+	Port    int      `json:"port"`
+	Tags    []string `json:"tags,omitempty"`
+}
+
+type etcdLeaseRequest struct {
+	TTL int64 `json:"TTL,string,omitempty"`
+	ID  int64 `json:"ID,string,omitempty"`
+}
+
+type etcdLeaseResponse struct {
+	TTL int64 `json:"TTL,string"`
+	ID  int64 `json:"ID,string"`
+}
+
+type etcdKeepAliveResponse struct {
+	Result etcdLeaseResponse `json:"result"`
+}
+
+type etcdPutRequest struct {
+	Key   []byte `json:"key"`
+	Value []byte `json:"value"`
+	Lease int64  `json:"lease,string"`
+}
+
+// NewEtcdRegistrator is a constructor function for building a new EtcdRegistrator
+func NewEtcdRegistrator(cfg *config.Config) (*EtcdRegistrator, error) {
+	ttl, err := cfg.Etcd.LeaseTTLOrDefault()
+	if err != nil {
+		return nil, err
+	}
+
+	endpoints := cfg.Etcd.Endpoints
+	if len(endpoints) == 0 {
+		endpoints = []string{"http://localhost:2379"}
+	}
+
+	name := getDefault(cfg.Etcd.Service.Name, "nginx-exporter")
+	serviceID := getDefault(cfg.Etcd.Service.ID, name)
+
+	return &EtcdRegistrator{
+		config:      cfg,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		endpoints:   endpoints,
+		key:         path.Join(getDefault(cfg.Etcd.KeyPrefix, "/services"), name, serviceID),
+		ttl:         ttl,
+		serviceID:   serviceID,
+		serviceName: name,
+	}, nil
+}
+
+// Register writes the service key and keeps its lease alive until
+// Unregister is called
+func (r *EtcdRegistrator) Register() error {
+	if err := r.put(); err != nil {
+		return err
+	}
+
+	r.stop = make(chan struct{})
+	r.done = make(chan struct{})
+
+	go r.keepAlive()
+
+	return nil
+}
+
+// Unregister stops keeping the lease alive and revokes it, which deletes the
+// service key from etcd again
+func (r *EtcdRegistrator) Unregister() error {
+	if r.stop != nil {
+		close(r.stop)
+		<-r.done
+	}
+
+	return r.call("/v3/lease/revoke", etcdLeaseRequest{ID: r.lease}, nil)
+}
+
+// put grants a new lease and writes the service key with it
+func (r *EtcdRegistrator) put() error {
+	lease := etcdLeaseResponse{}
+	if err := r.call("/v3/lease/grant", etcdLeaseRequest{TTL: int64(r.ttl / time.Second)}, &lease); err != nil {
+		return err
+	}
+
+	value, err := json.Marshal(r.service())
+	if err != nil {
+		return err
+	}
+
+	if err := r.call("/v3/kv/put", etcdPutRequest{Key: []byte(r.key), Value: value, Lease: lease.ID}, nil); err != nil {
+		return err
+	}
+
+	r.lease = lease.ID
+	return nil
+}
+
+// keepAlive refreshes the lease three times per TTL; if the lease expired
+// anyway (for example, because etcd could not be reached for too long), the
+// service key is written again with a new lease
+func (r *EtcdRegistrator) keepAlive() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(r.ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+		}
+
+		res := etcdKeepAliveResponse{}
+		if err := r.call("/v3/lease/keepalive", etcdLeaseRequest{ID: r.lease}, &res); err != nil {
+			logging.Error("error while refreshing etcd lease", "error", err)
+			continue
+		}
+
+		if res.Result.TTL > 0 {
+			continue
+		}
+
+		logging.Warn("etcd lease expired; registering service again")
+		if err := r.put(); err != nil {
+			logging.Error("error while registering service in etcd", "error", err)
+		}
+	}
+}
+
+func (r *EtcdRegistrator) service() etcdService {
+	return etcdService{
+		ID:      r.serviceID,
+		Name:    r.serviceName,
+		Address: r.config.Etcd.Service.Address,
+		Port:    r.config.Listen.Port,
+		Tags:    r.config.Etcd.Service.Tags,
+	}
+}
+
+// call sends a request to the etcd JSON gateway, trying all endpoints in
+// order until one of them can be reached
+func (r *EtcdRegistrator) call(method string, req interface{}, res interface{}) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	err = errors.New("no etcd endpoints configured")
+	for _, endpoint := range r.endpoints {
+		var retry bool
+		if retry, err = r.send(strings.TrimRight(endpoint, "/")+method, body, res); !retry {
+			return err
+		}
+	}
+
+	return err
+}
+
+// send sends a single request to an etcd endpoint, and reports whether
+// another endpoint should be tried if it failed
+func (r *EtcdRegistrator) send(url string, body []byte, res interface{}) (bool, error) {
+	response, err := r.client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return true, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(response.Body)
+		return response.StatusCode >= 500, fmt.Errorf("%s: %s: %s", url, response.Status, strings.TrimSpace(string(msg)))
+	}
+
+	if res == nil {
+		return false, nil
+	}
+
+	return false, json.NewDecoder(response.Body).Decode(res)
+}
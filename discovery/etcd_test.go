@@ -0,0 +1,126 @@
+package discovery
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeEtcd implements the parts of the etcd JSON gateway that are used by the
+// EtcdRegistrator
+type fakeEtcd struct {
+	mutex   sync.Mutex
+	leases  map[string]bool
+	nextID  int
+	keys    map[string]string
+	expired bool
+}
+
+func (f *fakeEtcd) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	var req map[string]string
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch r.URL.Path {
+	case "/v3/lease/grant":
+		f.nextID++
+		id := string(rune('0' + f.nextID))
+		f.leases[id] = true
+		json.NewEncoder(w).Encode(map[string]string{"ID": id, "TTL": req["TTL"]})
+	case "/v3/kv/put":
+		if !f.leases[req["lease"]] {
+			http.Error(w, `{"error":"requested lease not found"}`, http.StatusBadRequest)
+			return
+		}
+		f.keys[req["key"]] = req["value"]
+	case "/v3/lease/keepalive":
+		if f.expired {
+			delete(f.leases, req["ID"])
+			f.keys = map[string]string{}
+			f.expired = false
+		}
+		if !f.leases[req["ID"]] {
+			json.NewEncoder(w).Encode(map[string]interface{}{"result": map[string]string{"ID": req["ID"]}})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"result": map[string]string{"ID": req["ID"], "TTL": "1"}})
+	case "/v3/lease/revoke":
+		delete(f.leases, req["ID"])
+		f.keys = map[string]string{}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (f *fakeEtcd) snapshot() (map[string]string, int, int) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	keys := map[string]string{}
+	for k, v := range f.keys {
+		keys[k] = v
+	}
+
+	return keys, len(f.leases), f.nextID
+}
+
+func TestEtcdRegistratorWritesServiceKeyWithLease(t *testing.T) {
+	etcd := &fakeEtcd{leases: map[string]bool{}, keys: map[string]string{}}
+	server := httptest.NewServer(etcd)
+	defer server.Close()
+
+	cfg := config.Config{
+		Listen: config.ListenConfig{Port: 4040},
+		Etcd: config.EtcdConfig{
+			Endpoints: []string{"http://127.0.0.1:1", server.URL},
+			KeyPrefix: "/exporters",
+			LeaseTTL:  "1s",
+			Service:   config.EtcdServiceConfig{ID: "web-1", Name: "nginx", Address: "10.0.0.1"},
+		},
+	}
+
+	r, err := NewEtcdRegistrator(&cfg)
+	require.NoError(t, err)
+	require.NoError(t, r.Register())
+
+	// the gateway sends keys and values base64-encoded
+	keys, leases, _ := etcd.snapshot()
+	assert.Equal(t, 1, leases)
+	require.Contains(t, keys, "L2V4cG9ydGVycy9uZ2lueC93ZWItMQ==")
+	assert.Equal(t, "eyJpZCI6IndlYi0xIiwibmFtZSI6Im5naW54IiwiYWRkcmVzcyI6IjEwLjAuMC4xIiwicG9ydCI6NDA0MH0=", keys["L2V4cG9ydGVycy9uZ2lueC93ZWItMQ=="])
+
+	// an expired lease is replaced by a new one once the keep-alive notices
+	etcd.mutex.Lock()
+	etcd.expired = true
+	etcd.mutex.Unlock()
+
+	assert.Eventually(t, func() bool {
+		keys, leases, granted := etcd.snapshot()
+		return len(keys) == 1 && leases == 1 && granted == 2
+	}, 3*time.Second, 50*time.Millisecond)
+
+	require.NoError(t, r.Unregister())
+
+	keys, leases, _ = etcd.snapshot()
+	assert.Empty(t, keys)
+	assert.Equal(t, 0, leases)
+}
+
+func TestEtcdLeaseTTLMustBeAtLeastOneSecond(t *testing.T) {
+	cfg := config.Config{Etcd: config.EtcdConfig{LeaseTTL: "500ms"}}
+
+	_, err := NewEtcdRegistrator(&cfg)
+	assert.Error(t, err)
+}
@@ -0,0 +1,251 @@
+package discovery
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/config"
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/logging"
+)
+
+// serviceAccountDir is the directory into which Kubernetes mounts the
+// credentials of a pod's service account
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// KubernetesRegistrator is a helper struct that announces the exporter to
+// Prometheus' Kubernetes service discovery by annotating (and labeling) the
+// pod that the exporter runs in
+type KubernetesRegistrator struct {
+	config    *config.Config
+	client    *http.Client
+	apiServer string
+	tokenFile string
+	namespace string
+	pod       string
+
+	// addedAnnotations and addedLabels are the annotations and configured
+	// labels that the pod did not already have when it was registered; only
+	// these are removed again
+	addedAnnotations []string
+	addedLabels      []string
+}
+
+// NewKubernetesRegistrator is a constructor function for building a new
+// KubernetesRegistrator from the in-cluster configuration (the API server
+// address from the environment and the pod's service account credentials)
+func NewKubernetesRegistrator(cfg *config.Config) (*KubernetesRegistrator, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("not running in a Kubernetes cluster (KUBERNETES_SERVICE_HOST or KUBERNETES_SERVICE_PORT not set)")
+	}
+
+	ca, err := ioutil.ReadFile(filepath.Join(serviceAccountDir, "ca.crt"))
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, errors.New("could not parse the service account's CA certificate")
+	}
+
+	namespace := cfg.Kubernetes.Namespace
+	if namespace == "" {
+		ns, err := ioutil.ReadFile(filepath.Join(serviceAccountDir, "namespace"))
+		if err != nil {
+			return nil, err
+		}
+
+		namespace = strings.TrimSpace(string(ns))
+	}
+
+	pod := cfg.Kubernetes.Pod
+	if pod == "" {
+		// the hostname of a pod is its name, unless overridden in the pod spec
+		if pod, err = os.Hostname(); err != nil {
+			return nil, err
+		}
+	}
+
+	return &KubernetesRegistrator{
+		config: cfg,
+		client: &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+		},
+		apiServer: "https://" + net.JoinHostPort(host, port),
+		tokenFile: filepath.Join(serviceAccountDir, "token"),
+		namespace: namespace,
+		pod:       pod,
+	}, nil
+}
+
+// Register adds the "prometheus.io/*" scrape annotations and the
+// configured labels to the exporter's pod. Annotations and labels that the
+// pod already has (for example, from its spec) are left untouched, since
+// they are not owned by the exporter.
+func (r *KubernetesRegistrator) Register() error {
+	existing, err := r.podMetadata()
+	if err != nil {
+		return err
+	}
+
+	annotations, addedAnnotations := withoutExisting(r.annotations(), existing.Annotations, "annotation")
+	labels, addedLabels := withoutExisting(r.config.Kubernetes.Labels, existing.Labels, "label")
+
+	if err := r.patchPod(annotations, labels); err != nil {
+		return err
+	}
+
+	r.addedAnnotations = addedAnnotations
+	r.addedLabels = addedLabels
+	return nil
+}
+
+// withoutExisting returns the values that should be added to the pod (in
+// the form that patchPod expects), and their keys; values whose keys already
+// exist are skipped. kind is used for logging only.
+func withoutExisting(values, existing map[string]string, kind string) (map[string]interface{}, []string) {
+	patch := map[string]interface{}{}
+	added := []string{}
+
+	for k, v := range values {
+		if _, ok := existing[k]; ok {
+			logging.Warn("pod already has "+kind+"; not managing it", kind, k)
+			continue
+		}
+
+		patch[k] = v
+		added = append(added, k)
+	}
+
+	return patch, added
+}
+
+// Unregister removes the annotations and labels that were added by
+// Register from the exporter's pod again
+func (r *KubernetesRegistrator) Unregister() error {
+	annotations := map[string]interface{}{}
+	for _, k := range r.addedAnnotations {
+		annotations[k] = nil
+	}
+
+	labels := map[string]interface{}{}
+	for _, k := range r.addedLabels {
+		labels[k] = nil
+	}
+
+	return r.patchPod(annotations, labels)
+}
+
+// annotations builds the annotations that Prometheus' Kubernetes service
+// discovery is commonly configured to look for
+func (r *KubernetesRegistrator) annotations() map[string]string {
+	annotations := map[string]string{
+		"prometheus.io/scrape": "true",
+		"prometheus.io/port":   strconv.Itoa(r.config.Listen.Port),
+		"prometheus.io/path":   r.config.Listen.MetricsEndpointOrDefault(),
+	}
+
+	if r.config.Listen.CertFile != "" {
+		annotations["prometheus.io/scheme"] = "https"
+	}
+
+	return annotations
+}
+
+// podMetadata contains the annotations and labels of a pod
+type podMetadata struct {
+	Annotations map[string]string `json:"annotations"`
+	Labels      map[string]string `json:"labels"`
+}
+
+// podMetadata reads the annotations and labels that the exporter's pod
+// currently has
+func (r *KubernetesRegistrator) podMetadata() (*podMetadata, error) {
+	res, err := r.request(http.MethodGet, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(res.Body)
+		return nil, fmt.Errorf("could not get pod %s/%s: %s: %s", r.namespace, r.pod, res.Status, strings.TrimSpace(string(msg)))
+	}
+
+	var pod struct {
+		Metadata podMetadata `json:"metadata"`
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(&pod); err != nil {
+		return nil, err
+	}
+
+	return &pod.Metadata, nil
+}
+
+// patchPod applies a JSON merge patch with the given annotations and labels
+// to the exporter's pod; nil values remove the respective key
+func (r *KubernetesRegistrator) patchPod(annotations, labels map[string]interface{}) error {
+	patch := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": annotations,
+			"labels":      labels,
+		},
+	}
+
+	body, err := json.Marshal(patch)
+	if err != nil {
+		return err
+	}
+
+	res, err := r.request(http.MethodPatch, body)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(res.Body)
+		return fmt.Errorf("could not patch pod %s/%s: %s: %s", r.namespace, r.pod, res.Status, strings.TrimSpace(string(msg)))
+	}
+
+	return nil
+}
+
+// request sends a request for the exporter's pod to the Kubernetes API,
+// authenticated with the pod's service account token. A body is sent as a
+// JSON merge patch.
+func (r *KubernetesRegistrator) request(method string, body []byte) (*http.Response, error) {
+	token, err := ioutil.ReadFile(r.tokenFile)
+	if err != nil {
+		return nil, err
+	}
+
+	u := fmt.Sprintf("%s/api/v1/namespaces/%s/pods/%s", r.apiServer, url.PathEscape(r.namespace), url.PathEscape(r.pod))
+	req, err := http.NewRequest(method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/merge-patch+json")
+	}
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+
+	return r.client.Do(req)
+}
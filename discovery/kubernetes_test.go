@@ -0,0 +1,104 @@
+package discovery
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKubernetesRegistratorPatchesPod(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kubernetes")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	tokenFile := filepath.Join(dir, "token")
+	require.NoError(t, ioutil.WriteFile(tokenFile, []byte("secret\n"), 0600))
+
+	var patches []map[string]map[string]map[string]*string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v1/namespaces/web/pods/nginx-0", r.URL.Path)
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+
+		if r.Method == http.MethodGet {
+			w.Write([]byte(`{"metadata": {"annotations": {"prometheus.io/path": "/custom"}, "labels": {"app": "nginx"}}}`))
+			return
+		}
+
+		assert.Equal(t, http.MethodPatch, r.Method)
+		assert.Equal(t, "application/merge-patch+json", r.Header.Get("Content-Type"))
+
+		var patch map[string]map[string]map[string]*string
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&patch))
+		patches = append(patches, patch)
+	}))
+	defer server.Close()
+
+	cfg := config.Config{
+		Listen:     config.ListenConfig{Port: 4040},
+		Kubernetes: config.KubernetesConfig{Labels: map[string]string{"team": "web", "app": "exporter"}},
+	}
+
+	r := &KubernetesRegistrator{
+		config:    &cfg,
+		client:    server.Client(),
+		apiServer: server.URL,
+		tokenFile: tokenFile,
+		namespace: "web",
+		pod:       "nginx-0",
+	}
+
+	require.NoError(t, r.Register())
+	require.NoError(t, r.Unregister())
+	require.Len(t, patches, 2)
+
+	registered := patches[0]["metadata"]
+	assert.Equal(t, "true", *registered["annotations"]["prometheus.io/scrape"])
+	assert.Equal(t, "4040", *registered["annotations"]["prometheus.io/port"])
+	assert.NotContains(t, registered["annotations"], "prometheus.io/path", "existing annotations must not be overwritten")
+	assert.Equal(t, "web", *registered["labels"]["team"])
+	assert.NotContains(t, registered["labels"], "app", "existing labels must not be overwritten")
+
+	unregistered := patches[1]["metadata"]
+	assert.Len(t, unregistered["annotations"], 2)
+	assert.Contains(t, unregistered["annotations"], "prometheus.io/scrape")
+	assert.Nil(t, unregistered["annotations"]["prometheus.io/scrape"])
+	assert.NotContains(t, unregistered["annotations"], "prometheus.io/path", "existing annotations must not be removed")
+	assert.Contains(t, unregistered["labels"], "team")
+	assert.Nil(t, unregistered["labels"]["team"])
+	assert.NotContains(t, unregistered["labels"], "app", "existing labels must not be removed")
+}
+
+func TestKubernetesRegistratorReportsFailedPatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kubernetes")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	tokenFile := filepath.Join(dir, "token")
+	require.NoError(t, ioutil.WriteFile(tokenFile, []byte("secret"), 0600))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "pods is forbidden", http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	r := &KubernetesRegistrator{
+		config:    &config.Config{},
+		client:    server.Client(),
+		apiServer: server.URL,
+		tokenFile: tokenFile,
+		namespace: "web",
+		pod:       "nginx-0",
+	}
+
+	err = r.Register()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "pods is forbidden")
+}
@@ -0,0 +1,11 @@
+package discovery
+
+// Registrator is implemented by all service discovery integrations that the
+// exporter can announce itself at
+type Registrator interface {
+	// Register announces the exporter instance
+	Register() error
+
+	// Unregister removes the exporter instance again
+	Unregister() error
+}
@@ -0,0 +1,95 @@
+/*
+ * Copyright 2019 Martin Helmich <martin@helmich.me>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/logging"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+)
+
+// setupFileExport starts a goroutine that periodically writes the metrics
+// collected by gatherer to a file; the file is written once more when the
+// exporter is stopped.
+func setupFileExport(path string, interval time.Duration, gatherer prometheus.Gatherer, stopChan <-chan bool, stopHandlers *sync.WaitGroup) {
+	logging.Info("writing metrics to file periodically", "file", path, "interval", interval)
+
+	stopHandlers.Add(1)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := writeMetricsFile(path, gatherer); err != nil {
+					logging.Error("error while writing metrics to file", "file", path, "error", err)
+				}
+			case <-stopChan:
+				if err := writeMetricsFile(path, gatherer); err != nil {
+					logging.Error("error while writing metrics to file", "file", path, "error", err)
+				}
+
+				stopHandlers.Done()
+				return
+			}
+		}
+	}()
+}
+
+// writeMetricsFile writes the metrics collected by gatherer to path in the
+// Prometheus text format. The metrics are written to a temporary file in the
+// same directory first, which then replaces path, so that readers never see
+// a partially written file.
+func writeMetricsFile(path string, gatherer prometheus.Gatherer) error {
+	families, gatherErr := gatherer.Gather()
+	if gatherErr != nil && len(families) == 0 {
+		return gatherErr
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tmp.Name())
+
+	enc := expfmt.NewEncoder(tmp, expfmt.FmtText)
+	for _, mf := range families {
+		if err := enc.Encode(mf); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteMetricsFile(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "nginxlog-exporter")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	registry := prometheus.NewRegistry()
+	counter := prometheus.NewCounter(prometheus.CounterOpts{Name: "test_total", Help: "Test counter"})
+	registry.MustRegister(counter)
+	counter.Add(3)
+
+	path := filepath.Join(dir, "metrics.prom")
+	require.Nil(t, writeMetricsFile(path, registry))
+
+	contents, err := ioutil.ReadFile(path)
+	require.Nil(t, err)
+	assert.Contains(t, string(contents), "test_total 3\n")
+
+	files, err := ioutil.ReadDir(dir)
+	require.Nil(t, err)
+	assert.Len(t, files, 1)
+}
+
+func TestFileExportWritesFileWhenStopped(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "nginxlog-exporter")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	registry := prometheus.NewRegistry()
+	counter := prometheus.NewCounter(prometheus.CounterOpts{Name: "test_total", Help: "Test counter"})
+	registry.MustRegister(counter)
+
+	path := filepath.Join(dir, "metrics.prom")
+	stopChan := make(chan bool)
+	stopHandlers := sync.WaitGroup{}
+
+	setupFileExport(path, time.Hour, registry, stopChan, &stopHandlers)
+
+	counter.Add(3)
+	close(stopChan)
+	stopHandlers.Wait()
+
+	contents, err := ioutil.ReadFile(path)
+	require.Nil(t, err)
+	assert.Contains(t, string(contents), "test_total 3\n")
+}
@@ -0,0 +1,79 @@
+/*
+ * Copyright 2019 Martin Helmich <martin@helmich.me>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"sync"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/config"
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/tail"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// followedFilesCollector exports the number of log files of a namespace that
+// are currently followed, which is determined whenever the metrics are
+// collected. Unlike the other metrics of a namespace, it has the same name for
+// all namespaces, so that it can be compared to the expected number of files
+// across all exporters.
+type followedFilesCollector struct {
+	desc *prometheus.Desc
+
+	mutex    sync.Mutex
+	counters []tail.FileCounter
+}
+
+func newFollowedFilesCollector(cfg *config.NamespaceConfig) *followedFilesCollector {
+	return &followedFilesCollector{
+		desc: prometheus.NewDesc(
+			"nginxlog_tailed_files",
+			"Number of log files that are currently followed",
+			nil,
+			prometheus.Labels{"namespace": cfg.Name},
+		),
+	}
+}
+
+// add registers a follower whose files should be counted; other followers
+// (like syslog followers) are ignored
+func (c *followedFilesCollector) add(f tail.Follower) {
+	fc, ok := f.(tail.FileCounter)
+	if !ok {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.counters = append(c.counters, fc)
+}
+
+func (c *followedFilesCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *followedFilesCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mutex.Lock()
+	counters := append([]tail.FileCounter{}, c.counters...)
+	c.mutex.Unlock()
+
+	n := 0
+	for _, fc := range counters {
+		n += fc.FollowedFiles()
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(n))
+}
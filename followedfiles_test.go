@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/config"
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/tail"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type countingFollower struct {
+	tail.Follower
+	files int
+}
+
+func (f *countingFollower) FollowedFiles() int {
+	return f.files
+}
+
+func TestFollowedFilesCollectorSumsFollowers(t *testing.T) {
+	t.Parallel()
+
+	c := newFollowedFilesCollector(&config.NamespaceConfig{Name: "test"})
+	c.add(&countingFollower{files: 1})
+	c.add(&countingFollower{files: 2})
+	c.add(tail.NewReaderFollower(nil))
+
+	assert.Equal(t, 3.0, testutil.ToFloat64(c))
+}
+
+func TestTailErrorHandlerCountsErrors(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.NamespaceConfig{Name: "test"}
+	m, err := NewNSMetrics(&cfg)
+	require.Nil(t, err)
+
+	tailErrorHandler("access.log", &cfg, &m.Metrics)(errors.New("permission denied"))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.tailErrorsTotal))
+}
+
+func TestReopenSourceRetriesUntilOpened(t *testing.T) {
+	t.Parallel()
+
+	attempts := 0
+	var errs []error
+
+	s := source{
+		name: "access.log",
+		open: func() (tail.Follower, error) {
+			if attempts++; attempts < 3 {
+				return nil, errors.New("permission denied")
+			}
+
+			return tail.NewReaderFollower(nil), nil
+		},
+		onError: func(err error) {
+			errs = append(errs, err)
+		},
+	}
+
+	f := reopenSource(context.Background(), s, time.Millisecond, 2*time.Millisecond)
+	assert.NotNil(t, f)
+	assert.Equal(t, 3, attempts)
+	assert.Len(t, errs, 2)
+}
+
+func TestReopenSourceStopsWhenCancelled(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	s := source{
+		name: "access.log",
+		open: func() (tail.Follower, error) {
+			return nil, errors.New("permission denied")
+		},
+		onError: func(error) {},
+	}
+
+	assert.Nil(t, reopenSource(ctx, s, time.Hour, time.Hour))
+}
@@ -0,0 +1,83 @@
+/*
+ * Copyright 2019 Martin Helmich <martin@helmich.me>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"io/ioutil"
+	"net"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/config"
+	"github.com/oschwald/geoip2-golang"
+	"github.com/satyrius/gonx"
+)
+
+// geoIPDatabase looks up the location of IP addresses; it is implemented by
+// a geoip2.Reader
+type geoIPDatabase interface {
+	Country(ip net.IP) (*geoip2.Country, error)
+	City(ip net.IP) (*geoip2.City, error)
+}
+
+// geoIPLookup fills the (synthetic) "geoip_country" and "geoip_city" fields
+// of log lines with the location of their client
+type geoIPLookup struct {
+	db   geoIPDatabase
+	city bool
+}
+
+// newGeoIPLookup opens the MaxMind database of a namespace. The database is
+// read into memory entirely, so that it does not need to be closed when the
+// namespace is stopped.
+func newGeoIPLookup(cfg *config.GeoIPConfig) (*geoIPLookup, error) {
+	contents, err := ioutil.ReadFile(cfg.Database)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := geoip2.FromBytes(contents)
+	if err != nil {
+		return nil, err
+	}
+
+	return &geoIPLookup{db: db, city: cfg.City}, nil
+}
+
+// fill looks up the location of the "remote_addr" field. If it is not a
+// valid IP address or its location is not known, the fields are empty.
+func (g *geoIPLookup) fill(fields gonx.Fields) {
+	fields["geoip_country"] = ""
+	if g.city {
+		fields["geoip_city"] = ""
+	}
+
+	ip := net.ParseIP(fields["remote_addr"])
+	if ip == nil {
+		return
+	}
+
+	if !g.city {
+		if country, err := g.db.Country(ip); err == nil {
+			fields["geoip_country"] = country.Country.IsoCode
+		}
+		return
+	}
+
+	if city, err := g.db.City(ip); err == nil {
+		fields["geoip_country"] = city.Country.IsoCode
+		fields["geoip_city"] = city.City.Names["en"]
+	}
+}
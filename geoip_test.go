@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/config"
+	"github.com/oschwald/geoip2-golang"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeGeoIPDatabase knows the countries of a few IP addresses
+type fakeGeoIPDatabase map[string]string
+
+func (d fakeGeoIPDatabase) City(ip net.IP) (*geoip2.City, error) {
+	country, ok := d[ip.String()]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+
+	c := &geoip2.City{}
+	c.Country.IsoCode = country
+	c.City.Names = map[string]string{"en": "City of " + country}
+
+	return c, nil
+}
+
+func (d fakeGeoIPDatabase) Country(ip net.IP) (*geoip2.Country, error) {
+	city, err := d.City(ip)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &geoip2.Country{}
+	c.Country.IsoCode = city.Country.IsoCode
+
+	return c, nil
+}
+
+func TestProcessLineAddsGeoIPLabels(t *testing.T) {
+	t.Parallel()
+
+	for _, city := range []bool{false, true} {
+		cfg := config.NamespaceConfig{
+			Name:   "test",
+			Format: "$remote_addr $request $status",
+			GeoIP:  &config.GeoIPConfig{Database: "GeoLite2-City.mmdb", Countries: []string{"DE"}, City: city},
+		}
+		require.Nil(t, cfg.Compile())
+
+		m, err := NewNSMetrics(&cfg)
+		require.Nil(t, err)
+
+		p := newLineProcessor(&cfg, &m.Metrics)
+		p.geoIP = &geoIPLookup{db: fakeGeoIPDatabase{"192.0.2.1": "DE", "192.0.2.2": "FR"}, city: city}
+
+		p.processLine("192.0.2.1 GET 200")
+		p.processLine("192.0.2.2 GET 200")
+		p.processLine("192.0.2.3 GET 200")
+
+		if city {
+			assert.Equal(t, 1.0, testutil.ToFloat64(m.countTotal.WithLabelValues("DE", "City of DE", "GET", "200")))
+			assert.Equal(t, 1.0, testutil.ToFloat64(m.countTotal.WithLabelValues("other", "City of FR", "GET", "200")))
+			assert.Equal(t, 1.0, testutil.ToFloat64(m.countTotal.WithLabelValues("unknown", "unknown", "GET", "200")))
+		} else {
+			assert.Equal(t, 1.0, testutil.ToFloat64(m.countTotal.WithLabelValues("DE", "GET", "200")))
+			assert.Equal(t, 1.0, testutil.ToFloat64(m.countTotal.WithLabelValues("other", "GET", "200")))
+			assert.Equal(t, 1.0, testutil.ToFloat64(m.countTotal.WithLabelValues("unknown", "GET", "200")))
+		}
+	}
+}
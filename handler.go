@@ -0,0 +1,108 @@
+/*
+ * Copyright 2019 Martin Helmich <martin@helmich.me>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"crypto/subtle"
+	"html"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/config"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// limitConcurrentRequests wraps a handler so that at most max requests are
+// served at once; any additional requests are answered with a 503 status
+// and counted in the rejected counter.
+func limitConcurrentRequests(next http.Handler, max int, rejected prometheus.Counter) http.Handler {
+	sem := make(chan struct{}, max)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case sem <- struct{}{}:
+			defer func() { <-sem }()
+			next.ServeHTTP(w, r)
+		default:
+			rejected.Inc()
+			http.Error(w, "too many concurrent scrapes", http.StatusServiceUnavailable)
+		}
+	})
+}
+
+// requireBasicAuth wraps a handler so that only requests with the configured
+// credentials are served; all other requests are answered with a 401 status
+func requireBasicAuth(next http.Handler, cfg *config.BasicAuthConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, ok := r.BasicAuth()
+
+		if !ok ||
+			subtle.ConstantTimeCompare([]byte(username), []byte(cfg.Username)) != 1 ||
+			bcrypt.CompareHashAndPassword([]byte(cfg.PasswordHash), []byte(password)) != nil {
+			w.Header().Set("WWW-Authenticate", `Basic realm="metrics"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// rootHandler serves a small HTML page that links to the metrics endpoint;
+// all other paths are answered with a 404 status
+func rootHandler(metricsEndpoint string) http.Handler {
+	page := []byte(`<html>
+<head><title>NGINX log exporter</title></head>
+<body>
+<h1>NGINX log exporter</h1>
+<p><a href="` + html.EscapeString(metricsEndpoint) + `">Metrics</a></p>
+</body>
+</html>
+`)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(page)
+	})
+}
+
+// livenessHandler always answers with a 200 status, so that it reports the
+// exporter as alive as soon as the HTTP server is up
+func livenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok\n"))
+	})
+}
+
+// readinessHandler answers with a 200 status once ready was set to a
+// non-zero value, and with a 503 status before
+func readinessHandler(ready *int32) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(ready) == 0 {
+			http.Error(w, "not ready", http.StatusServiceUnavailable)
+			return
+		}
+
+		w.Write([]byte("ready\n"))
+	})
+}
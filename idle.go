@@ -0,0 +1,148 @@
+/*
+ * Copyright 2019 Martin Helmich <martin@helmich.me>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/logging"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// idleCheckInterval is the interval in which followed files are checked for
+// being idle, and idle files for being written to again
+const idleCheckInterval = 5 * time.Second
+
+// idleTracker keeps track of how many log sources of a namespace are
+// currently idle (see the idle_timeout option), and resets the metrics of the
+// namespace once all of them are, if configured to do so
+type idleTracker struct {
+	namespace string
+	metrics   *Metrics
+	reset     bool
+
+	mutex   sync.Mutex
+	sources int
+	idle    int
+}
+
+// addSource registers another followed log file of the namespace; other
+// sources (like directories or syslog listeners) never become idle, and must
+// not be registered
+func (t *idleTracker) addSource() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.sources++
+}
+
+func (t *idleTracker) onIdle(filename string) func() {
+	return func() {
+		logging.Info("no lines were read recently; stopped following the file until it is written to again", "namespace", t.namespace, "file", filename)
+
+		t.mutex.Lock()
+		t.idle++
+		allIdle := t.idle == t.sources
+		t.mutex.Unlock()
+
+		if allIdle && t.reset {
+			logging.Info("all log sources are idle; resetting the metrics", "namespace", t.namespace)
+			t.metrics.reset()
+		}
+	}
+}
+
+func (t *idleTracker) onResume(filename string) func() {
+	return func() {
+		logging.Info("file was written to; following it again", "namespace", t.namespace, "file", filename)
+
+		t.mutex.Lock()
+		t.idle--
+		t.mutex.Unlock()
+	}
+}
+
+// reset deletes all request metrics (that are partitioned by labels), so
+// that the time series of an idle namespace are no longer exported
+func (m *Metrics) reset() {
+	vecs := []interface{ Reset() }{
+		m.countTotal,
+		m.bytesTotal,
+		m.requestBytesTotal,
+		m.upstreamSeconds,
+		m.upstreamSecondsHist,
+		m.responseSeconds,
+		m.responseSecondsHist,
+	}
+
+	optional := []*prometheus.CounterVec{
+		m.requestsByHour,
+		m.unmatchedTotal,
+		m.classRequestsTotal,
+		m.classBytesTotal,
+	}
+
+	for _, v := range optional {
+		if v != nil {
+			vecs = append(vecs, v)
+		}
+	}
+
+	if m.responseSecondsBySize != nil {
+		vecs = append(vecs, m.responseSecondsBySize)
+	}
+
+	if m.upstreamAttempts != nil {
+		vecs = append(vecs, m.upstreamAttempts)
+	}
+
+	if m.responseSizeSum != nil {
+		vecs = append(vecs, m.responseSizeSum, m.responseSizeCount)
+	}
+
+	if m.countTotalWithoutMethod != nil {
+		vecs = append(vecs, m.countTotalWithoutMethod, m.bytesTotalWithoutMethod)
+	}
+
+	if m.cache != nil {
+		vecs = append(vecs, m.cache.servedTotal)
+	}
+
+	if m.upstreamLatency != nil {
+		vecs = append(vecs, m.upstreamLatency.seconds)
+	}
+
+	if m.upstreamStatusSeconds != nil {
+		vecs = append(vecs, m.upstreamStatusSeconds)
+	}
+
+	if m.upstreamConnect != nil {
+		vecs = append(vecs,
+			m.upstreamConnect.seconds, m.upstreamConnect.hist,
+			m.upstreamHeader.seconds, m.upstreamHeader.hist,
+		)
+	}
+
+	for _, v := range vecs {
+		v.Reset()
+	}
+
+	if m.seriesLimit != nil {
+		m.seriesLimit.reset()
+	}
+}
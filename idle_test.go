@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/config"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdleTrackerResetsMetricsWhenAllSourcesAreIdle(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.NamespaceConfig{Name: "test", Format: "$request $status"}
+
+	m, err := NewNSMetrics(&cfg)
+	require.Nil(t, err)
+
+	m.countTotal.WithLabelValues("GET", "200").Inc()
+
+	idle := &idleTracker{namespace: "test", metrics: &m.Metrics, reset: true}
+	idle.addSource()
+	idle.addSource()
+
+	idle.onIdle("a.log")()
+	assert.Equal(t, 1, testutil.CollectAndCount(m.countTotal))
+
+	idle.onResume("a.log")()
+	idle.onIdle("b.log")()
+	assert.Equal(t, 1, testutil.CollectAndCount(m.countTotal))
+
+	idle.onIdle("a.log")()
+	assert.Equal(t, 0, testutil.CollectAndCount(m.countTotal))
+}
@@ -0,0 +1,74 @@
+/*
+ * Copyright 2019 Martin Helmich <martin@helmich.me>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/config"
+	"github.com/satyrius/gonx"
+)
+
+// lineParser parses a single log line into its fields
+type lineParser interface {
+	ParseString(line string) (*gonx.Entry, error)
+}
+
+// jsonParser parses log lines that contain one JSON object each (like the
+// ones written by NGINX with a "log_format ... escape=json" directive). The
+// keys of the object are used as field names.
+type jsonParser struct{}
+
+// ParseString decodes a JSON object into the fields of an entry. String
+// values are used as they are; all other values (like numbers, which remain
+// convertible with Entry.FloatField) are used in their JSON representation.
+// Null values are left out.
+func (jsonParser) ParseString(line string) (*gonx.Entry, error) {
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(line), &values); err != nil {
+		return nil, fmt.Errorf("access log line '%s' is not a JSON object: %s", line, err.Error())
+	}
+
+	fields := make(gonx.Fields, len(values))
+	for name, raw := range values {
+		switch {
+		case bytes.Equal(raw, []byte("null")):
+		case len(raw) > 0 && raw[0] == '"':
+			var s string
+			if err := json.Unmarshal(raw, &s); err != nil {
+				return nil, err
+			}
+
+			fields[name] = s
+		default:
+			fields[name] = string(raw)
+		}
+	}
+
+	return gonx.NewEntry(fields), nil
+}
+
+// newLineParser creates the parser for the format_type of a namespace
+func newLineParser(nsCfg *config.NamespaceConfig) lineParser {
+	if nsCfg.FormatType == "json" {
+		return jsonParser{}
+	}
+
+	return gonx.NewParser(nsCfg.Format)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/config"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONParserConvertsValuesToFields(t *testing.T) {
+	t.Parallel()
+
+	entry, err := jsonParser{}.ParseString(`{"request": "GET /a\"b HTTP/1.1", "status": 200, "request_time": 0.125, "cached": true, "upstream_addr": null}`)
+	require.NoError(t, err)
+
+	assert.Equal(t, "GET /a\"b HTTP/1.1", entry.Fields()["request"])
+	assert.Equal(t, "200", entry.Fields()["status"])
+	assert.Equal(t, "true", entry.Fields()["cached"])
+	assert.NotContains(t, entry.Fields(), "upstream_addr")
+
+	rt, err := entry.FloatField("request_time")
+	require.NoError(t, err)
+	assert.Equal(t, 0.125, rt)
+
+	_, err = jsonParser{}.ParseString(`GET / 200`)
+	assert.Error(t, err)
+
+	_, err = jsonParser{}.ParseString(`["GET", 200]`)
+	assert.Error(t, err)
+}
+
+func TestProcessLineParsesJSONLines(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.NamespaceConfig{Name: "test", FormatType: "json"}
+	require.Nil(t, cfg.Compile())
+
+	m, err := NewNSMetrics(&cfg)
+	require.Nil(t, err)
+
+	p := newLineProcessor(&cfg, &m.Metrics)
+	p.processLine(`{"request": "GET / HTTP/1.1", "status": "200", "body_bytes_sent": 512}`)
+	p.processLine(`not json`)
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.countTotal.WithLabelValues("GET", "200")))
+	assert.Equal(t, 512.0, testutil.ToFloat64(m.bytesTotal.WithLabelValues("GET", "200")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.parseErrorsTotal))
+}
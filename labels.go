@@ -0,0 +1,333 @@
+/*
+ * Copyright 2019 Martin Helmich <martin@helmich.me>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"sync"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/config"
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/relabeling"
+	"github.com/satyrius/gonx"
+)
+
+// labelLayout describes the labels of the per-line metrics of a namespace,
+// and at which position the value of each relabeling ends up in the list
+// of label values. It is used both for building the metric vectors and for
+// filling in the label values of each line, so that both always agree.
+type labelLayout struct {
+	names        []string
+	staticValues []string
+
+	relabelings []*relabeling.Relabeling
+
+	// exportIndex contains the position of each relabeling's value in the
+	// label values, or -1 if that value is not exported as label.
+	exportIndex []int
+
+	// endpointMethod is the index of the "method" relabeling if methods are
+	// merged into the endpoint label, and -1 otherwise. endpointIndex is the
+	// position of the endpoint label value.
+	endpointMethod int
+	endpointIndex  int
+
+	// methodIndex is the index of the "method" relabeling, and routeIndexes
+	// contains the indexes of all relabelings that map values using match
+	// statements (and whose value is empty when no statement matched).
+	methodIndex  int
+	routeIndexes []int
+
+	// overLimitIndex is the index of the "over_limit" relabeling, or -1 if
+	// there is none (see fillOverLimitValues)
+	overLimitIndex int
+
+	// filters contains the relabelings that keep or drop log lines, instead
+	// of adding a label
+	filters []*relabeling.Relabeling
+
+	// valuePool contains label value slices (see acquireValues) for reuse
+	valuePool *sync.Pool
+}
+
+func newLabelLayout(cfg *config.NamespaceConfig) *labelLayout {
+	var relabelings, filters []*relabeling.Relabeling
+	for _, r := range relabeling.NewRelabelings(cfg.RelabelConfigs) {
+		if r.FiltersLines() {
+			filters = append(filters, r)
+		} else {
+			relabelings = append(relabelings, r)
+		}
+	}
+
+	relabelings = append(relabelings, relabeling.DefaultRelabelings...)
+	relabelings = relabeling.UniqueRelabelings(relabelings)
+
+	if cfg.CompiledRequestPattern != nil {
+		relabelings = useRequestPatternFields(relabelings)
+	}
+
+	if cfg.NormalizeMethod || cfg.NormalizeOtherMethod {
+		relabelings = normalizeMethods(relabelings, cfg)
+	}
+
+	l := &labelLayout{
+		names:          append([]string{}, cfg.OrderedLabelNames...),
+		staticValues:   cfg.OrderedLabelValues,
+		relabelings:    relabelings,
+		exportIndex:    make([]int, len(relabelings)),
+		endpointMethod: -1,
+		endpointIndex:  -1,
+		methodIndex:    -1,
+		overLimitIndex: -1,
+		filters:        filters,
+	}
+
+	for i, r := range relabelings {
+		l.exportIndex[i] = -1
+
+		if r.TargetLabel == "method" {
+			l.methodIndex = i
+		}
+
+		if r.TargetLabel == "over_limit" && cfg.MaxSeries > 0 {
+			l.overLimitIndex = i
+		}
+
+		if len(r.Matches) > 0 && !r.WhitelistExists {
+			l.routeIndexes = append(l.routeIndexes, i)
+		}
+
+		switch {
+		case r.DisableLabel:
+			continue
+		case cfg.EndpointLabel != "" && r.TargetLabel == "method":
+			l.endpointMethod = i
+			continue
+		case cfg.EndpointLabel != "" && r.TargetLabel == cfg.EndpointLabel:
+			l.endpointIndex = len(l.names)
+			l.exportIndex[i] = len(l.names)
+			l.names = append(l.names, "endpoint")
+		default:
+			l.exportIndex[i] = len(l.names)
+			l.names = append(l.names, r.TargetLabel)
+		}
+	}
+
+	l.newValuePool()
+
+	return l
+}
+
+// drops returns true if a log line (given by its fields) is dropped by any
+// of the keep or drop relabelings
+func (l *labelLayout) drops(fields gonx.Fields) bool {
+	for _, f := range l.filters {
+		if f.Drops(fields[f.SourceValue]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// withoutMethod derives a layout for the same relabelings that does not
+// contain the request method, neither as label of its own, nor as part of the
+// endpoint label
+func (l *labelLayout) withoutMethod() *labelLayout {
+	staticNames := len(l.staticValues)
+
+	c := &labelLayout{
+		names:          append([]string{}, l.names[:staticNames]...),
+		staticValues:   l.staticValues,
+		relabelings:    l.relabelings,
+		exportIndex:    make([]int, len(l.exportIndex)),
+		endpointMethod: -1,
+		endpointIndex:  -1,
+		methodIndex:    l.methodIndex,
+		routeIndexes:   l.routeIndexes,
+		overLimitIndex: l.overLimitIndex,
+	}
+
+	for i, idx := range l.exportIndex {
+		c.exportIndex[i] = -1
+
+		if idx < 0 || i == l.methodIndex {
+			continue
+		}
+
+		c.exportIndex[i] = len(c.names)
+		c.names = append(c.names, l.names[idx])
+	}
+
+	c.newValuePool()
+
+	return c
+}
+
+// requestPartFields contains the fields that the parts of the request line
+// are stored in when a request_pattern is configured, by the index that the
+// part has when splitting the request line at spaces
+var requestPartFields = map[int]string{
+	1: "request.method",
+	2: "request.uri",
+	3: "request.protocol",
+}
+
+// useRequestPatternFields changes all relabelings that split the request line
+// to read the respective part from the fields filled by the request_pattern
+// instead. The relabelings are copied, since DefaultRelabelings are shared
+// by all namespaces.
+func useRequestPatternFields(relabelings []*relabeling.Relabeling) []*relabeling.Relabeling {
+	result := make([]*relabeling.Relabeling, len(relabelings))
+
+	for i, r := range relabelings {
+		field, ok := requestPartFields[r.Split]
+		if r.SourceValue != "request" || !ok {
+			result[i] = r
+			continue
+		}
+
+		c := *r
+		c.SourceValue = field
+		c.Split = 0
+		result[i] = &c
+	}
+
+	return result
+}
+
+// normalizeMethods changes the "method" relabeling to convert the request
+// method to upper case before it is mapped (with normalize_method), so that
+// methods that are logged in lower case match the standard methods, and to
+// map all other methods to "OTHER" (with normalize_other_method). Like in
+// useRequestPatternFields, the relabeling is copied.
+func normalizeMethods(relabelings []*relabeling.Relabeling, cfg *config.NamespaceConfig) []*relabeling.Relabeling {
+	result := make([]*relabeling.Relabeling, len(relabelings))
+
+	for i, r := range relabelings {
+		if r.TargetLabel != "method" {
+			result[i] = r
+			continue
+		}
+
+		c := *r
+		if cfg.NormalizeMethod {
+			c.Uppercase = true
+		}
+		if cfg.NormalizeOtherMethod {
+			c.OtherValue = "OTHER"
+		}
+		result[i] = &c
+	}
+
+	return result
+}
+
+// labelValues builds the label values for a single line, from the mapped
+// values of all relabelings (in the same order as l.relabelings)
+func (l *labelLayout) labelValues(relabelValues []string) []string {
+	values := make([]string, len(l.names))
+	copy(values, l.staticValues)
+	l.fillLabelValues(values, relabelValues)
+
+	return values
+}
+
+// fillLabelValues is like labelValues, but writes the label values into a
+// slice whose static values are already filled in (see acquireValues)
+func (l *labelLayout) fillLabelValues(values []string, relabelValues []string) {
+	for i, idx := range l.exportIndex {
+		if idx >= 0 {
+			values[idx] = relabelValues[i]
+		}
+	}
+
+	if l.endpointMethod >= 0 && l.endpointIndex >= 0 {
+		values[l.endpointIndex] = relabelValues[l.endpointMethod] + " " + values[l.endpointIndex]
+	}
+}
+
+// fillOverLimitValues replaces the label values of a line (except for the
+// static ones) by those of the series that counts all lines exceeding the
+// max_series limit: all of them are empty, except for the "over_limit" label
+func (l *labelLayout) fillOverLimitValues(values []string) {
+	for _, idx := range l.exportIndex {
+		if idx >= 0 {
+			values[idx] = ""
+		}
+	}
+
+	if l.overLimitIndex >= 0 && l.exportIndex[l.overLimitIndex] >= 0 {
+		values[l.exportIndex[l.overLimitIndex]] = "true"
+	}
+}
+
+// withStaticValues returns a copy of the layout with different values for
+// the static labels
+func (l *labelLayout) withStaticValues(values []string) *labelLayout {
+	c := *l
+	c.staticValues = values
+	c.newValuePool()
+
+	return &c
+}
+
+// newValuePool creates the pool of label value slices; it needs to be
+// called whenever the names or static values of a layout change
+func (l *labelLayout) newValuePool() {
+	names, staticValues := len(l.names), l.staticValues
+
+	l.valuePool = &sync.Pool{New: func() interface{} {
+		values := make([]string, names)
+		copy(values, staticValues)
+		return &values
+	}}
+}
+
+// acquireValues returns a slice for the label values of a line (to be
+// filled by fillLabelValues), whose static values are already filled in.
+// It avoids allocating a new slice for each line; the slice must be
+// returned using releaseValues once it is not used anymore.
+func (l *labelLayout) acquireValues() *[]string {
+	return l.valuePool.Get().(*[]string)
+}
+
+// releaseValues returns a slice that was acquired using acquireValues
+func (l *labelLayout) releaseValues(values *[]string) {
+	l.valuePool.Put(values)
+}
+
+// unmatched tests if a line was not matched by any match statement of a
+// relabeling that uses them (which usually means that a desired route is
+// missing from the configuration)
+func (l *labelLayout) unmatched(relabelValues []string) bool {
+	for _, i := range l.routeIndexes {
+		if relabelValues[i] == "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// method returns the mapped request method of a line
+func (l *labelLayout) method(relabelValues []string) string {
+	if l.methodIndex < 0 {
+		return ""
+	}
+
+	return relabelValues[l.methodIndex]
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/config"
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/relabeling"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLabelLayoutContainsStaticAndRelabeledLabels(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.NamespaceConfig{
+		Name:           "test",
+		Labels:         map[string]string{"app": "magicapp"},
+		RelabelConfigs: []config.RelabelConfig{{TargetLabel: "user", SourceValue: "remote_user"}},
+	}
+	cfg.MustCompile()
+
+	l := newLabelLayout(&cfg)
+
+	assert.Equal(t, []string{"app", "user", "method", "status"}, l.names)
+	assert.Equal(t, []string{"magicapp", "foo", "GET", "200"}, l.labelValues([]string{"foo", "GET", "200"}))
+}
+
+func TestLabelLayoutOmitsDisabledLabels(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.NamespaceConfig{
+		Name:           "test",
+		RelabelConfigs: []config.RelabelConfig{{TargetLabel: "request_uri", SourceValue: "request", DisableLabel: true}},
+	}
+	cfg.MustCompile()
+
+	l := newLabelLayout(&cfg)
+
+	assert.Equal(t, []string{"method", "status"}, l.names)
+	assert.Equal(t, []string{"GET", "200"}, l.labelValues([]string{"/users/:id", "GET", "200"}))
+}
+
+func TestLabelLayoutMergesMethodIntoEndpoint(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.NamespaceConfig{
+		Name:           "test",
+		EndpointLabel:  "request_uri",
+		RelabelConfigs: []config.RelabelConfig{{TargetLabel: "request_uri", SourceValue: "request"}},
+	}
+	cfg.MustCompile()
+
+	l := newLabelLayout(&cfg)
+
+	assert.Equal(t, []string{"endpoint", "status"}, l.names)
+	assert.Equal(t, []string{"GET /users/:id", "200"}, l.labelValues([]string{"/users/:id", "GET", "200"}))
+}
+
+func TestLabelLayoutDetectsUnmatchedRoutes(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.NamespaceConfig{
+		Name: "test",
+		RelabelConfigs: []config.RelabelConfig{{
+			TargetLabel: "request_uri",
+			SourceValue: "request",
+			Matches:     []config.RelabelValueMatch{{RegexpString: "^/users", Replacement: "/users"}},
+		}},
+	}
+	cfg.MustCompile()
+
+	l := newLabelLayout(&cfg)
+
+	assert.False(t, l.unmatched([]string{"/users", "GET", "200"}))
+	assert.True(t, l.unmatched([]string{"", "POST", "200"}))
+	assert.Equal(t, "POST", l.method([]string{"", "POST", "200"}))
+}
+
+func TestLabelLayoutUsesRequestPatternFields(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.NamespaceConfig{
+		Name:           "test",
+		RequestPattern: `^(?P<method>\S+) (?P<uri>.*)$`,
+		RelabelConfigs: []config.RelabelConfig{{TargetLabel: "request_uri", SourceValue: "request", Split: 2}},
+	}
+	cfg.MustCompile()
+
+	l := newLabelLayout(&cfg)
+
+	assert.Equal(t, "request.uri", l.relabelings[0].SourceValue)
+	assert.Equal(t, 0, l.relabelings[0].Split)
+	assert.Equal(t, "request.method", l.relabelings[1].SourceValue)
+	assert.Equal(t, "request", relabeling.DefaultRelabelings[0].SourceValue)
+}
+
+func TestLabelLayoutWithoutMethod(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.NamespaceConfig{
+		Name:           "test",
+		Labels:         map[string]string{"app": "magicapp"},
+		RelabelConfigs: []config.RelabelConfig{{TargetLabel: "user", SourceValue: "remote_user"}},
+	}
+	cfg.MustCompile()
+
+	l := newLabelLayout(&cfg).withoutMethod()
+
+	assert.Equal(t, []string{"app", "user", "status"}, l.names)
+	assert.Equal(t, []string{"magicapp", "foo", "200"}, l.labelValues([]string{"foo", "GET", "200"}))
+}
+
+func TestLabelLayoutWithoutMethodKeepsEndpointWithoutMethod(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.NamespaceConfig{
+		Name:           "test",
+		EndpointLabel:  "request_uri",
+		RelabelConfigs: []config.RelabelConfig{{TargetLabel: "request_uri", SourceValue: "request"}},
+	}
+	cfg.MustCompile()
+
+	l := newLabelLayout(&cfg).withoutMethod()
+
+	assert.Equal(t, []string{"endpoint", "status"}, l.names)
+	assert.Equal(t, []string{"/users/:id", "200"}, l.labelValues([]string{"/users/:id", "GET", "200"}))
+}
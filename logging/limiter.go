@@ -0,0 +1,49 @@
+package logging
+
+import (
+	"sync"
+	"time"
+)
+
+// Limiter limits how many messages of a kind (like errors for every log line
+// that cannot be parsed) are logged in an interval
+type Limiter struct {
+	max      int
+	interval time.Duration
+	now      func() time.Time
+
+	mutex      sync.Mutex
+	start      time.Time
+	count      int
+	suppressed int
+}
+
+// NewLimiter creates a Limiter that allows max messages per interval
+func NewLimiter(max int, interval time.Duration) *Limiter {
+	return &Limiter{max: max, interval: interval, now: time.Now}
+}
+
+// Allow tests if another message may be logged. For the first message of an
+// interval, it also returns how many messages were suppressed in the previous
+// intervals, so that their number can be logged along with it.
+func (l *Limiter) Allow() (bool, int) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if now := l.now(); now.Sub(l.start) >= l.interval {
+		l.start = now
+		l.count = 0
+	}
+
+	if l.count >= l.max {
+		l.suppressed++
+		return false, 0
+	}
+
+	l.count++
+
+	suppressed := l.suppressed
+	l.suppressed = 0
+
+	return true, suppressed
+}
@@ -0,0 +1,220 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level is the severity of a log message
+type Level int
+
+const (
+	LevelInfo Level = iota
+	LevelWarn
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	}
+
+	return "info"
+}
+
+// ParseLevel returns the level with the given name ("info", "warn" or
+// "error"); an empty name denotes "info"
+func ParseLevel(name string) (Level, error) {
+	switch name {
+	case "", "info":
+		return LevelInfo, nil
+	case "warn":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	}
+
+	return LevelInfo, fmt.Errorf("must be 'info', 'warn' or 'error', is '%s'", name)
+}
+
+// Format describes how log messages are written
+type Format string
+
+const (
+	// FormatText writes the message, followed by its fields as key=value
+	// pairs; this is meant to be read by humans
+	FormatText Format = "text"
+
+	// FormatJSON writes each message as a JSON object
+	FormatJSON Format = "json"
+
+	// FormatLogfmt writes each message as a logfmt line
+	FormatLogfmt Format = "logfmt"
+)
+
+// ParseFormat returns the format with the given name; an empty name denotes
+// FormatText
+func ParseFormat(name string) (Format, error) {
+	switch Format(name) {
+	case "", FormatText:
+		return FormatText, nil
+	case FormatJSON, FormatLogfmt:
+		return Format(name), nil
+	}
+
+	return FormatText, fmt.Errorf("must be 'text', 'json' or 'logfmt', is '%s'", name)
+}
+
+// Logger writes leveled log messages with structured fields. Informational
+// messages are written to out, warnings and errors to errOut.
+type Logger struct {
+	mutex  sync.Mutex
+	format Format
+	level  Level
+	out    io.Writer
+	errOut io.Writer
+	now    func() time.Time
+}
+
+// New creates a Logger that writes messages of at least the given level in
+// the given format
+func New(out io.Writer, errOut io.Writer, format Format, level Level) *Logger {
+	return &Logger{format: format, level: level, out: out, errOut: errOut, now: time.Now}
+}
+
+var std = New(os.Stdout, os.Stderr, FormatText, LevelInfo)
+
+// Configure sets the format and the minimum level of the messages that are
+// written by the package-level functions
+func Configure(format Format, level Level) {
+	std.mutex.Lock()
+	defer std.mutex.Unlock()
+
+	std.format = format
+	std.level = level
+}
+
+// Info logs an informational message; keyvals are alternating field names
+// and values
+func Info(msg string, keyvals ...interface{}) {
+	std.Log(LevelInfo, msg, keyvals...)
+}
+
+// Warn logs a warning; keyvals are alternating field names and values
+func Warn(msg string, keyvals ...interface{}) {
+	std.Log(LevelWarn, msg, keyvals...)
+}
+
+// Error logs an error; keyvals are alternating field names and values
+func Error(msg string, keyvals ...interface{}) {
+	std.Log(LevelError, msg, keyvals...)
+}
+
+// Log writes a message of the given level, if the level is enabled; keyvals
+// are alternating field names and values
+func (l *Logger) Log(level Level, msg string, keyvals ...interface{}) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if level < l.level {
+		return
+	}
+
+	var buf bytes.Buffer
+
+	switch l.format {
+	case FormatJSON:
+		writeJSON(&buf, l.now(), level, msg, keyvals)
+	case FormatLogfmt:
+		buf.WriteString("time=" + l.now().UTC().Format(time.RFC3339) + " level=" + level.String() + " msg=")
+		buf.WriteString(logfmtValue(msg))
+		writeLogfmtFields(&buf, keyvals)
+	default:
+		buf.WriteString(msg)
+		writeLogfmtFields(&buf, keyvals)
+	}
+
+	buf.WriteByte('\n')
+
+	out := l.out
+	if level > LevelInfo {
+		out = l.errOut
+	}
+
+	out.Write(buf.Bytes())
+}
+
+// field returns the name and the value of the i-th field of keyvals; a
+// missing value (of an odd number of keyvals) is empty
+func field(keyvals []interface{}, i int) (string, interface{}) {
+	key := fmt.Sprint(keyvals[i])
+	if i+1 >= len(keyvals) {
+		return key, ""
+	}
+
+	switch v := keyvals[i+1].(type) {
+	case error:
+		return key, v.Error()
+	case fmt.Stringer:
+		return key, v.String()
+	default:
+		return key, v
+	}
+}
+
+func writeLogfmtFields(buf *bytes.Buffer, keyvals []interface{}) {
+	for i := 0; i < len(keyvals); i += 2 {
+		key, value := field(keyvals, i)
+		buf.WriteString(" " + key + "=" + logfmtValue(fmt.Sprint(value)))
+	}
+}
+
+// logfmtValue quotes a value if it is empty or contains spaces, quotes,
+// equal signs or control characters
+func logfmtValue(s string) string {
+	if s == "" || strings.IndexFunc(s, func(r rune) bool { return r <= ' ' || r == '=' || r == '"' }) >= 0 {
+		return fmt.Sprintf("%q", s)
+	}
+
+	return s
+}
+
+func writeJSON(buf *bytes.Buffer, now time.Time, level Level, msg string, keyvals []interface{}) {
+	writeJSONField(buf, "time", now.UTC().Format(time.RFC3339), true)
+	writeJSONField(buf, "level", level.String(), false)
+	writeJSONField(buf, "msg", msg, false)
+
+	for i := 0; i < len(keyvals); i += 2 {
+		key, value := field(keyvals, i)
+		writeJSONField(buf, key, value, false)
+	}
+
+	buf.WriteByte('}')
+}
+
+func writeJSONField(buf *bytes.Buffer, key string, value interface{}, first bool) {
+	if first {
+		buf.WriteByte('{')
+	} else {
+		buf.WriteByte(',')
+	}
+
+	k, _ := json.Marshal(key)
+	v, err := json.Marshal(value)
+	if err != nil {
+		v, _ = json.Marshal(fmt.Sprint(value))
+	}
+
+	buf.Write(k)
+	buf.WriteByte(':')
+	buf.Write(v)
+}
@@ -0,0 +1,112 @@
+package logging
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestLogger(format Format, level Level) (*Logger, *bytes.Buffer, *bytes.Buffer) {
+	var out, errOut bytes.Buffer
+
+	l := New(&out, &errOut, format, level)
+	l.now = func() time.Time {
+		return time.Date(2020, 10, 1, 12, 0, 0, 0, time.UTC)
+	}
+
+	return l, &out, &errOut
+}
+
+func TestTextFormat(t *testing.T) {
+	t.Parallel()
+
+	l, out, errOut := newTestLogger(FormatText, LevelInfo)
+	l.Log(LevelInfo, "starting listener", "namespace", "app")
+	l.Log(LevelError, "could not reload configuration file", "error", errors.New("file not found"))
+
+	assert.Equal(t, "starting listener namespace=app\n", out.String())
+	assert.Equal(t, "could not reload configuration file error=\"file not found\"\n", errOut.String())
+}
+
+func TestLogfmtFormat(t *testing.T) {
+	t.Parallel()
+
+	l, out, _ := newTestLogger(FormatLogfmt, LevelInfo)
+	l.Log(LevelInfo, "opened log source", "file", "/var/log/nginx/access.log", "lines", 3, "empty", "")
+
+	assert.Equal(t, "time=2020-10-01T12:00:00Z level=info msg=\"opened log source\" file=/var/log/nginx/access.log lines=3 empty=\"\"\n", out.String())
+}
+
+func TestJSONFormat(t *testing.T) {
+	t.Parallel()
+
+	l, _, errOut := newTestLogger(FormatJSON, LevelInfo)
+	l.Log(LevelWarn, "could not parse line", "namespace", "app", "line", `GET "/"`, "took", time.Second, "odd")
+
+	assert.Equal(t, `{"time":"2020-10-01T12:00:00Z","level":"warn","msg":"could not parse line","namespace":"app","line":"GET \"/\"","took":"1s","odd":""}`+"\n", errOut.String())
+}
+
+func TestMessagesBelowLevelAreDiscarded(t *testing.T) {
+	t.Parallel()
+
+	l, out, errOut := newTestLogger(FormatText, LevelWarn)
+	l.Log(LevelInfo, "starting listener")
+	l.Log(LevelWarn, "could not parse line")
+
+	assert.Empty(t, out.String())
+	assert.Equal(t, "could not parse line\n", errOut.String())
+}
+
+func TestParseLevelAndFormat(t *testing.T) {
+	t.Parallel()
+
+	level, err := ParseLevel("")
+	require.Nil(t, err)
+	assert.Equal(t, LevelInfo, level)
+
+	level, err = ParseLevel("error")
+	require.Nil(t, err)
+	assert.Equal(t, LevelError, level)
+
+	_, err = ParseLevel("debug")
+	assert.Error(t, err)
+
+	format, err := ParseFormat("")
+	require.Nil(t, err)
+	assert.Equal(t, FormatText, format)
+
+	format, err = ParseFormat("logfmt")
+	require.Nil(t, err)
+	assert.Equal(t, FormatLogfmt, format)
+
+	_, err = ParseFormat("xml")
+	assert.Error(t, err)
+}
+
+func TestLimiterSuppressesMessagesPerInterval(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2020, 10, 1, 12, 0, 0, 0, time.UTC)
+	l := NewLimiter(2, time.Minute)
+	l.now = func() time.Time { return now }
+
+	for _, expected := range []bool{true, true, false, false} {
+		allowed, suppressed := l.Allow()
+		assert.Equal(t, expected, allowed)
+		assert.Equal(t, 0, suppressed)
+	}
+
+	now = now.Add(time.Minute)
+
+	allowed, suppressed := l.Allow()
+	assert.True(t, allowed)
+	assert.Equal(t, 2, suppressed)
+
+	allowed, suppressed = l.Allow()
+	assert.True(t, allowed)
+	assert.Equal(t, 0, suppressed)
+}
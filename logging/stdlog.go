@@ -0,0 +1,26 @@
+package logging
+
+import (
+	"log"
+	"strings"
+)
+
+// lineWriter logs every line that is written to it as a message
+type lineWriter struct {
+	level   Level
+	keyvals []interface{}
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		std.Log(w.level, line, w.keyvals...)
+	}
+
+	return len(p), nil
+}
+
+// StdLogger returns a logger of the standard library (as used by some
+// dependencies) whose output is logged with the given level and fields
+func StdLogger(level Level, keyvals ...interface{}) *log.Logger {
+	return log.New(&lineWriter{level: level, keyvals: keyvals}, "", 0)
+}
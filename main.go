@@ -17,25 +17,30 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
+	"time"
 
 	"github.com/martin-helmich/prometheus-nginxlog-exporter/syslog"
 
 	"github.com/martin-helmich/prometheus-nginxlog-exporter/config"
 	"github.com/martin-helmich/prometheus-nginxlog-exporter/discovery"
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/logging"
 	"github.com/martin-helmich/prometheus-nginxlog-exporter/prof"
-	"github.com/martin-helmich/prometheus-nginxlog-exporter/relabeling"
 	"github.com/martin-helmich/prometheus-nginxlog-exporter/tail"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
-	"github.com/satyrius/gonx"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
 )
 
 type NSMetrics struct {
@@ -44,21 +49,173 @@ type NSMetrics struct {
 	Metrics
 }
 
-func NewNSMetrics(cfg *config.NamespaceConfig) *NSMetrics {
+// NewNSMetrics creates the metrics of a namespace and registers them in a
+// registry of their own. If any of the metrics cannot be registered, an
+// error is returned instead.
+func NewNSMetrics(cfg *config.NamespaceConfig) (*NSMetrics, error) {
 	m := &NSMetrics{
 		cfg:      cfg,
 		registry: prometheus.NewRegistry(),
 	}
 	m.Init(cfg)
 
-	m.registry.MustRegister(m.countTotal)
-	m.registry.MustRegister(m.bytesTotal)
-	m.registry.MustRegister(m.upstreamSeconds)
-	m.registry.MustRegister(m.upstreamSecondsHist)
-	m.registry.MustRegister(m.responseSeconds)
-	m.registry.MustRegister(m.responseSecondsHist)
-	m.registry.MustRegister(m.parseErrorsTotal)
-	return m
+	for _, c := range m.collectors() {
+		if err := m.registry.Register(c); err != nil {
+			return nil, err
+		}
+	}
+
+	sources := m.compatSources()
+	for name, sourceName := range cfg.Compat {
+		source, ok := sources[sourceName]
+		if !ok {
+			return nil, fmt.Errorf("compat: metric '%s' does not exist or cannot be aliased", sourceName)
+		}
+
+		if err := m.registry.Register(newCompatCollector(name, sourceName, source)); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+// compatSources returns the counters that may be exposed under legacy names
+// (see compatCollector), by their name without namespace
+func (m *NSMetrics) compatSources() map[string]prometheus.Collector {
+	sources := map[string]prometheus.Collector{
+		"parse_errors_total": m.parseErrorsTotal,
+		"parsed_lines_total": m.parsedLinesTotal,
+		"lines_total":        m.linesTotal,
+	}
+
+	if m.cfg.Shadow {
+		return sources
+	}
+
+	sources["http_response_count_total"] = m.countTotal
+	sources["http_response_size_bytes"] = m.bytesTotal
+
+	if m.requestsByHour != nil {
+		sources["http_requests_by_hour_total"] = m.requestsByHour
+	}
+
+	if m.unmatchedTotal != nil {
+		sources["unmatched_requests_total"] = m.unmatchedTotal
+	}
+
+	return sources
+}
+
+func (m *NSMetrics) collectors() []prometheus.Collector {
+	collectors := []prometheus.Collector{
+		m.parseErrorsTotal,
+		m.parsedLinesTotal,
+		m.linesTotal,
+		m.symlinkRepoints,
+		m.filePositions,
+		m.followedFiles,
+		m.tailErrorsTotal,
+	}
+
+	if m.slowLinesTotal != nil {
+		collectors = append(collectors, m.slowLinesTotal)
+	}
+
+	if m.missingRequestTotal != nil {
+		collectors = append(collectors, m.missingRequestTotal)
+	}
+
+	if m.linesDroppedTotal != nil {
+		collectors = append(collectors, m.linesDroppedTotal)
+	}
+
+	if m.seriesLimitExceeded != nil {
+		collectors = append(collectors, m.seriesLimitExceeded)
+	}
+
+	if m.activity != nil {
+		collectors = append(collectors, m.activity.active)
+	}
+
+	if m.parseRatio != nil {
+		collectors = append(collectors, m.parseRatio)
+	}
+
+	if m.clockSkew != nil {
+		collectors = append(collectors, m.clockSkew.collectors()...)
+	}
+
+	if m.lastLineTimestamp != nil {
+		collectors = append(collectors, m.lastLineTimestamp)
+	}
+
+	if m.cfg.Shadow {
+		return collectors
+	}
+
+	collectors = append(collectors,
+		m.countTotal,
+		m.bytesTotal,
+		m.requestBytesTotal,
+		m.upstreamSeconds,
+		m.upstreamSecondsHist,
+		m.responseSeconds,
+		m.responseSecondsHist,
+	)
+
+	if m.upstreamAttempts != nil {
+		collectors = append(collectors, m.upstreamAttempts)
+	}
+
+	if m.responseSecondsBySize != nil {
+		collectors = append(collectors, m.responseSecondsBySize)
+	}
+
+	if m.requestsByHour != nil {
+		collectors = append(collectors, m.requestsByHour)
+	}
+
+	if m.unmatchedTotal != nil {
+		collectors = append(collectors, m.unmatchedTotal)
+	}
+
+	if m.topMethods != nil {
+		collectors = append(collectors, m.topMethods)
+	}
+
+	if m.classRequestsTotal != nil {
+		collectors = append(collectors, m.classRequestsTotal, m.classBytesTotal)
+	}
+
+	if m.responseSizeSum != nil {
+		collectors = append(collectors, m.responseSizeSum, m.responseSizeCount)
+	}
+
+	if m.countTotalWithoutMethod != nil {
+		collectors = append(collectors, m.countTotalWithoutMethod, m.bytesTotalWithoutMethod)
+	}
+
+	if m.cache != nil {
+		collectors = append(collectors, m.cache.collectors()...)
+	}
+
+	if m.upstreamLatency != nil {
+		collectors = append(collectors, m.upstreamLatency.seconds)
+	}
+
+	if m.upstreamStatusSeconds != nil {
+		collectors = append(collectors, m.upstreamStatusSeconds)
+	}
+
+	if m.upstreamConnect != nil {
+		collectors = append(collectors,
+			m.upstreamConnect.seconds, m.upstreamConnect.hist,
+			m.upstreamHeader.seconds, m.upstreamHeader.hist,
+		)
+	}
+
+	return collectors
 }
 
 // Metrics is a struct containing pointers to all metrics that should be
@@ -66,64 +223,95 @@ func NewNSMetrics(cfg *config.NamespaceConfig) *NSMetrics {
 type Metrics struct {
 	countTotal          *prometheus.CounterVec
 	bytesTotal          *prometheus.CounterVec
+	requestBytesTotal   *prometheus.CounterVec
 	upstreamSeconds     *prometheus.SummaryVec
 	upstreamSecondsHist *prometheus.HistogramVec
 	responseSeconds     *prometheus.SummaryVec
 	responseSecondsHist *prometheus.HistogramVec
 	parseErrorsTotal    prometheus.Counter
-}
-
-func inLabels(label string, labels []string) bool {
-	for _, l := range labels {
-		if label == l {
-			return true
-		}
-	}
-	return false
+	parsedLinesTotal    prometheus.Counter
+	linesTotal          prometheus.Counter
+	slowLinesTotal      prometheus.Counter
+	upstreamAttempts    *prometheus.HistogramVec
+
+	responseSecondsBySize *prometheus.HistogramVec
+	requestsByHour        *prometheus.CounterVec
+	unmatchedTotal        *prometheus.CounterVec
+	topMethods            *topMethodsCollector
+	classRequestsTotal    *prometheus.CounterVec
+	classBytesTotal       *prometheus.CounterVec
+	responseSizeSum       *prometheus.GaugeVec
+	responseSizeCount     *prometheus.GaugeVec
+	activity              *activityMetrics
+	parseRatio            *parseRatioCollector
+	clockSkew             *clockSkewMetrics
+	symlinkRepoints       *prometheus.CounterVec
+	filePositions         *filePositionCollector
+	followedFiles         *followedFilesCollector
+	tailErrorsTotal       prometheus.Counter
+	cache                 *cacheMetrics
+	upstreamLatency       *upstreamLatencyMetrics
+	missingRequestTotal   prometheus.Counter
+	upstreamStatusSeconds *prometheus.HistogramVec
+	upstreamConnect       *upstreamPhaseMetrics
+	upstreamHeader        *upstreamPhaseMetrics
+	linesDroppedTotal     prometheus.Counter
+	lastLineTimestamp     *prometheus.GaugeVec
+	seriesLimit           *seriesLimit
+	seriesLimitExceeded   prometheus.Counter
+	statsd                *statsdMetrics
+	otlp                  *otlpMetrics
+
+	countTotalWithoutMethod *prometheus.CounterVec
+	bytesTotalWithoutMethod *prometheus.CounterVec
 }
 
 // Init initializes a metrics struct
 func (m *Metrics) Init(cfg *config.NamespaceConfig) {
 	cfg.MustCompile()
 
-	labels := cfg.OrderedLabelNames
-
-	for i := range cfg.RelabelConfigs {
-		labels = append(labels, cfg.RelabelConfigs[i].TargetLabel)
-	}
-
-	for _, r := range relabeling.DefaultRelabelings {
-		if !inLabels(r.TargetLabel, labels) {
-			labels = append(labels, r.TargetLabel)
-		}
-	}
+	layout := newLabelLayout(cfg)
+	labels := layout.names
 
 	m.countTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
 		Namespace:   cfg.NamespacePrefix,
 		ConstLabels: cfg.NamespaceLabels,
-		Name:        "http_response_count_total",
+		Name:        cfg.MetricName("http_response_count_total"),
 		Help:        "Amount of processed HTTP requests",
 	}, labels)
 
 	m.bytesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
 		Namespace:   cfg.NamespacePrefix,
 		ConstLabels: cfg.NamespaceLabels,
-		Name:        "http_response_size_bytes",
+		Name:        cfg.MetricName("http_response_size_bytes"),
 		Help:        "Total amount of transferred bytes",
 	}, labels)
 
+	m.requestBytesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace:   cfg.NamespacePrefix,
+		ConstLabels: cfg.NamespaceLabels,
+		Name:        cfg.MetricName("http_request_size_bytes"),
+		Help:        "Total amount of received bytes (including request line and headers)",
+	}, labels)
+
+	if cfg.ZeroInit != nil {
+		m.zeroInitialize(cfg, layout)
+	}
+
 	m.upstreamSeconds = prometheus.NewSummaryVec(prometheus.SummaryOpts{
 		Namespace:   cfg.NamespacePrefix,
 		ConstLabels: cfg.NamespaceLabels,
-		Name:        "http_upstream_time_seconds",
+		Name:        cfg.MetricName("http_upstream_time_seconds"),
 		Help:        "Time needed by upstream servers to handle requests",
-		Objectives:  map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001},
+		Objectives:  cfg.CompiledSummaryObjectives,
+		MaxAge:      cfg.SummaryMaxAgeDuration,
+		AgeBuckets:  cfg.SummaryAgeBuckets,
 	}, labels)
 
 	m.upstreamSecondsHist = prometheus.NewHistogramVec(prometheus.HistogramOpts{
 		Namespace:   cfg.NamespacePrefix,
 		ConstLabels: cfg.NamespaceLabels,
-		Name:        "http_upstream_time_seconds_hist",
+		Name:        cfg.MetricName("http_upstream_time_seconds_hist"),
 		Help:        "Time needed by upstream servers to handle requests",
 		Buckets:     cfg.HistogramBuckets,
 	}, labels)
@@ -131,15 +319,17 @@ func (m *Metrics) Init(cfg *config.NamespaceConfig) {
 	m.responseSeconds = prometheus.NewSummaryVec(prometheus.SummaryOpts{
 		Namespace:   cfg.NamespacePrefix,
 		ConstLabels: cfg.NamespaceLabels,
-		Name:        "http_response_time_seconds",
+		Name:        cfg.MetricName("http_response_time_seconds"),
 		Help:        "Time needed by NGINX to handle requests",
-		Objectives:  map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001},
+		Objectives:  cfg.CompiledSummaryObjectives,
+		MaxAge:      cfg.SummaryMaxAgeDuration,
+		AgeBuckets:  cfg.SummaryAgeBuckets,
 	}, labels)
 
 	m.responseSecondsHist = prometheus.NewHistogramVec(prometheus.HistogramOpts{
 		Namespace:   cfg.NamespacePrefix,
 		ConstLabels: cfg.NamespaceLabels,
-		Name:        "http_response_time_seconds_hist",
+		Name:        cfg.MetricName("http_response_time_seconds_hist"),
 		Help:        "Time needed by NGINX to handle requests",
 		Buckets:     cfg.HistogramBuckets,
 	}, labels)
@@ -147,30 +337,253 @@ func (m *Metrics) Init(cfg *config.NamespaceConfig) {
 	m.parseErrorsTotal = prometheus.NewCounter(prometheus.CounterOpts{
 		Namespace:   cfg.NamespacePrefix,
 		ConstLabels: cfg.NamespaceLabels,
-		Name:        "parse_errors_total",
+		Name:        cfg.MetricName("parse_errors_total"),
 		Help:        "Total number of log file lines that could not be parsed",
 	})
+
+	m.parsedLinesTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace:   cfg.NamespacePrefix,
+		ConstLabels: cfg.NamespaceLabels,
+		Name:        cfg.MetricName("parsed_lines_total"),
+		Help:        "Total number of log file lines that were parsed successfully",
+	})
+
+	m.linesTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace:   cfg.NamespacePrefix,
+		ConstLabels: cfg.NamespaceLabels,
+		Name:        cfg.MetricName("lines_total"),
+		Help:        "Total number of log file lines that were read, whether they could be parsed or not",
+	})
+
+	if cfg.SlowLineThresholdDuration > 0 {
+		m.slowLinesTotal = prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   cfg.NamespacePrefix,
+			ConstLabels: cfg.NamespaceLabels,
+			Name:        cfg.MetricName("slow_lines_total"),
+			Help:        "Total number of log file lines whose processing took longer than the configured threshold",
+		})
+	}
+
+	if cfg.MissingRequest == "count" {
+		m.missingRequestTotal = prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   cfg.NamespacePrefix,
+			ConstLabels: cfg.NamespaceLabels,
+			Name:        cfg.MetricName("missing_request_lines_total"),
+			Help:        "Total number of log file lines without a request field, which were not counted as requests",
+		})
+	}
+
+	if cfg.WorkerPool != nil && cfg.WorkerPool.DropWhenFull {
+		m.linesDroppedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   cfg.NamespacePrefix,
+			ConstLabels: cfg.NamespaceLabels,
+			Name:        cfg.MetricName("lines_dropped_total"),
+			Help:        "Total number of log file lines that were dropped because the queue of the worker pool was full",
+		})
+	}
+
+	if cfg.MaxSeries > 0 {
+		m.seriesLimit = newSeriesLimit(cfg.MaxSeries)
+		m.seriesLimitExceeded = prometheus.NewCounter(prometheus.CounterOpts{
+			ConstLabels: prometheus.Labels{"namespace": cfg.Name},
+			Name:        "nginxlog_series_limit_exceeded_total",
+			Help:        "Total number of requests that were counted in the over_limit series, since their label values exceeded the max_series limit",
+		})
+	}
+
+	m.symlinkRepoints = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace:   cfg.NamespacePrefix,
+		ConstLabels: cfg.NamespaceLabels,
+		Name:        cfg.MetricName("source_symlink_repoints_total"),
+		Help:        "Number of times a log file that is a symbolic link was repointed to another file",
+	}, []string{"file"})
+
+	m.filePositions = newFilePositionCollector(cfg)
+	m.followedFiles = newFollowedFilesCollector(cfg)
+
+	m.tailErrorsTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		ConstLabels: prometheus.Labels{"namespace": cfg.Name},
+		Name:        "nginxlog_tail_errors_total",
+		Help:        "Total number of errors while following log files (like files that could not be read or reopened)",
+	})
+
+	if cfg.UpstreamAttempts {
+		m.upstreamAttempts = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   cfg.NamespacePrefix,
+			ConstLabels: cfg.NamespaceLabels,
+			Name:        cfg.MetricName("http_upstream_attempts"),
+			Help:        "Number of upstream servers that were contacted to handle requests",
+			Buckets:     []float64{1, 2, 3, 4, 5},
+		}, labels)
+	}
+
+	if cfg.RequestSizeLatency != nil {
+		m.responseSecondsBySize = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   cfg.NamespacePrefix,
+			ConstLabels: cfg.NamespaceLabels,
+			Name:        cfg.MetricName("http_response_time_seconds_by_request_size"),
+			Help:        "Time needed by NGINX to handle requests, partitioned by request size",
+			Buckets:     cfg.HistogramBuckets,
+		}, append(labels, "request_size"))
+	}
+
+	if cfg.RequestsByHour {
+		m.requestsByHour = prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   cfg.NamespacePrefix,
+			ConstLabels: cfg.NamespaceLabels,
+			Name:        cfg.MetricName("http_requests_by_hour_total"),
+			Help:        "Amount of processed HTTP requests, by hour of day of the request timestamp",
+		}, []string{"hour"})
+	}
+
+	if cfg.LastLineTimestamp {
+		m.lastLineTimestamp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   cfg.NamespacePrefix,
+			ConstLabels: cfg.NamespaceLabels,
+			Name:        cfg.MetricName("last_line_timestamp_seconds"),
+			Help:        "Timestamp of the last processed log line of a log file, as logged in that line",
+		}, []string{"file"})
+	}
+
+	if cfg.CountUnmatchedRequests {
+		m.unmatchedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   cfg.NamespacePrefix,
+			ConstLabels: cfg.NamespaceLabels,
+			Name:        cfg.MetricName("unmatched_requests_total"),
+			Help:        "Amount of processed HTTP requests that were not matched by any match statement",
+		}, []string{"method"})
+	}
+
+	if cfg.TopMethods > 0 {
+		m.topMethods = newTopMethodsCollector(cfg)
+	}
+
+	if cfg.StatusClassMetrics {
+		m.classRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   cfg.NamespacePrefix,
+			ConstLabels: cfg.NamespaceLabels,
+			Name:        cfg.MetricName("http_requests_total"),
+			Help:        "Amount of processed HTTP requests, by status class only",
+		}, []string{"class"})
+
+		m.classBytesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   cfg.NamespacePrefix,
+			ConstLabels: cfg.NamespaceLabels,
+			Name:        cfg.MetricName("http_bytes_total"),
+			Help:        "Total amount of transferred bytes, by status class only",
+		}, []string{"class"})
+	}
+
+	if cfg.WithoutMethodMetrics {
+		withoutMethod := layout.withoutMethod().names
+
+		m.countTotalWithoutMethod = prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   cfg.NamespacePrefix,
+			ConstLabels: cfg.NamespaceLabels,
+			Name:        cfg.MetricName("http_response_count_without_method_total"),
+			Help:        "Amount of processed HTTP requests, without method label",
+		}, withoutMethod)
+
+		m.bytesTotalWithoutMethod = prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   cfg.NamespacePrefix,
+			ConstLabels: cfg.NamespaceLabels,
+			Name:        cfg.MetricName("http_response_size_without_method_bytes"),
+			Help:        "Total amount of transferred bytes, without method label",
+		}, withoutMethod)
+	}
+
+	if cfg.ResponseSizeGauges {
+		m.responseSizeSum = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   cfg.NamespacePrefix,
+			ConstLabels: cfg.NamespaceLabels,
+			Name:        cfg.MetricName("http_response_size_sum"),
+			Help:        "Total amount of transferred bytes (for dashboards that expect explicit _sum and _count series)",
+		}, labels)
+
+		m.responseSizeCount = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   cfg.NamespacePrefix,
+			ConstLabels: cfg.NamespaceLabels,
+			Name:        cfg.MetricName("http_response_size_count"),
+			Help:        "Amount of HTTP requests with a known response size (for dashboards that expect explicit _sum and _count series)",
+		}, labels)
+	}
+
+	if cfg.CacheMetrics {
+		m.cache = newCacheMetrics(cfg)
+	}
+
+	if cfg.ActiveWindowDuration > 0 {
+		m.activity = newActivityMetrics(cfg)
+	}
+
+	if cfg.ParseRatioWindowDuration > 0 {
+		m.parseRatio = newParseRatioCollector(cfg)
+	}
+
+	if cfg.ClockSkew != nil {
+		m.clockSkew = newClockSkewMetrics(cfg)
+	}
+
+	if cfg.UpstreamLatency != nil {
+		m.upstreamLatency = newUpstreamLatencyMetrics(cfg)
+	}
+
+	if cfg.UpstreamStatusLatency {
+		m.upstreamStatusSeconds = newUpstreamStatusLatency(cfg)
+	}
+
+	if cfg.DetailedUpstreamMetrics {
+		m.upstreamConnect = newUpstreamPhaseMetrics(cfg, labels, "connect", "Time needed to establish connections with upstream servers")
+		m.upstreamHeader = newUpstreamPhaseMetrics(cfg, labels, "header", "Time needed to receive the response headers from upstream servers")
+	}
+}
+
+// zeroInitialize initializes the request counters with zero for all known
+// label combinations (of all file groups), so that they are exported before
+// the first request was processed
+func (m *Metrics) zeroInitialize(cfg *config.NamespaceConfig, layout *labelLayout) {
+	layouts := []*labelLayout{layout}
+	for i := range cfg.SourceData.FileGroups {
+		layouts = append(layouts, layout.withStaticValues(cfg.FileGroupLabelValues(&cfg.SourceData.FileGroups[i])))
+	}
+
+	for _, l := range layouts {
+		combinations, ok := l.zeroInitLabelValues(cfg.ZeroInit)
+		if !ok {
+			logging.Warn("cannot initialize metrics with zero: the values of some labels are not known in advance, or there are too many combinations", "namespace", cfg.Name)
+			return
+		}
+
+		for _, values := range combinations {
+			m.countTotal.WithLabelValues(values...)
+			m.bytesTotal.WithLabelValues(values...)
+		}
+	}
 }
 
 func main() {
 	var opts config.StartupFlags
 	var cfg = config.Config{
 		Listen: config.ListenConfig{
-			Port:            4040,
+			Port:            defaultListenPort(),
 			Address:         "0.0.0.0",
 			MetricsEndpoint: "/metrics",
 		},
 	}
 	nsGatherers := make(prometheus.Gatherers, 0)
 
-	flag.IntVar(&opts.ListenPort, "listen-port", 4040, "HTTP port to listen on")
+	flag.IntVar(&opts.ListenPort, "listen-port", cfg.Listen.Port, "HTTP port to listen on (defaults to the PORT environment variable, if set)")
 	flag.StringVar(&opts.Format, "format", `$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent "$http_referer" "$http_user_agent" "$http_x_forwarded_for"`, "NGINX access log format")
 	flag.StringVar(&opts.Namespace, "namespace", "nginx", "namespace to use for metric names")
-	flag.StringVar(&opts.ConfigFile, "config-file", "", "Configuration file to read from")
+	flag.StringVar(&opts.ConfigFile, "config-file", "", "Configuration file to read from (may also be a HTTP(S) or S3 URL)")
 	flag.BoolVar(&opts.EnableExperimentalFeatures, "enable-experimental", false, "Set this flag to enable experimental features")
 	flag.StringVar(&opts.CPUProfile, "cpuprofile", "", "write cpu profile to `file`")
 	flag.StringVar(&opts.MemProfile, "memprofile", "", "write memory profile to `file`")
 	flag.StringVar(&opts.MetricsEndpoint, "metrics-endpoint", cfg.Listen.MetricsEndpoint, "URL path at which to serve metrics")
+	flag.BoolVar(&opts.DisableGoCollector, "disable-go-collector", false, "Do not export metrics about the Go runtime of the exporter")
+	flag.BoolVar(&opts.DisableProcessCollector, "disable-process-collector", false, "Do not export metrics about the process of the exporter")
+	flag.BoolVar(&opts.CheckConfig, "check-config", false, "Check the configuration (including the log sources) and exit, without starting the exporter")
+	flag.BoolVar(&opts.OneShot, "oneshot", false, "Read all log files once from their beginning to their end (decompressing .gz files), and exit afterwards")
 	flag.Parse()
 
 	opts.Filenames = flag.Args()
@@ -182,20 +595,18 @@ func main() {
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGINT)
 
+	// ctx is cancelled when the exporter should shut down; sourcesCtx is
+	// cancelled only after all stop handlers have finished, so that log lines
+	// are still processed until then (for example, while the metrics are
+	// written to a file for the last time)
+	ctx, cancel := context.WithCancel(context.Background())
+	sourcesCtx, stopSources := context.WithCancel(context.Background())
+
 	go func() {
 		sig := <-sigChan
 
-		fmt.Printf("caught term %s. exiting\n", sig)
-
-		close(stopChan)
-		stopHandlers.Wait()
-
-		os.Exit(0)
-	}()
-
-	defer func() {
-		close(stopChan)
-		stopHandlers.Wait()
+		logging.Info("caught signal; exiting", "signal", sig)
+		cancel()
 	}()
 
 	prof.SetupCPUProfiling(opts.CPUProfile, stopChan, &stopHandlers)
@@ -203,71 +614,384 @@ func main() {
 
 	loadConfig(&opts, &cfg)
 
-	fmt.Printf("using configuration %+v\n", cfg)
+	if opts.CheckConfig {
+		os.Exit(runConfigCheck(&cfg, opts.EnableExperimentalFeatures))
+	}
+
+	configureLogging(&cfg)
+	logging.Info("using configuration", "config", fmt.Sprintf("%+v", cfg))
 
 	if stabilityError := cfg.StabilityWarnings(); stabilityError != nil && !opts.EnableExperimentalFeatures {
-		fmt.Fprintf(os.Stderr, "Your configuration file contains an option that is explicitly labeled as experimental feature:\n\n  %s\n\n", stabilityError.Error())
-		fmt.Fprintln(os.Stderr, "Use the -enable-experimental flag or the enable_experimental option to enable these features. Use them at your own peril.")
+		exitWithError(
+			"Your configuration file contains an option that is explicitly labeled as experimental feature. Use the -enable-experimental flag or the enable_experimental option to enable these features. Use them at your own peril.",
+			"feature", stabilityError,
+		)
+	}
 
-		os.Exit(1)
+	if err := cfg.Validate(); err != nil {
+		exitWithError("Your configuration is invalid", "error", err)
 	}
 
-	if cfg.Consul.Enable {
-		setupConsul(&cfg, stopChan, &stopHandlers)
+	if len(cfg.Namespaces) == 0 {
+		logging.Warn("no namespaces are configured; no log files will be read and the exporter will never report being ready")
 	}
 
+	// the poll interval cannot be changed once files are followed
+	if interval, err := cfg.PollInterval(); err == nil && interval > 0 {
+		logging.Info("polling log files for changes", "interval", interval)
+		tail.SetPollInterval(interval)
+	}
+
+	setupRegistration(&cfg, stopChan, &stopHandlers)
+
+	var pool *workerPool
+	if cfg.WorkerPool != nil && cfg.WorkerPool.Size > 0 {
+		logging.Info("starting shared worker pool", "workers", cfg.WorkerPool.Size)
+		pool = newWorkerPool(cfg.WorkerPool.Size, cfg.WorkerPool.QueueSize)
+	}
+
+	var instanceLabels map[string]string
+	if cfg.InstanceLabel != nil {
+		labels, err := cfg.InstanceLabel.Labels()
+		if err != nil {
+			exitWithError("could not determine the instance label", "error", err)
+		}
+
+		instanceLabels = labels
+	}
+
+	starter := &namespaceStarter{
+		ctx:            sourcesCtx,
+		pool:           pool,
+		instanceLabels: instanceLabels,
+		debugLines:     cfg.DebugLines,
+		oneShot:        cfg.OneShot,
+	}
+
+	if cfg.StatsD != nil {
+		logging.Info("sending metrics to StatsD server", "address", cfg.StatsD.Address, "protocol", cfg.StatsD.ProtocolOrDefault())
+		starter.statsd = newStatsDClient(cfg.StatsD)
+	}
+
+	var meterProvider *sdkmetric.MeterProvider
+	if cfg.OTLP != nil {
+		var err error
+		meterProvider, err = setupOTLP(cfg.OTLP)
+		if err != nil {
+			exitWithError("invalid otlp configuration", "error", err)
+		}
+
+		starter.meterProvider = meterProvider
+	}
+
+	namespaces := newNamespaceSet()
+	nsGatherers = append(nsGatherers, namespaces)
+
 	for _, ns := range cfg.Namespaces {
-		nsMetrics := NewNSMetrics(&ns)
-		nsGatherers = append(nsGatherers, nsMetrics.registry)
+		n, err := starter.start(ns)
+		if err != nil {
+			logging.Error("could not register metrics for namespace; skipping it", "namespace", ns.Name, "error", err)
+			continue
+		}
 
-		fmt.Printf("starting listener for namespace %s\n", ns.Name)
-		go processNamespace(ns, &(nsMetrics.Metrics))
+		namespaces.add(ns.Name, n)
+	}
+
+	// the exporter is ready as soon as all log sources have been opened (but
+	// never without any namespaces, since it would not monitor anything);
+	// sources that are still being retried keep it from being ready. If any
+	// namespace could not be started, it exits instead.
+	var ready int32
+	var failed int32
+	go func() {
+		namespaces.waitStarted()
+		if namespaces.failed() {
+			logging.Error("not all namespaces could be started; exiting")
+			atomic.StoreInt32(&failed, 1)
+			cancel()
+			return
+		}
+
+		if len(cfg.Namespaces) > 0 && namespaces.waitOpened(ctx) {
+			atomic.StoreInt32(&ready, 1)
+		}
+	}()
+
+	// in one-shot mode, the exporter stops once all log sources were read
+	// (and all of their lines were processed)
+	if cfg.OneShot {
+		go func() {
+			namespaces.waitDrained()
+			if pool != nil {
+				pool.stop()
+			}
+
+			logging.Info("all log sources were read; exiting")
+			cancel()
+		}()
+	}
+
+	// namespaces of a configuration file are replaced on SIGHUP; all other
+	// settings require a restart (and no namespaces are started again once
+	// they were read in one-shot mode)
+	if opts.ConfigFile != "" && !cfg.OneShot {
+		hupChan := make(chan os.Signal, 1)
+		signal.Notify(hupChan, syscall.SIGHUP)
+
+		go func() {
+			for range hupChan {
+				reloadConfig(opts.ConfigFile, starter, namespaces)
+			}
+		}()
 	}
 
 	listenAddr := fmt.Sprintf("%s:%d", cfg.Listen.Address, cfg.Listen.Port)
 	endpoint := cfg.Listen.MetricsEndpointOrDefault()
 
-	fmt.Printf("running HTTP server on address %s, serving metrics at %s\n", listenAddr, endpoint)
+	exporterRegistry := prometheus.NewRegistry()
+	nsGatherers = append(nsGatherers, exporterRegistry)
+	exporterRegistry.MustRegister(newBuildInfo())
+
+	if !opts.DisableGoCollector {
+		exporterRegistry.MustRegister(prometheus.NewGoCollector())
+	}
+
+	if !opts.DisableProcessCollector {
+		exporterRegistry.MustRegister(prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}))
+	}
+
+	if cfg.FileExport != nil && cfg.FileExport.Path != "" {
+		interval, err := cfg.FileExport.IntervalOrDefault()
+		if err != nil {
+			exitWithError("invalid file_sd configuration", "error", err)
+		}
+
+		setupFileExport(cfg.FileExport.Path, interval, nsGatherers, stopChan, &stopHandlers)
+	}
+
+	if cfg.Pushgateway != nil {
+		interval, err := cfg.Pushgateway.IntervalOrDefault()
+		if err != nil {
+			exitWithError("invalid pushgateway configuration", "error", err)
+		}
+
+		setupPushgateway(cfg.Pushgateway.URL, cfg.Pushgateway.JobOrDefault(), interval, nsGatherers, stopChan, &stopHandlers)
+	}
+
+	// exemplars are only exposed in the OpenMetrics format, which is not
+	// enabled otherwise since it exposes counters without a _total suffix
+	// (like http_response_size_bytes) with the "unknown" type
+	handlerOpts := promhttp.HandlerOpts{ErrorHandling: promhttp.ContinueOnError, EnableOpenMetrics: cfg.UsesExemplars()}
 
-	nsHandler := promhttp.InstrumentMetricHandler(
-		prometheus.DefaultRegisterer, promhttp.HandlerFor(nsGatherers, promhttp.HandlerOpts{}),
+	var nsHandler http.Handler = promhttp.InstrumentMetricHandler(
+		prometheus.DefaultRegisterer, promhttp.HandlerFor(nsGatherers, handlerOpts),
 	)
 
+	if starter.statsd != nil {
+		exporterRegistry.MustRegister(starter.statsd.dropped)
+	}
+
+	if cfg.Listen.MaxConcurrentScrapes > 0 {
+		scrapesRejected := prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "nginx_exporter_scrapes_rejected_total",
+			Help: "Total number of scrapes that were rejected because too many scrapes were running concurrently",
+		})
+		exporterRegistry.MustRegister(scrapesRejected)
+
+		nsHandler = limitConcurrentRequests(nsHandler, cfg.Listen.MaxConcurrentScrapes, scrapesRejected)
+	}
+
+	if cfg.Listen.BasicAuth != nil {
+		nsHandler = requireBasicAuth(nsHandler, cfg.Listen.BasicAuth)
+	}
+
 	http.Handle(endpoint, nsHandler)
+	if endpoint != "/" {
+		http.Handle("/", rootHandler(endpoint))
+	}
+
+	http.Handle("/healthz", livenessHandler())
+	http.Handle("/ready", readinessHandler(&ready))
 
-	if err := http.ListenAndServe(listenAddr, nil); err != nil {
-		fmt.Printf("error while starting HTTP server: %s", err.Error())
+	if cfg.DebugLines != nil && cfg.DebugLines.Size > 0 {
+		logging.Info("serving the last log lines of each namespace at /debug/lines", "lines", cfg.DebugLines.Size)
+		http.Handle("/debug/lines", debugLinesHandler(namespaces.lineRing, cfg.DebugLines.Token))
+	}
+
+	// log lines are still processed (and the metrics still served) during
+	// the drain period, before the stop handlers flush the metrics for the
+	// last time
+	serveCtx, stopServing := context.WithCancel(context.Background())
+	go func() {
+		<-ctx.Done()
+
+		if drainPeriod, err := cfg.DrainPeriodOrDefault(); err == nil && drainPeriod > 0 {
+			waitDrainPeriod(drainPeriod, sigChan)
+		}
+
+		stopServing()
+	}()
+
+	if cfg.Pushgateway != nil && cfg.Pushgateway.DisableHTTP {
+		logging.Info("not running HTTP server; metrics are only pushed to the Pushgateway")
+		<-serveCtx.Done()
+	} else if cfg.StatsD != nil && cfg.StatsD.DisableHTTP {
+		logging.Info("not running HTTP server; metrics are only sent to the StatsD server")
+		<-serveCtx.Done()
+	} else {
+		logging.Info("running HTTP server", "address", listenAddr, "endpoint", endpoint)
+		serveHTTP(serveCtx, listenAddr, &cfg.Listen)
+	}
+
+	close(stopChan)
+	stopHandlers.Wait()
+
+	stopSources()
+	namespaces.stopAll()
+
+	if starter.statsd != nil {
+		starter.statsd.close()
+	}
+
+	if meterProvider != nil {
+		shutdownOTLP(meterProvider)
+	}
+
+	if atomic.LoadInt32(&failed) == 1 {
+		os.Exit(1)
 	}
 }
 
+// waitDrainPeriod waits for the drain period to pass, unless another signal
+// is received in the meantime
+func waitDrainPeriod(drainPeriod time.Duration, sigChan <-chan os.Signal) {
+	logging.Info("processing log lines for a while before exiting", "drain_period", drainPeriod)
+
+	timer := time.NewTimer(drainPeriod)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case sig := <-sigChan:
+		logging.Info("caught another signal; exiting without waiting for the drain period", "signal", sig)
+	}
+}
+
+// serveHTTP runs the HTTP server until ctx is cancelled, or the server could
+// not be started
+func serveHTTP(ctx context.Context, listenAddr string, listenCfg *config.ListenConfig) {
+	server := &http.Server{Addr: listenAddr}
+	serverErr := make(chan error, 1)
+
+	go func() {
+		serverErr <- listenAndServe(server, listenCfg)
+	}()
+
+	select {
+	case err := <-serverErr:
+		logging.Error("error while starting HTTP server", "error", err)
+	case <-ctx.Done():
+		// let in-flight scrapes complete
+		shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), shutdownTimeout)
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			logging.Error("error while shutting down HTTP server", "error", err)
+		}
+		cancelShutdown()
+	}
+}
+
+// shutdownTimeout is the time that in-flight requests are given to complete
+// when the exporter shuts down
+const shutdownTimeout = 10 * time.Second
+
+// defaultListenPort returns the port that the HTTP server listens on unless
+// configured otherwise. Following the convention of many PaaS environments,
+// this is the value of the PORT environment variable, if set, and 4040
+// otherwise.
+func defaultListenPort() int {
+	if port, err := strconv.Atoi(os.Getenv("PORT")); err == nil && port > 0 {
+		return port
+	}
+
+	return 4040
+}
+
 func loadConfig(opts *config.StartupFlags, cfg *config.Config) {
 	if opts.ConfigFile != "" {
-		fmt.Printf("loading configuration file %s\n", opts.ConfigFile)
+		logging.Info("loading configuration file", "file", opts.ConfigFile)
 		if err := config.LoadConfigFromFile(cfg, opts.ConfigFile); err != nil {
-			panic(err)
+			exitWithError("could not load configuration file", "file", opts.ConfigFile, "error", err)
+		}
+
+		if opts.OneShot {
+			cfg.OneShot = true
 		}
 	} else if err := config.LoadConfigFromFlags(cfg, opts); err != nil {
-		panic(err)
+		exitWithError("invalid command line flags", "error", err)
+	}
+}
+
+// configureLogging applies the log_format and log_level options to the
+// exporter's own log messages; invalid values are reported when the
+// configuration is validated
+func configureLogging(cfg *config.Config) {
+	format, err := logging.ParseFormat(cfg.LogFormat)
+	if err != nil {
+		return
+	}
+
+	level, err := logging.ParseLevel(cfg.LogLevel)
+	if err != nil {
+		return
 	}
+
+	logging.Configure(format, level)
+}
+
+// exitWithError logs an error and exits the exporter with a non-zero exit
+// code; it is used for problems that prevent the exporter from starting
+func exitWithError(msg string, keyvals ...interface{}) {
+	logging.Error(msg, keyvals...)
+	os.Exit(1)
 }
 
-func setupConsul(cfg *config.Config, stopChan <-chan bool, stopHandlers *sync.WaitGroup) {
-	registrator, err := discovery.NewConsulRegistrator(cfg)
+// setupRegistration registers the exporter at the service discovery that is
+// enabled in the configuration (if any), and deregisters it again when the
+// exporter is stopped
+func setupRegistration(cfg *config.Config, stopChan <-chan bool, stopHandlers *sync.WaitGroup) {
+	var registrator discovery.Registrator
+	var name string
+	var err error
+
+	switch {
+	case cfg.Consul.Enable:
+		name = "Consul"
+		registrator, err = discovery.NewConsulRegistrator(cfg)
+	case cfg.Etcd.Enable:
+		name = "etcd"
+		registrator, err = discovery.NewEtcdRegistrator(cfg)
+	case cfg.Kubernetes.Enable:
+		name = "Kubernetes"
+		registrator, err = discovery.NewKubernetesRegistrator(cfg)
+	default:
+		return
+	}
+
 	if err != nil {
-		panic(err)
+		exitWithError("could not set up service registration", "registry", name, "error", err)
 	}
 
-	fmt.Printf("registering service in Consul\n")
-	if err := registrator.RegisterConsul(); err != nil {
-		panic(err)
+	logging.Info("registering service", "registry", name)
+	if err := registrator.Register(); err != nil {
+		exitWithError("could not register service", "registry", name, "error", err)
 	}
 
 	go func() {
 		<-stopChan
-		fmt.Printf("unregistering service in Consul\n")
+		logging.Info("unregistering service", "registry", name)
 
-		if err := registrator.UnregisterConsul(); err != nil {
-			fmt.Printf("error while unregistering from consul: %s\n", err.Error())
+		if err := registrator.Unregister(); err != nil {
+			logging.Error("error while unregistering service", "registry", name, "error", err)
 		}
 
 		stopHandlers.Done()
@@ -276,119 +1000,346 @@ func setupConsul(cfg *config.Config, stopChan <-chan bool, stopHandlers *sync.Wa
 	stopHandlers.Add(1)
 }
 
-func processNamespace(nsCfg config.NamespaceConfig, metrics *Metrics) {
-	var followers []tail.Follower
+// newFileFollower creates a Follower for a single log file; if the file is a
+// symbolic link, its target is followed as configured by the "symlinks"
+// source option. Other files stop being followed while they are idle if an
+// idleTracker is given. The file name "-" denotes the standard input.
+// Regular files that are neither are read from where the "read_from" source
+// option says (using the saved positions, if given). In one-shot mode, all
+// files are only read up to their end.
+func newFileFollower(filename string, nsCfg *config.NamespaceConfig, metrics *Metrics, idle *idleTracker, positions *savedPositions) (tail.Follower, error) {
+	if filename == config.StdinFilename {
+		logging.Info("reading log lines from standard input", "namespace", nsCfg.Name)
+		return tail.NewReaderFollower(os.Stdin), nil
+	}
 
-	parser := gonx.NewParser(nsCfg.Format)
+	if nsCfg.ReadOnce {
+		return tail.NewFileReader(filename)
+	}
 
-	for _, f := range nsCfg.SourceData.Files {
-		t, err := tail.NewFileFollower(f)
-		if err != nil {
-			panic(err)
+	opts := tailOptions(nsCfg)
+
+	if !tail.IsSymlink(filename) {
+		if idle != nil {
+			f, err := tail.NewIdleFollower(filename, nsCfg.IdleTimeoutDuration, idleCheckInterval, idle.onIdle(filename), idle.onResume(filename), opts)
+			if err == nil {
+				idle.addSource()
+			}
+			return f, err
 		}
 
-		t.OnError(func(err error) {
-			panic(err)
-		})
+		switch {
+		case positions != nil:
+			return tail.NewFileFollowerAt(filename, positions.offset(filename), opts)
+		case nsCfg.SourceData.ReadFrom == "beginning":
+			return tail.NewFileFollowerAt(filename, 0, opts)
+		}
 
-		followers = append(followers, t)
+		return tail.NewFileFollowerAt(filename, tail.EndOfFile, opts)
 	}
 
-	if nsCfg.SourceData.Syslog != nil {
-		slCfg := nsCfg.SourceData.Syslog
+	pin := nsCfg.SourceData.Symlinks == "pin"
 
-		fmt.Printf("running Syslog server on address %s\n", slCfg.ListenAddress)
-		channel, server, err := syslog.Listen(slCfg.ListenAddress, slCfg.Format)
-		if err != nil {
-			panic(err)
-		}
+	return tail.NewSymlinkFollower(filename, pin, func(target string) {
+		logging.Info("symbolic link was repointed", "namespace", nsCfg.Name, "file", filename, "target", target)
+		metrics.symlinkRepoints.WithLabelValues(filename).Inc()
+	}, opts)
+}
 
-		for _, f := range slCfg.Tags {
-			t, err := tail.NewSyslogFollower(f, server, channel)
-			if err != nil {
-				panic(err)
-			}
+// tailErrorHandler returns the handler for errors while following the log
+// file (or directory) source. These errors are logged and counted; files that
+// could not be read any further are no longer counted as followed. In
+// one-shot mode, they stop the exporter instead, since it would otherwise
+// exit as if all files were read successfully.
+func tailErrorHandler(source string, nsCfg *config.NamespaceConfig, metrics *Metrics) func(error) {
+	return func(err error) {
+		if nsCfg.ReadOnce {
+			exitWithError("error while reading log source", "namespace", nsCfg.Name, "file", source, "error", err)
+		}
 
-			t.OnError(func(err error) {
-				panic(err)
-			})
+		logging.Error("error while following log source", "namespace", nsCfg.Name, "file", source, "error", err)
+		metrics.tailErrorsTotal.Inc()
+	}
+}
 
-			followers = append(followers, t)
-		}
+// tailOptions returns the options that the log files of a namespace are
+// followed with
+func tailOptions(nsCfg *config.NamespaceConfig) tail.Options {
+	return tail.Options{
+		Poll:   nsCfg.Tail.PollEnabled(),
+		ReOpen: nsCfg.Tail.ReOpenEnabled(),
 	}
+}
+
+// multilineFlushAfter is the time after which a multi-line log entry is
+// considered complete if no further line was read
+const multilineFlushAfter = time.Second
 
-	for _, f := range followers {
-		go processSource(nsCfg, f, parser, metrics)
+// source is a followed log source, together with the processor for its lines
+type source struct {
+	name      string
+	open      func() (tail.Follower, error)
+	onError   func(error)
+	processor *lineProcessor
+}
+
+// followed returns a function that opens a log source whose follower was
+// already created
+func followed(f tail.Follower) func() (tail.Follower, error) {
+	return func() (tail.Follower, error) {
+		return f, nil
 	}
+}
 
+// openRetryBackoff is the time after which opening a log source is retried
+// when it failed; it doubles with every failed attempt, up to
+// maxOpenRetryBackoff
+const (
+	openRetryBackoff    = time.Second
+	maxOpenRetryBackoff = time.Minute
+)
+
+// reopenSource retries opening a log source that could not be opened, with an
+// increasing backoff, until it succeeds; every failed attempt is reported to
+// the source's error handler. If ctx is cancelled first, nil is returned.
+func reopenSource(ctx context.Context, s source, backoff time.Duration, maxBackoff time.Duration) tail.Follower {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(backoff):
+		}
+
+		f, err := s.open()
+		if err == nil {
+			logging.Info("opened log source", "file", s.name)
+			return f
+		}
+
+		s.onError(err)
+
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
 }
 
-func processSource(nsCfg config.NamespaceConfig, t tail.Follower, parser *gonx.Parser, metrics *Metrics) {
-	relabelings := relabeling.NewRelabelings(nsCfg.RelabelConfigs)
-	relabelings = append(relabelings, relabeling.DefaultRelabelings...)
-	relabelings = relabeling.UniqueRelabelings(relabelings)
+// expandFilePatterns expands all glob patterns in a list of files. Patterns
+// that match no file (yet) are kept as they are, so that they are followed
+// once the file is created.
+func expandFilePatterns(patterns []string) ([]string, error) {
+	var files []string
 
-	staticLabelValues := nsCfg.OrderedLabelValues
+	for _, p := range patterns {
+		matches, err := filepath.Glob(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid file pattern '%s': %s", p, err.Error())
+		}
 
-	totalLabelCount := len(staticLabelValues) + len(relabelings)
-	relabelLabelOffset := len(staticLabelValues)
-	labelValues := make([]string, totalLabelCount)
+		if len(matches) == 0 {
+			files = append(files, p)
+			continue
+		}
 
-	for i := range staticLabelValues {
-		labelValues[i] = staticLabelValues[i]
+		files = append(files, matches...)
 	}
 
-	for line := range t.Lines() {
-		if nsCfg.PrintLog {
-			fmt.Println(line)
+	return files, nil
+}
+
+// processNamespace starts following all log sources of a namespace. They are
+// processed until ctx is cancelled; stopped is done once all of them were
+// stopped. The first returned channel is closed once all sources have been
+// opened, the second one once all sources reached their end (which only
+// happens for sources that are read once) and all of their lines were
+// processed. Log sources that cannot be opened are opened again later (see
+// reopenSource); only if the namespace cannot be started at all (for example,
+// because its GeoIP database cannot be read), an error is returned.
+func processNamespace(ctx context.Context, nsCfg config.NamespaceConfig, metrics *Metrics, pool *workerPool, debugLines *lineRing, stopped *sync.WaitGroup) (<-chan struct{}, <-chan struct{}, error) {
+	var sources []source
+
+	processor := newLineProcessor(&nsCfg, metrics)
+	processor.debugLines = debugLines
+
+	if nsCfg.GeoIP != nil {
+		geoIP, err := newGeoIPLookup(nsCfg.GeoIP)
+		if err != nil {
+			return nil, nil, fmt.Errorf("geoip: %s", err.Error())
 		}
 
-		entry, err := parser.ParseString(line)
+		processor.geoIP = geoIP
+	}
+
+	logging.Info("reading response sizes", "namespace", nsCfg.Name, "field", processor.bytesField)
+
+	var idle *idleTracker
+	if nsCfg.IdleTimeoutDuration > 0 {
+		idle = &idleTracker{namespace: nsCfg.Name, metrics: metrics, reset: nsCfg.IdleResetMetrics}
+	}
+
+	var positions *savedPositions
+	if nsCfg.SourceData.ReadFrom == "saved" {
+		p, err := loadSavedPositions(nsCfg.SourceData.PositionsFile)
 		if err != nil {
-			fmt.Printf("error while parsing line '%s': %s\n", line, err)
-			metrics.parseErrorsTotal.Inc()
-			continue
+			return nil, nil, fmt.Errorf("positions_file: %s", err.Error())
 		}
 
-		fields := entry.Fields()
+		positions = p
+	}
 
-		for i := range relabelings {
-			if str, ok := fields[relabelings[i].SourceValue]; ok {
-				mapped, err := relabelings[i].Map(str)
-				if err == nil {
-					labelValues[i+relabelLabelOffset] = mapped
-				}
-			}
+	fileSource := func(filename string, p *lineProcessor) source {
+		return source{
+			name: filename,
+			open: func() (tail.Follower, error) {
+				return newFileFollower(filename, &nsCfg, metrics, idle, positions)
+			},
+			onError:   tailErrorHandler(filename, &nsCfg, metrics),
+			processor: p.forSource(filename),
 		}
+	}
+
+	files, watchedDirectories := nsCfg.SourceData.FilePatterns()
+
+	expanded, err := expandFilePatterns(files)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, f := range expanded {
+		sources = append(sources, fileSource(f, processor))
+	}
 
-		metrics.countTotal.WithLabelValues(labelValues...).Inc()
+	for i := range nsCfg.SourceData.FileGroups {
+		g := &nsCfg.SourceData.FileGroups[i]
+		groupProcessor := processor.withStaticLabels(nsCfg.FileGroupLabelValues(g))
 
-		if bytes, ok := floatFromFields(fields, "body_bytes_sent"); ok {
-			metrics.bytesTotal.WithLabelValues(labelValues...).Add(bytes)
+		expanded, err := expandFilePatterns(g.Files)
+		if err != nil {
+			return nil, nil, err
 		}
 
-		if upstreamTime, ok := floatFromFields(fields, "upstream_response_time"); ok {
-			metrics.upstreamSeconds.WithLabelValues(labelValues...).Observe(upstreamTime)
-			metrics.upstreamSecondsHist.WithLabelValues(labelValues...).Observe(upstreamTime)
+		for _, f := range expanded {
+			sources = append(sources, fileSource(f, groupProcessor))
 		}
+	}
+
+	for _, d := range append(watchedDirectories, nsCfg.SourceData.Directories...) {
+		d := d
+		logging.Info("watching directory", "namespace", nsCfg.Name, "directory", d.Path, "pattern", d.Pattern)
+
+		sources = append(sources, source{
+			name: d.Path,
+			open: func() (tail.Follower, error) {
+				return tail.NewDirectoryFollower(d.Path, d.Pattern, tailOptions(&nsCfg))
+			},
+			onError:   tailErrorHandler(d.Path, &nsCfg, metrics),
+			processor: processor.forSource(filepath.Join(d.Path, d.Pattern)),
+		})
+	}
+
+	if nsCfg.SourceData.Syslog != nil {
+		slCfg := nsCfg.SourceData.Syslog
 
-		if responseTime, ok := floatFromFields(fields, "request_time"); ok {
-			metrics.responseSeconds.WithLabelValues(labelValues...).Observe(responseTime)
-			metrics.responseSecondsHist.WithLabelValues(labelValues...).Observe(responseTime)
+		logging.Info("running Syslog server", "namespace", nsCfg.Name, "addresses", strings.Join(slCfg.Addresses(), ","))
+		channel, server, err := syslog.Listen(slCfg.Addresses(), slCfg.Format)
+		if err != nil {
+			return nil, nil, fmt.Errorf("syslog: %s", err.Error())
+		}
+
+		// free the listen addresses, so that they can be used again when the
+		// namespace is restarted
+		go func() {
+			<-ctx.Done()
+			if err := server.Kill(); err != nil {
+				logging.Error("error while stopping Syslog server", "namespace", nsCfg.Name, "error", err)
+			}
+		}()
+
+		for _, tag := range slCfg.Tags {
+			t, err := tail.NewSyslogFollower(tag, server, channel)
+			if err != nil {
+				return nil, nil, fmt.Errorf("syslog: %s", err.Error())
+			}
+
+			sources = append(sources, source{
+				name:      "syslog",
+				open:      followed(t),
+				onError:   tailErrorHandler("syslog", &nsCfg, metrics),
+				processor: processor,
+			})
 		}
 	}
-}
 
-func floatFromFields(fields gonx.Fields, name string) (float64, bool) {
-	val, ok := fields[name]
-	if !ok {
-		return 0, false
+	if c := nsCfg.WorkerPool; c != nil && c.Size > 0 {
+		logging.Info("starting worker pool", "namespace", nsCfg.Name, "workers", c.Size)
+		pool = newWorkerPool(c.Size, c.QueueSize)
+		pool.dropWhenFull = c.DropWhenFull
 	}
 
-	f, err := strconv.ParseFloat(val, 64)
-	if err != nil {
-		return 0, false
+	sourcesOpened := sync.WaitGroup{}
+	sourcesStopped := sync.WaitGroup{}
+
+	for _, s := range sources {
+		f, err := s.open()
+		if err != nil {
+			s.onError(err)
+		}
+
+		stopped.Add(1)
+		sourcesOpened.Add(1)
+		sourcesStopped.Add(1)
+		go func(s source, f tail.Follower) {
+			defer stopped.Done()
+			defer sourcesStopped.Done()
+
+			if f == nil {
+				f = reopenSource(ctx, s, openRetryBackoff, maxOpenRetryBackoff)
+			}
+
+			sourcesOpened.Done()
+			if f == nil {
+				return
+			}
+
+			f.OnError(s.onError)
+			metrics.filePositions.add(f)
+			metrics.followedFiles.add(f)
+
+			if nsCfg.Multiline != nil {
+				f = tail.NewMultilineFollower(f, nsCfg.Multiline.CompiledStartPattern, multilineFlushAfter)
+			}
+
+			processSource(ctx, f, s.processor, pool)
+		}(s, f)
+	}
+
+	opened := make(chan struct{})
+	go func() {
+		sourcesOpened.Wait()
+		close(opened)
+	}()
+
+	// the worker pool of the namespace processes the remaining queued lines
+	// once all sources were stopped
+	drained := make(chan struct{})
+	stopped.Add(1)
+	go func() {
+		sourcesStopped.Wait()
+		if nsCfg.WorkerPool != nil && nsCfg.WorkerPool.Size > 0 {
+			pool.stop()
+		}
+
+		close(drained)
+		stopped.Done()
+	}()
+
+	if positions != nil {
+		stopped.Add(1)
+		go func() {
+			savePositionsPeriodically(ctx, positions, metrics.filePositions)
+			stopped.Done()
+		}()
 	}
 
-	return f, true
+	return opened, drained, nil
 }
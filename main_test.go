@@ -0,0 +1,161 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/config"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewNSMetricsReturnsErrorOnInvalidMetrics(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.NamespaceConfig{
+		Name:   "test",
+		Labels: map[string]string{"status": "conflicts-with-status-label"},
+	}
+
+	m, err := NewNSMetrics(&cfg)
+
+	assert.NotNil(t, err)
+	assert.Nil(t, m)
+}
+
+func TestNewNSMetricsRegistersMetrics(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.NamespaceConfig{
+		Name: "test",
+	}
+
+	m, err := NewNSMetrics(&cfg)
+
+	assert.Nil(t, err)
+	assert.NotNil(t, m)
+}
+
+func TestNewNSMetricsRegistersCompatMetrics(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.NamespaceConfig{
+		Name:   "test",
+		Compat: map[string]string{"legacy_requests": "http_response_count_total"},
+	}
+
+	m, err := NewNSMetrics(&cfg)
+	require.Nil(t, err)
+
+	m.countTotal.WithLabelValues("GET", "200").Add(3)
+
+	families, err := m.registry.Gather()
+	require.Nil(t, err)
+
+	var found bool
+	for _, f := range families {
+		if f.GetName() == "legacy_requests" {
+			found = true
+			assert.Equal(t, dto.MetricType_UNTYPED, f.GetType())
+			require.Len(t, f.Metric, 1)
+			assert.Equal(t, 3.0, f.Metric[0].GetUntyped().GetValue())
+		}
+	}
+
+	assert.True(t, found)
+}
+
+func TestNewNSMetricsReturnsErrorOnUnknownCompatMetric(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.NamespaceConfig{
+		Name:   "test",
+		Compat: map[string]string{"legacy_requests": "does_not_exist"},
+	}
+
+	_, err := NewNSMetrics(&cfg)
+	assert.NotNil(t, err)
+}
+
+func TestCompatCollectorReportsInvalidNamesOnGather(t *testing.T) {
+	t.Parallel()
+
+	counter := prometheus.NewCounter(prometheus.CounterOpts{Name: "test_total", Help: "test"})
+	registry := prometheus.NewRegistry()
+	require.Nil(t, registry.Register(newCompatCollector("legacy-requests", "test_total", counter)))
+
+	assert.NotPanics(t, func() {
+		_, err := registry.Gather()
+		assert.NotNil(t, err)
+	})
+}
+
+func TestDefaultListenPortIsReadFromEnvironment(t *testing.T) {
+	defer os.Setenv("PORT", os.Getenv("PORT"))
+
+	os.Setenv("PORT", "8080")
+	assert.Equal(t, 8080, defaultListenPort())
+
+	os.Setenv("PORT", "")
+	assert.Equal(t, 4040, defaultListenPort())
+
+	os.Setenv("PORT", "foo")
+	assert.Equal(t, 4040, defaultListenPort())
+}
+
+func TestShadowNamespaceOnlyCountsParsedLines(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.NamespaceConfig{
+		Name:           "test",
+		Format:         "[$time_local] $request $status",
+		Shadow:         true,
+		RequestsByHour: true,
+	}
+	require.Nil(t, cfg.Compile())
+
+	m, err := NewNSMetrics(&cfg)
+	require.Nil(t, err)
+
+	p := newLineProcessor(&cfg, &m.Metrics)
+	p.processLine("[23/Jun/2016:16:04:20 +0200] GET / HTTP/1.1 200")
+	p.processLine("not an access log line")
+
+	families, err := m.registry.Gather()
+	require.Nil(t, err)
+
+	values := map[string]float64{}
+	for _, f := range families {
+		assert.NotContains(t, f.GetName(), "http_", "shadow namespaces must not export request metrics")
+
+		if f.GetType() == dto.MetricType_COUNTER && len(f.Metric) == 1 {
+			values[f.GetName()] = f.Metric[0].GetCounter().GetValue()
+		}
+	}
+
+	assert.Equal(t, 1.0, values["test_parsed_lines_total"])
+	assert.Equal(t, 1.0, values["test_parse_errors_total"])
+
+	// the request metrics are neither registered nor updated
+	assert.Equal(t, 0, testutil.CollectAndCount(m.countTotal))
+	assert.Equal(t, 0, testutil.CollectAndCount(m.requestsByHour))
+}
+
+func TestWaitDrainPeriodEndsOnAnotherSignal(t *testing.T) {
+	t.Parallel()
+
+	sigChan := make(chan os.Signal, 1)
+	sigChan <- os.Interrupt
+
+	start := time.Now()
+	waitDrainPeriod(time.Minute, sigChan)
+	assert.Less(t, time.Since(start), 10*time.Second)
+
+	start = time.Now()
+	waitDrainPeriod(50*time.Millisecond, sigChan)
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+}
@@ -0,0 +1,161 @@
+/*
+ * Copyright 2019 Martin Helmich <martin@helmich.me>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/config"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// metricNameLabel is the label that contains the metric name during metric
+// relabeling
+const metricNameLabel = "__name__"
+
+// metricRelabelGatherer applies the metric_relabel configurations of a
+// namespace to all series that are gathered from the namespace's registry.
+// Series may be dropped, or their labels (including names) changed; series
+// whose metric names were changed are moved into the respective metric
+// family.
+type metricRelabelGatherer struct {
+	gatherer prometheus.Gatherer
+	configs  []config.MetricRelabelConfig
+}
+
+func newMetricRelabelGatherer(gatherer prometheus.Gatherer, configs []config.MetricRelabelConfig) *metricRelabelGatherer {
+	return &metricRelabelGatherer{gatherer: gatherer, configs: configs}
+}
+
+func (g *metricRelabelGatherer) Gather() ([]*dto.MetricFamily, error) {
+	families, err := g.gatherer.Gather()
+	if err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string]*dto.MetricFamily)
+
+	for _, family := range families {
+		for _, metric := range family.Metric {
+			labels := make(map[string]string, len(metric.Label)+1)
+			for _, l := range metric.Label {
+				labels[l.GetName()] = l.GetValue()
+			}
+			labels[metricNameLabel] = family.GetName()
+
+			if !relabelMetric(labels, g.configs) {
+				continue
+			}
+
+			name := labels[metricNameLabel]
+			delete(labels, metricNameLabel)
+
+			if name == "" {
+				continue
+			}
+
+			target, ok := byName[name]
+			if !ok {
+				target = &dto.MetricFamily{Name: proto.String(name), Help: family.Help, Type: family.Type}
+				byName[name] = target
+			} else if target.GetType() != family.GetType() {
+				return nil, fmt.Errorf("metric relabeling moved series of different types into metric '%s'", name)
+			}
+
+			metric.Label = labelPairs(labels)
+			target.Metric = append(target.Metric, metric)
+		}
+	}
+
+	result := make([]*dto.MetricFamily, 0, len(byName))
+	for _, family := range byName {
+		result = append(result, family)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].GetName() < result[j].GetName()
+	})
+
+	return result, nil
+}
+
+// relabelMetric applies metric relabel configurations to the labels of a
+// single series, and returns false if the series should be dropped
+func relabelMetric(labels map[string]string, configs []config.MetricRelabelConfig) bool {
+	for i := range configs {
+		c := &configs[i]
+
+		values := make([]string, len(c.SourceLabels))
+		for j, name := range c.SourceLabels {
+			values[j] = labels[name]
+		}
+		value := strings.Join(values, *c.Separator)
+
+		switch c.Action {
+		case "keep":
+			if !c.CompiledRegex.MatchString(value) {
+				return false
+			}
+		case "drop":
+			if c.CompiledRegex.MatchString(value) {
+				return false
+			}
+		case "replace":
+			match := c.CompiledRegex.FindStringSubmatchIndex(value)
+			if match == nil {
+				continue
+			}
+
+			replaced := string(c.CompiledRegex.ExpandString(nil, *c.Replacement, value, match))
+			if replaced == "" {
+				delete(labels, c.TargetLabel)
+			} else {
+				labels[c.TargetLabel] = replaced
+			}
+		case "labelkeep", "labeldrop":
+			for name := range labels {
+				if name == metricNameLabel {
+					continue
+				}
+
+				if c.CompiledRegex.MatchString(name) != (c.Action == "labelkeep") {
+					delete(labels, name)
+				}
+			}
+		}
+	}
+
+	return true
+}
+
+// labelPairs converts a label set into label pairs, sorted by label name
+func labelPairs(labels map[string]string) []*dto.LabelPair {
+	pairs := make([]*dto.LabelPair, 0, len(labels))
+	for name, value := range labels {
+		pairs = append(pairs, &dto.LabelPair{Name: proto.String(name), Value: proto.String(value)})
+	}
+
+	sort.Slice(pairs, func(i, j int) bool {
+		return pairs[i].GetName() < pairs[j].GetName()
+	})
+
+	return pairs
+}
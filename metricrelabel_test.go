@@ -0,0 +1,58 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricRelabelGathererDropsAndRenamesSeries(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.NamespaceConfig{
+		Name:   "test",
+		Format: "$request $status $body_bytes_sent",
+		MetricRelabelConfigs: []config.MetricRelabelConfig{
+			{Action: "drop", SourceLabels: []string{"__name__"}, Regex: "test_http_response_size_bytes"},
+			{Action: "replace", SourceLabels: []string{"status"}, Regex: "(\\d)\\d\\d", Replacement: strPtr("${1}xx"), TargetLabel: "class"},
+			{Action: "labeldrop", Regex: "status"},
+			{Action: "replace", SourceLabels: []string{"__name__"}, Regex: "test_(.*)", Replacement: strPtr("nginx_$1"), TargetLabel: "__name__"},
+		},
+	}
+
+	m, err := NewNSMetrics(&cfg)
+	require.Nil(t, err)
+
+	p := newLineProcessor(&cfg, &m.Metrics)
+	p.processLine("GET 200 10")
+
+	families, err := newMetricRelabelGatherer(m.registry, cfg.MetricRelabelConfigs).Gather()
+	require.Nil(t, err)
+
+	names := make(map[string]bool)
+	for _, f := range families {
+		names[f.GetName()] = true
+		assert.NotEqual(t, "nginx_http_response_size_bytes", f.GetName())
+
+		if f.GetName() == "nginx_http_response_count_total" {
+			require.Len(t, f.Metric, 1)
+
+			labels := make(map[string]string)
+			for _, l := range f.Metric[0].Label {
+				labels[l.GetName()] = l.GetValue()
+			}
+
+			assert.Equal(t, map[string]string{"method": "GET", "class": "2xx"}, labels)
+			assert.Equal(t, 1.0, f.Metric[0].Counter.GetValue())
+		}
+	}
+
+	assert.Contains(t, names, "nginx_http_response_count_total")
+	assert.Contains(t, names, "nginx_parse_errors_total")
+}
+
+func strPtr(s string) *string {
+	return &s
+}
@@ -0,0 +1,345 @@
+/*
+ * Copyright 2019 Martin Helmich <martin@helmich.me>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"reflect"
+	"sync"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/config"
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/logging"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// runningNamespace is a namespace whose log sources are being processed
+type runningNamespace struct {
+	cfg        *config.NamespaceConfig
+	gatherer   prometheus.Gatherer
+	debugLines *lineRing
+
+	cancel  context.CancelFunc
+	started chan struct{}
+	stopped sync.WaitGroup
+
+	// opened is closed once all log sources have been opened (at least
+	// once), and drained once all of them reached their end (see
+	// processNamespace); err is the error that prevented the namespace from
+	// being started, if any. All of them are set before started is closed.
+	opened  <-chan struct{}
+	drained <-chan struct{}
+	err     error
+}
+
+// stop stops processing the log sources of the namespace, and waits until all
+// of them were stopped
+func (n *runningNamespace) stop() {
+	n.cancel()
+	<-n.started
+	n.stopped.Wait()
+}
+
+// changed returns true if a namespace would be configured differently by cfg
+func (n *runningNamespace) changed(cfg config.NamespaceConfig, instanceLabels map[string]string) bool {
+	cfg.InstanceLabels = instanceLabels
+	if err := cfg.Compile(); err != nil {
+		return true
+	}
+
+	return !reflect.DeepEqual(n.cfg, &cfg)
+}
+
+// namespaceStarter starts namespaces, using the settings that are shared by
+// all of them
+type namespaceStarter struct {
+	ctx            context.Context
+	pool           *workerPool
+	instanceLabels map[string]string
+	debugLines     *config.DebugLinesConfig
+	oneShot        bool
+	statsd         *statsdClient
+	meterProvider  metric.MeterProvider
+}
+
+// start creates the metrics of a namespace and starts processing its log
+// sources, until the starter's context is cancelled or the namespace is
+// stopped
+func (s *namespaceStarter) start(cfg config.NamespaceConfig) (*runningNamespace, error) {
+	cfg.InstanceLabels = s.instanceLabels
+	cfg.ReadOnce = s.oneShot
+
+	nsMetrics, err := NewNSMetrics(&cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.statsd != nil {
+		nsMetrics.statsd = newStatsDMetrics(s.statsd, &cfg)
+	}
+
+	if s.meterProvider != nil {
+		if nsMetrics.otlp, err = newOTLPMetrics(s.meterProvider.Meter(otlpMeterName), &cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	n := &runningNamespace{
+		cfg:      &cfg,
+		gatherer: nsMetrics.registry,
+		cancel:   cancel,
+		started:  make(chan struct{}),
+	}
+
+	if len(cfg.MetricRelabelConfigs) > 0 {
+		n.gatherer = newMetricRelabelGatherer(nsMetrics.registry, cfg.MetricRelabelConfigs)
+	}
+
+	if s.debugLines != nil && s.debugLines.Size > 0 {
+		n.debugLines = newLineRing(s.debugLines.Size)
+	}
+
+	logging.Info("starting listener", "namespace", cfg.Name)
+
+	go func() {
+		opened, drained, err := processNamespace(ctx, cfg, &nsMetrics.Metrics, s.pool, n.debugLines, &n.stopped)
+		if err != nil {
+			logging.Error("could not start namespace", "namespace", cfg.Name, "error", err)
+
+			closed := make(chan struct{})
+			close(closed)
+			opened, drained = closed, closed
+		}
+
+		n.opened, n.drained, n.err = opened, drained, err
+		close(n.started)
+	}()
+
+	return n, nil
+}
+
+// namespaceSet contains all running namespaces. It gathers the metrics of all
+// of them, so that namespaces can be replaced while the metrics are served.
+type namespaceSet struct {
+	mutex      sync.RWMutex
+	names      []string
+	namespaces map[string]*runningNamespace
+}
+
+func newNamespaceSet() *namespaceSet {
+	return &namespaceSet{namespaces: make(map[string]*runningNamespace)}
+}
+
+// add adds a running namespace to the set
+func (s *namespaceSet) add(name string, n *runningNamespace) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.names = append(s.names, name)
+	s.namespaces[name] = n
+}
+
+// Gather implements prometheus.Gatherer
+func (s *namespaceSet) Gather() ([]*dto.MetricFamily, error) {
+	s.mutex.RLock()
+	gatherers := make(prometheus.Gatherers, 0, len(s.names))
+	for _, name := range s.names {
+		gatherers = append(gatherers, s.namespaces[name].gatherer)
+	}
+	s.mutex.RUnlock()
+
+	return gatherers.Gather()
+}
+
+// lineRing returns the retained log lines of a namespace, or nil if the
+// namespace does not exist (or retains no lines)
+func (s *namespaceSet) lineRing(name string) *lineRing {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if n, ok := s.namespaces[name]; ok {
+		return n.debugLines
+	}
+
+	return nil
+}
+
+// waitStarted waits until all namespaces have been started; log sources that
+// could not be opened right away may still be retried (see waitOpened)
+func (s *namespaceSet) waitStarted() {
+	s.mutex.RLock()
+	namespaces := make([]*runningNamespace, 0, len(s.namespaces))
+	for _, n := range s.namespaces {
+		namespaces = append(namespaces, n)
+	}
+	s.mutex.RUnlock()
+
+	for _, n := range namespaces {
+		<-n.started
+	}
+}
+
+// failed returns true if any namespace could not be started; it must only be
+// called once all namespaces were started (see waitStarted)
+func (s *namespaceSet) failed() bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	for _, n := range s.namespaces {
+		if n.err != nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// waitOpened waits until all log sources of all namespaces have been opened,
+// or ctx is cancelled; it returns false in the latter case
+func (s *namespaceSet) waitOpened(ctx context.Context) bool {
+	s.mutex.RLock()
+	namespaces := make([]*runningNamespace, 0, len(s.namespaces))
+	for _, n := range s.namespaces {
+		namespaces = append(namespaces, n)
+	}
+	s.mutex.RUnlock()
+
+	for _, n := range namespaces {
+		select {
+		case <-n.started:
+		case <-ctx.Done():
+			return false
+		}
+
+		select {
+		case <-n.opened:
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	return true
+}
+
+// waitDrained waits until all log sources of all namespaces reached their end,
+// and all of their lines were processed
+func (s *namespaceSet) waitDrained() {
+	s.mutex.RLock()
+	namespaces := make([]*runningNamespace, 0, len(s.namespaces))
+	for _, n := range s.namespaces {
+		namespaces = append(namespaces, n)
+	}
+	s.mutex.RUnlock()
+
+	for _, n := range namespaces {
+		<-n.started
+		<-n.drained
+	}
+}
+
+// stopAll stops all namespaces, and waits until all of their log sources
+// were stopped
+func (s *namespaceSet) stopAll() {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	for _, n := range s.namespaces {
+		n.stop()
+	}
+}
+
+// replace replaces the running namespaces by the given ones. Namespaces whose
+// configuration did not change keep running (and keep their metrics); all
+// other namespaces are stopped, and started again with their new
+// configuration. If the new configuration of a namespace is invalid, it keeps
+// running with its previous configuration.
+func (s *namespaceSet) replace(cfgs []config.NamespaceConfig, starter *namespaceStarter) {
+	s.mutex.RLock()
+	current := make(map[string]*runningNamespace, len(s.namespaces))
+	for name, n := range s.namespaces {
+		current[name] = n
+	}
+	s.mutex.RUnlock()
+
+	names := make([]string, 0, len(cfgs))
+	next := make(map[string]*runningNamespace, len(cfgs))
+
+	for _, cfg := range cfgs {
+		old, exists := current[cfg.Name]
+		delete(current, cfg.Name)
+
+		if exists && !old.changed(cfg, starter.instanceLabels) {
+			names, next[cfg.Name] = append(names, cfg.Name), old
+			continue
+		}
+
+		check := cfg
+		if err := check.Compile(); err != nil {
+			logging.Error("configuration of namespace is invalid; keeping it unchanged", "namespace", cfg.Name, "error", err)
+			if exists {
+				names, next[cfg.Name] = append(names, cfg.Name), old
+			}
+			continue
+		}
+
+		if exists {
+			logging.Info("configuration of namespace changed; restarting it", "namespace", cfg.Name)
+			old.stop()
+		}
+
+		n, err := starter.start(cfg)
+		if err != nil {
+			logging.Error("could not register metrics for namespace; skipping it", "namespace", cfg.Name, "error", err)
+			continue
+		}
+
+		names, next[cfg.Name] = append(names, cfg.Name), n
+	}
+
+	// namespaces that are not configured anymore
+	for name, n := range current {
+		logging.Info("namespace was removed; stopping it", "namespace", name)
+		n.stop()
+	}
+
+	s.mutex.Lock()
+	s.names = names
+	s.namespaces = next
+	s.mutex.Unlock()
+}
+
+// reloadConfig reads the configuration file again and replaces the running
+// namespaces accordingly (see namespaceSet.replace). All other settings are
+// only read when the exporter starts.
+func reloadConfig(filename string, starter *namespaceStarter, namespaces *namespaceSet) {
+	logging.Info("reloading configuration file", "file", filename)
+
+	var cfg config.Config
+	if err := config.LoadConfigFromFile(&cfg, filename); err != nil {
+		logging.Error("could not reload configuration file", "file", filename, "error", err)
+		return
+	}
+
+	if err := cfg.Validate(); err != nil {
+		logging.Error("could not reload configuration file; it is invalid", "file", filename, "error", err)
+		return
+	}
+
+	namespaces.replace(cfg.Namespaces, starter)
+}
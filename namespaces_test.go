@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNamespaceSetReplaceRestartsOnlyChangedNamespaces(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	starter := &namespaceStarter{ctx: ctx}
+	namespaces := newNamespaceSet()
+
+	for _, ns := range []config.NamespaceConfig{
+		{Name: "unchanged", Format: "$request $status"},
+		{Name: "changed", Format: "$request $status"},
+		{Name: "removed", Format: "$request $status"},
+	} {
+		n, err := starter.start(ns)
+		require.Nil(t, err)
+		namespaces.add(ns.Name, n)
+	}
+	namespaces.waitStarted()
+
+	unchanged := namespaces.namespaces["unchanged"]
+	changed := namespaces.namespaces["changed"]
+	removed := namespaces.namespaces["removed"]
+
+	namespaces.replace([]config.NamespaceConfig{
+		{Name: "unchanged", Format: "$request $status"},
+		{Name: "changed", Format: "$request $status $body_bytes_sent"},
+		{Name: "added", Format: "$request $status"},
+	}, starter)
+
+	assert.Equal(t, []string{"unchanged", "changed", "added"}, namespaces.names)
+	assert.True(t, unchanged == namespaces.namespaces["unchanged"])
+	assert.False(t, changed == namespaces.namespaces["changed"])
+	assert.NotNil(t, namespaces.namespaces["added"])
+
+	for _, n := range []*runningNamespace{changed, removed} {
+		select {
+		case <-n.started:
+		default:
+			t.Errorf("namespace was not stopped")
+		}
+	}
+
+	_, err := namespaces.Gather()
+	assert.Nil(t, err)
+}
+
+func TestNamespaceSetReplaceKeepsNamespaceWithInvalidConfig(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	starter := &namespaceStarter{ctx: ctx}
+	namespaces := newNamespaceSet()
+
+	n, err := starter.start(config.NamespaceConfig{Name: "app", Format: "$request $status"})
+	require.Nil(t, err)
+	namespaces.add("app", n)
+
+	namespaces.replace([]config.NamespaceConfig{
+		{Name: "app", Format: "$request $status", MissingRequest: "invalid"},
+	}, starter)
+
+	assert.True(t, n == namespaces.namespaces["app"])
+}
+
+func TestNamespaceSetReportsNamespacesThatCouldNotBeStarted(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	starter := &namespaceStarter{ctx: ctx}
+	namespaces := newNamespaceSet()
+
+	n, err := starter.start(config.NamespaceConfig{Name: "app", Format: "$request $status"})
+	require.Nil(t, err)
+	namespaces.add("app", n)
+
+	namespaces.waitStarted()
+	assert.False(t, namespaces.failed())
+
+	n, err = starter.start(config.NamespaceConfig{
+		Name:   "geo",
+		Format: "$remote_addr $request $status",
+		GeoIP:  &config.GeoIPConfig{Database: "/does/not/exist.mmdb"},
+	})
+	require.Nil(t, err)
+	namespaces.add("geo", n)
+
+	namespaces.waitStarted()
+	assert.True(t, namespaces.failed())
+
+	// namespaces that could not be started do not block waiting for the end
+	// of their log sources
+	<-n.drained
+}
+
+func TestNamespaceSetWaitsUntilAllSourcesWereOpened(t *testing.T) {
+	t.Parallel()
+
+	tmp, err := ioutil.TempDir("", "nginxlog-exporter")
+	require.Nil(t, err)
+	defer os.RemoveAll(tmp)
+
+	dir := filepath.Join(tmp, "logs")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	starter := &namespaceStarter{ctx: ctx}
+	namespaces := newNamespaceSet()
+
+	n, err := starter.start(config.NamespaceConfig{
+		Name:       "app",
+		Format:     "$request $status",
+		SourceData: config.SourceData{Directories: []config.DirectorySource{{Path: dir, Pattern: "*.log"}}},
+	})
+	require.Nil(t, err)
+	namespaces.add("app", n)
+
+	namespaces.waitStarted()
+	require.False(t, namespaces.failed())
+
+	// the directory does not exist yet, so opening it is retried
+	waitCtx, cancelWait := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancelWait()
+	assert.False(t, namespaces.waitOpened(waitCtx))
+
+	require.Nil(t, os.Mkdir(dir, 0755))
+	assert.True(t, namespaces.waitOpened(ctx))
+}
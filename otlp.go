@@ -0,0 +1,141 @@
+/*
+ * Copyright 2019 Martin Helmich <martin@helmich.me>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"sort"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/config"
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/logging"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+)
+
+// otlpMeterName is the name of the meter that the instruments of all
+// namespaces are created with
+const otlpMeterName = "github.com/martin-helmich/prometheus-nginxlog-exporter"
+
+// setupOTLP creates a meter provider that periodically exports the metrics
+// recorded by its meters to an OpenTelemetry collector
+func setupOTLP(cfg *config.OTLPConfig) (*sdkmetric.MeterProvider, error) {
+	interval, err := cfg.IntervalOrDefault()
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []otlpmetrichttp.Option{otlpmetrichttp.WithEndpoint(cfg.Endpoint)}
+	if cfg.Insecure {
+		opts = append(opts, otlpmetrichttp.WithInsecure())
+	}
+
+	exporter, err := otlpmetrichttp.New(context.Background(), opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	logging.Info("exporting metrics to OpenTelemetry collector periodically", "endpoint", cfg.Endpoint, "interval", interval)
+
+	reader := sdkmetric.NewPeriodicReader(exporter, sdkmetric.WithInterval(interval))
+	return sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)), nil
+}
+
+// shutdownOTLP exports the metrics for the last time and stops the meter
+// provider, giving the export at most shutdownTimeout to complete
+func shutdownOTLP(provider *sdkmetric.MeterProvider) {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := provider.Shutdown(ctx); err != nil {
+		logging.Error("error while exporting metrics to OpenTelemetry collector", "error", err)
+	}
+}
+
+// otlpMetrics mirrors the per-line metrics of a namespace into OpenTelemetry
+// instruments, using the same names as the Prometheus metrics; the labels
+// become attributes
+type otlpMetrics struct {
+	countTotal        metric.Float64Counter
+	bytesTotal        metric.Float64Counter
+	requestBytesTotal metric.Float64Counter
+	upstreamSeconds   metric.Float64Histogram
+	responseSeconds   metric.Float64Histogram
+
+	// constAttributes are the namespace labels
+	constAttributes []attribute.KeyValue
+}
+
+func newOTLPMetrics(meter metric.Meter, cfg *config.NamespaceConfig) (*otlpMetrics, error) {
+	name := func(metric string) string {
+		return prometheus.BuildFQName(cfg.NamespacePrefix, "", cfg.MetricName(metric))
+	}
+
+	m := &otlpMetrics{}
+	var err error
+
+	if m.countTotal, err = meter.Float64Counter(name("http_response_count_total"), metric.WithDescription("Amount of processed HTTP requests")); err != nil {
+		return nil, err
+	}
+
+	if m.bytesTotal, err = meter.Float64Counter(name("http_response_size_bytes"), metric.WithDescription("Total amount of transferred bytes"), metric.WithUnit("By")); err != nil {
+		return nil, err
+	}
+
+	if m.requestBytesTotal, err = meter.Float64Counter(name("http_request_size_bytes"), metric.WithDescription("Total amount of received bytes (including request line and headers)"), metric.WithUnit("By")); err != nil {
+		return nil, err
+	}
+
+	if m.upstreamSeconds, err = meter.Float64Histogram(name("http_upstream_time_seconds"), metric.WithDescription("Time needed by upstream servers to handle requests"), metric.WithUnit("s")); err != nil {
+		return nil, err
+	}
+
+	if m.responseSeconds, err = meter.Float64Histogram(name("http_response_time_seconds"), metric.WithDescription("Time needed by NGINX to handle requests"), metric.WithUnit("s")); err != nil {
+		return nil, err
+	}
+
+	for label, value := range cfg.NamespaceLabels {
+		m.constAttributes = append(m.constAttributes, attribute.String(label, value))
+	}
+	sort.Slice(m.constAttributes, func(i, j int) bool {
+		return m.constAttributes[i].Key < m.constAttributes[j].Key
+	})
+
+	return m, nil
+}
+
+// attributes returns the namespace labels and the given labels as attributes
+func (m *otlpMetrics) attributes(labelNames []string, labelValues []string) metric.MeasurementOption {
+	attributes := make([]attribute.KeyValue, 0, len(m.constAttributes)+len(labelNames))
+	attributes = append(attributes, m.constAttributes...)
+
+	for i := range labelNames {
+		attributes = append(attributes, attribute.String(labelNames[i], labelValues[i]))
+	}
+
+	return metric.WithAttributes(attributes...)
+}
+
+// observeOTLP records a duration (in seconds) observations times, since
+// histograms cannot be recorded with a weight (see observeWeighted)
+func observeOTLP(histogram metric.Float64Histogram, seconds float64, observations int, attributes metric.MeasurementOption) {
+	for i := 0; i < observations; i++ {
+		histogram.Record(context.Background(), seconds, attributes)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// collectOTLP returns the metrics collected by reader, by name
+func collectOTLP(t *testing.T, reader sdkmetric.Reader) map[string]metricdata.Aggregation {
+	var rm metricdata.ResourceMetrics
+	require.Nil(t, reader.Collect(context.Background(), &rm))
+
+	metrics := make(map[string]metricdata.Aggregation)
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			metrics[m.Name] = m.Data
+		}
+	}
+
+	return metrics
+}
+
+func TestProcessLineRecordsOTLPMetrics(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.NamespaceConfig{
+		Name:            "test",
+		Format:          "$request_method $status $body_bytes_sent $upstream_response_time $request_time",
+		NamespaceLabels: map[string]string{"vhost": "example.com"},
+	}
+
+	m, err := NewNSMetrics(&cfg)
+	require.Nil(t, err)
+
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	m.otlp, err = newOTLPMetrics(provider.Meter(otlpMeterName), &cfg)
+	require.Nil(t, err)
+
+	p := newLineProcessor(&cfg, &m.Metrics)
+	p.processLine("GET 200 512 0.25 0.5")
+	p.processLine("GET 200 256 0.25 1.5")
+
+	metrics := collectOTLP(t, reader)
+
+	count := metrics["test_http_response_count_total"].(metricdata.Sum[float64])
+	require.Len(t, count.DataPoints, 1)
+	assert.True(t, count.IsMonotonic)
+	assert.Equal(t, 2.0, count.DataPoints[0].Value)
+
+	vhost, ok := count.DataPoints[0].Attributes.Value("vhost")
+	assert.True(t, ok)
+	assert.Equal(t, attribute.StringValue("example.com"), vhost)
+
+	status, ok := count.DataPoints[0].Attributes.Value("status")
+	assert.True(t, ok)
+	assert.Equal(t, attribute.StringValue("200"), status)
+
+	bytes := metrics["test_http_response_size_bytes"].(metricdata.Sum[float64])
+	require.Len(t, bytes.DataPoints, 1)
+	assert.Equal(t, 768.0, bytes.DataPoints[0].Value)
+
+	responseTime := metrics["test_http_response_time_seconds"].(metricdata.Histogram[float64])
+	require.Len(t, responseTime.DataPoints, 1)
+	assert.Equal(t, uint64(2), responseTime.DataPoints[0].Count)
+	assert.Equal(t, 2.0, responseTime.DataPoints[0].Sum)
+
+	upstreamTime := metrics["test_http_upstream_time_seconds"].(metricdata.Histogram[float64])
+	require.Len(t, upstreamTime.DataPoints, 1)
+	assert.Equal(t, 0.5, upstreamTime.DataPoints[0].Sum)
+
+	_, ok = metrics["test_http_request_size_bytes"]
+	assert.False(t, ok, "request sizes are recorded only if $request_length is logged")
+}
@@ -0,0 +1,116 @@
+/*
+ * Copyright 2019 Martin Helmich <martin@helmich.me>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/config"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// parseRatioSlots is the number of slots that the window of a
+// parseRatioCollector is divided into
+const parseRatioSlots = 60
+
+// parseRatioCollector exports the ratio of log lines that were parsed
+// successfully within a recent window. Lines are counted in slots that each
+// cover a fraction of the window; the ratio is computed from all slots of the
+// current window whenever the metric is collected. Without any lines in the
+// window, the ratio is NaN.
+type parseRatioCollector struct {
+	desc       *prometheus.Desc
+	slotLength int64
+	now        func() time.Time
+
+	mutex sync.Mutex
+	slots [parseRatioSlots]parseRatioSlot
+}
+
+type parseRatioSlot struct {
+	index  int64
+	parsed uint64
+	failed uint64
+}
+
+func newParseRatioCollector(cfg *config.NamespaceConfig) *parseRatioCollector {
+	slotLength := int64(cfg.ParseRatioWindowDuration) / parseRatioSlots
+	if slotLength < 1 {
+		slotLength = 1
+	}
+
+	return &parseRatioCollector{
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.NamespacePrefix, "", cfg.MetricName("parse_success_ratio")),
+			"Ratio of log lines that were parsed successfully within the configured window",
+			nil,
+			cfg.NamespaceLabels,
+		),
+		slotLength: slotLength,
+		now:        time.Now,
+	}
+}
+
+// observe counts a log line that was parsed successfully or not
+func (c *parseRatioCollector) observe(success bool) {
+	index := c.now().UnixNano() / c.slotLength
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	s := &c.slots[index%parseRatioSlots]
+	if s.index != index {
+		*s = parseRatioSlot{index: index}
+	}
+
+	if success {
+		s.parsed++
+	} else {
+		s.failed++
+	}
+}
+
+func (c *parseRatioCollector) value() float64 {
+	index := c.now().UnixNano() / c.slotLength
+
+	var parsed, failed uint64
+
+	c.mutex.Lock()
+	for _, s := range c.slots {
+		if index-s.index < parseRatioSlots {
+			parsed += s.parsed
+			failed += s.failed
+		}
+	}
+	c.mutex.Unlock()
+
+	if parsed+failed == 0 {
+		return math.NaN()
+	}
+
+	return float64(parsed) / float64(parsed+failed)
+}
+
+func (c *parseRatioCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *parseRatioCollector) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, c.value())
+}
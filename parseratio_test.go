@@ -0,0 +1,37 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRatioIsComputedOverWindow(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	c := newParseRatioCollector(&config.NamespaceConfig{Name: "test", ParseRatioWindowDuration: time.Minute})
+	c.now = func() time.Time { return now }
+
+	assert.True(t, math.IsNaN(c.value()))
+
+	c.observe(true)
+	c.observe(true)
+	c.observe(true)
+	c.observe(false)
+	assert.Equal(t, 0.75, c.value())
+
+	now = now.Add(30 * time.Second)
+	c.observe(false)
+	assert.Equal(t, 0.6, c.value())
+
+	now = now.Add(45 * time.Second)
+	assert.Equal(t, 0.0, c.value())
+
+	now = now.Add(time.Minute)
+	assert.True(t, math.IsNaN(c.value()))
+}
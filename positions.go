@@ -0,0 +1,93 @@
+/*
+ * Copyright 2019 Martin Helmich <martin@helmich.me>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"sync"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/config"
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/tail"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// filePositionCollector exports the read offset and the size of each log
+// file of a namespace. The difference between both tells how far behind the
+// exporter is. Both values are determined whenever the metrics are collected.
+type filePositionCollector struct {
+	offsetDesc *prometheus.Desc
+	sizeDesc   *prometheus.Desc
+
+	mutex     sync.Mutex
+	reporters []tail.PositionReporter
+}
+
+func newFilePositionCollector(cfg *config.NamespaceConfig) *filePositionCollector {
+	return &filePositionCollector{
+		offsetDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.NamespacePrefix, "", cfg.MetricName("file_offset_bytes")),
+			"Current read offset in a log file",
+			[]string{"file"},
+			cfg.NamespaceLabels,
+		),
+		sizeDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.NamespacePrefix, "", cfg.MetricName("file_size_bytes")),
+			"Current size of a log file",
+			[]string{"file"},
+			cfg.NamespaceLabels,
+		),
+	}
+}
+
+// add registers a follower whose read positions should be exported; other
+// followers (like syslog followers) are ignored
+func (c *filePositionCollector) add(f tail.Follower) {
+	r, ok := f.(tail.PositionReporter)
+	if !ok {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.reporters = append(c.reporters, r)
+}
+
+func (c *filePositionCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.offsetDesc
+	ch <- c.sizeDesc
+}
+
+// positions returns the current read positions of all registered followers
+func (c *filePositionCollector) positions() []tail.Position {
+	c.mutex.Lock()
+	reporters := append([]tail.PositionReporter{}, c.reporters...)
+	c.mutex.Unlock()
+
+	var positions []tail.Position
+	for _, r := range reporters {
+		positions = append(positions, r.Positions()...)
+	}
+
+	return positions
+}
+
+func (c *filePositionCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, p := range c.positions() {
+		ch <- prometheus.MustNewConstMetric(c.offsetDesc, prometheus.GaugeValue, float64(p.Offset), p.Filename)
+		ch <- prometheus.MustNewConstMetric(c.sizeDesc, prometheus.GaugeValue, float64(p.Size), p.Filename)
+	}
+}
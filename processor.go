@@ -0,0 +1,815 @@
+/*
+ * Copyright 2019 Martin Helmich <martin@helmich.me>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/config"
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/logging"
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/tail"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/satyrius/gonx"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// lineProcessor contains everything that is needed to turn a single log line
+// of a namespace into metric updates. It holds no per-line state, so a single
+// instance may be used by multiple goroutines at once.
+type lineProcessor struct {
+	cfg        *config.NamespaceConfig
+	parser     lineParser
+	labels     *labelLayout
+	metrics    *Metrics
+	bytesField string
+	weight     float64
+	debugLines *lineRing
+	geoIP      *geoIPLookup
+
+	// withoutMethod is the label layout of the metrics without method label
+	// (if enabled by the without_method_metrics option)
+	withoutMethod *labelLayout
+
+	// sampleEvery is the n of the sample_every option (which is included in
+	// weight), and lines counts the lines that were read so far
+	sampleEvery uint64
+	lines       *uint64
+
+	// source is the name of the log source that the processor is used for
+	// (if any), and lastLineTimestamp is its last_line_timestamp_seconds
+	// gauge (if enabled)
+	source            string
+	lastLineTimestamp prometheus.Gauge
+
+	// parseErrorLog limits how many lines that could not be parsed are
+	// logged; it is shared by the processors of all log sources
+	parseErrorLog *logging.Limiter
+}
+
+// lines that could not be parsed are logged at most parseErrorLogLimit times
+// per parseErrorLogInterval (the number of lines that were not logged is
+// included in the next message), so that a wrong log format does not flood
+// the exporter's log
+const (
+	parseErrorLogLimit    = 10
+	parseErrorLogInterval = time.Minute
+)
+
+func newLineProcessor(nsCfg *config.NamespaceConfig, metrics *Metrics) *lineProcessor {
+	p := &lineProcessor{
+		cfg:        nsCfg,
+		parser:     newLineParser(nsCfg),
+		labels:     newLabelLayout(nsCfg),
+		metrics:    metrics,
+		bytesField: nsCfg.BytesFieldOrDefault(),
+		weight:     nsCfg.SampleWeight(),
+		lines:      new(uint64),
+
+		parseErrorLog: logging.NewLimiter(parseErrorLogLimit, parseErrorLogInterval),
+	}
+
+	if nsCfg.SampleEvery > 1 {
+		p.sampleEvery = uint64(nsCfg.SampleEvery)
+		p.weight *= float64(nsCfg.SampleEvery)
+	}
+
+	if nsCfg.WithoutMethodMetrics {
+		p.withoutMethod = p.labels.withoutMethod()
+	}
+
+	return p
+}
+
+// withStaticLabels returns a copy of the processor that uses different values
+// for the static labels (like the labels of a file group)
+func (p *lineProcessor) withStaticLabels(values []string) *lineProcessor {
+	c := *p
+	c.labels = p.labels.withStaticValues(values)
+
+	if p.withoutMethod != nil {
+		c.withoutMethod = p.withoutMethod.withStaticValues(values)
+	}
+
+	return &c
+}
+
+// forSource returns a copy of the processor that records the timestamps of
+// its lines as the last line timestamp of the given log source, if the
+// last_line_timestamp option is enabled
+func (p *lineProcessor) forSource(name string) *lineProcessor {
+	c := *p
+	c.source = name
+
+	if p.metrics.lastLineTimestamp != nil {
+		c.lastLineTimestamp = p.metrics.lastLineTimestamp.WithLabelValues(name)
+	}
+
+	return &c
+}
+
+// watchProcessingTime counts (and logs) a line if processing it, starting at
+// the given time, took longer than the slow_line_threshold. Since all regular
+// expressions are evaluated in linear time, lines cannot hang processing
+// altogether; but slow lines point to overly complex relabel configurations.
+func (p *lineProcessor) watchProcessingTime(line string, start time.Time) {
+	took := time.Since(start)
+	if took <= p.cfg.SlowLineThresholdDuration {
+		return
+	}
+
+	logging.Warn("processing line took longer than the slow line threshold", "namespace", p.cfg.Name, "file", p.source, "line", line, "took", took)
+	p.metrics.slowLinesTotal.Inc()
+}
+
+// logParseError logs a line that could not be parsed, unless too many lines
+// were logged recently (see parseErrorLogLimit)
+func (p *lineProcessor) logParseError(line string, err error) {
+	ok, suppressed := p.parseErrorLog.Allow()
+	if !ok {
+		return
+	}
+
+	keyvals := []interface{}{"namespace", p.cfg.Name, "file", p.source, "line", line, "error", err}
+	if suppressed > 0 {
+		keyvals = append(keyvals, "suppressed", suppressed)
+	}
+
+	logging.Warn("error while parsing line", keyvals...)
+}
+
+// processSource processes the lines emitted by a follower until ctx is
+// cancelled (or the follower has no more lines); the follower is then stopped,
+// if it supports that.
+func processSource(ctx context.Context, t tail.Follower, p *lineProcessor, pool *workerPool) {
+	lines := t.Lines()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if s, ok := t.(tail.Stopper); ok {
+				if err := s.Stop(); err != nil {
+					logging.Error("error while stopping log source", "error", err)
+				}
+			}
+			return
+		case line, ok := <-lines:
+			if !ok {
+				return
+			}
+
+			if pool != nil {
+				pool.submit(p, line)
+				continue
+			}
+
+			p.processLine(line)
+		}
+	}
+}
+
+func (p *lineProcessor) processLine(line string) {
+	nsCfg := p.cfg
+	metrics := p.metrics
+
+	if metrics.slowLinesTotal != nil {
+		defer p.watchProcessingTime(line, time.Now())
+	}
+
+	if nsCfg.PrintLog {
+		fmt.Println(line)
+	}
+
+	if metrics.activity != nil {
+		metrics.activity.observe()
+	}
+
+	metrics.linesTotal.Inc()
+
+	if p.sampleEvery > 1 && (atomic.AddUint64(p.lines, 1)-1)%p.sampleEvery != 0 {
+		return
+	}
+
+	entry, err := p.parser.ParseString(line)
+
+	if p.debugLines != nil {
+		p.debugLines.add(line, err == nil)
+	}
+
+	if metrics.parseRatio != nil {
+		metrics.parseRatio.observe(err == nil)
+	}
+
+	if err != nil {
+		p.logParseError(line, err)
+
+		metrics.parseErrorsTotal.Add(p.lineWeight())
+		return
+	}
+
+	metrics.parsedLinesTotal.Add(p.lineWeight())
+
+	if nsCfg.Shadow {
+		return
+	}
+
+	fields := entry.Fields()
+
+	if _, ok := fields["request"]; !ok && nsCfg.MissingRequest != "" && nsCfg.MissingRequest != "proceed" {
+		if metrics.missingRequestTotal != nil {
+			metrics.missingRequestTotal.Add(p.weight)
+		}
+		return
+	}
+
+	if nsCfg.CompiledRequestPattern != nil {
+		fillRequestPartFields(fields, nsCfg.CompiledRequestPattern)
+	}
+
+	if nsCfg.ProtocolLabel {
+		fillProtocolField(fields, nsCfg.ProtocolSource)
+	}
+
+	if nsCfg.RefererLabel != nil {
+		fields["referer_class"] = refererClass(fields["http_referer"], nsCfg.RefererLabel.Domains)
+	}
+
+	if p.geoIP != nil {
+		p.geoIP.fill(fields)
+	}
+
+	if nsCfg.StatusClassLabel {
+		fields["status_class"] = statusClass(fields["status"])
+	}
+
+	if nsCfg.UpstreamAddrLabel {
+		fields["upstream_addr.selected"] = selectUpstreamAddr(fields["upstream_addr"], nsCfg.UpstreamAddrSelect)
+	}
+
+	if nsCfg.ClientIPLabel {
+		fields["client_ip"] = clientIP(fields["http_x_forwarded_for"], fields["remote_addr"])
+	}
+
+	if metrics.seriesLimit != nil {
+		fields["over_limit"] = "false"
+	}
+
+	if p.labels.drops(fields) {
+		return
+	}
+
+	relabelings := p.labels.relabelings
+	relabelValues := make([]string, len(relabelings))
+
+	for i := range relabelings {
+		if str, ok := fields[relabelings[i].SourceValue]; ok {
+			mapped, err := relabelings[i].Map(str)
+			if err == nil {
+				relabelValues[i] = mapped
+			}
+
+			// the group values are mapped by relabelings further down
+			if len(relabelings[i].GroupNames) > 0 {
+				for j, value := range relabelings[i].Groups(str) {
+					fields[relabelings[i].GroupField(relabelings[i].GroupNames[j])] = value
+				}
+			}
+		}
+	}
+
+	pooledValues := p.labels.acquireValues()
+	defer p.labels.releaseValues(pooledValues)
+
+	labelValues := *pooledValues
+	p.labels.fillLabelValues(labelValues, relabelValues)
+	// counters are incremented by the same (rounded) weight that histograms
+	// and summaries are observed with, so that both always agree
+	observations := p.observations()
+	weight := float64(observations) * p.lineWeight()
+
+	overLimit := metrics.seriesLimit != nil && !metrics.seriesLimit.admit(labelValues)
+	if overLimit {
+		metrics.seriesLimitExceeded.Add(weight)
+		p.labels.fillOverLimitValues(labelValues)
+	}
+
+	metrics.countTotal.WithLabelValues(labelValues...).Add(weight)
+
+	if metrics.statsd != nil {
+		metrics.statsd.count(metrics.statsd.countTotal, weight, p.labels.names, labelValues)
+	}
+
+	var otlpAttributes metric.MeasurementOption
+	if metrics.otlp != nil {
+		otlpAttributes = metrics.otlp.attributes(p.labels.names, labelValues)
+		metrics.otlp.countTotal.Add(context.Background(), weight, otlpAttributes)
+	}
+
+	var withoutMethodValues []string
+	if p.withoutMethod != nil {
+		pooledWithoutMethod := p.withoutMethod.acquireValues()
+		defer p.withoutMethod.releaseValues(pooledWithoutMethod)
+
+		withoutMethodValues = *pooledWithoutMethod
+		p.withoutMethod.fillLabelValues(withoutMethodValues, relabelValues)
+		if overLimit {
+			p.withoutMethod.fillOverLimitValues(withoutMethodValues)
+		}
+		metrics.countTotalWithoutMethod.WithLabelValues(withoutMethodValues...).Add(weight)
+	}
+
+	if metrics.unmatchedTotal != nil && p.labels.unmatched(relabelValues) {
+		metrics.unmatchedTotal.WithLabelValues(p.labels.method(relabelValues)).Add(weight)
+	}
+
+	if metrics.topMethods != nil {
+		metrics.topMethods.observe(p.labels.method(relabelValues), weight)
+	}
+
+	if metrics.requestsByHour != nil || metrics.clockSkew != nil || p.lastLineTimestamp != nil {
+		if ts, ok := timeFromFields(fields, nsCfg.TimeFormat); ok {
+			if metrics.requestsByHour != nil {
+				metrics.requestsByHour.WithLabelValues(strconv.Itoa(ts.Hour())).Add(weight)
+			}
+
+			if metrics.clockSkew != nil {
+				metrics.clockSkew.observe(ts)
+			}
+
+			if p.lastLineTimestamp != nil {
+				p.lastLineTimestamp.Set(float64(ts.UnixNano()) / 1e9)
+			}
+		}
+	}
+
+	class := statusClass(fields["status"])
+	bytes, hasBytes := uintFromFields(fields, p.bytesField)
+
+	if hasBytes {
+		metrics.bytesTotal.WithLabelValues(labelValues...).Add(float64(bytes) * weight)
+
+		if metrics.statsd != nil {
+			metrics.statsd.count(metrics.statsd.bytesTotal, float64(bytes)*weight, p.labels.names, labelValues)
+		}
+
+		if metrics.otlp != nil {
+			metrics.otlp.bytesTotal.Add(context.Background(), float64(bytes)*weight, otlpAttributes)
+		}
+
+		if p.withoutMethod != nil {
+			metrics.bytesTotalWithoutMethod.WithLabelValues(withoutMethodValues...).Add(float64(bytes) * weight)
+		}
+
+		if metrics.responseSizeSum != nil {
+			metrics.responseSizeSum.WithLabelValues(labelValues...).Add(float64(bytes) * weight)
+			metrics.responseSizeCount.WithLabelValues(labelValues...).Add(weight)
+		}
+	}
+
+	// skipped if the log format does not contain $request_length
+	if requestBytes, ok := uintFromFields(fields, "request_length"); ok {
+		metrics.requestBytesTotal.WithLabelValues(labelValues...).Add(float64(requestBytes) * weight)
+
+		if metrics.otlp != nil {
+			metrics.otlp.requestBytesTotal.Add(context.Background(), float64(requestBytes)*weight, otlpAttributes)
+		}
+	}
+
+	if metrics.classRequestsTotal != nil {
+		classLabel := class
+		if classLabel == "" {
+			classLabel = "unknown"
+		}
+
+		metrics.classRequestsTotal.WithLabelValues(classLabel).Add(weight)
+		if hasBytes {
+			metrics.classBytesTotal.WithLabelValues(classLabel).Add(float64(bytes) * weight)
+		}
+	}
+
+	observeLatency := nsCfg.ObservesLatencyFor(class)
+
+	var exemplar prometheus.Labels
+	if nsCfg.ExemplarField != "" {
+		exemplar = traceExemplar(fields[nsCfg.ExemplarField])
+	}
+
+	if upstreamTime, ok := upstreamTimeFromFields(fields, nsCfg.UpstreamTimeAggregation); ok && observeLatency {
+		observeWeighted(metrics.upstreamSeconds.WithLabelValues(labelValues...), upstreamTime, observations)
+		observeWeightedWithExemplar(metrics.upstreamSecondsHist.WithLabelValues(labelValues...), upstreamTime, observations, exemplar)
+
+		if metrics.statsd != nil {
+			metrics.statsd.timing(metrics.statsd.upstreamTime, upstreamTime, weight, p.labels.names, labelValues)
+		}
+
+		if metrics.otlp != nil {
+			observeOTLP(metrics.otlp.upstreamSeconds, upstreamTime, observations, otlpAttributes)
+		}
+	}
+
+	upstreams := upstreamListFromFields(fields)
+	if metrics.upstreamAttempts != nil && len(upstreams) > 0 {
+		observeWeighted(metrics.upstreamAttempts.WithLabelValues(labelValues...), float64(len(upstreams)), observations)
+	}
+
+	if metrics.upstreamLatency != nil && observeLatency {
+		metrics.upstreamLatency.observe(fields, observations)
+	}
+
+	if metrics.upstreamStatusSeconds != nil && observeLatency {
+		observeUpstreamStatusLatency(metrics.upstreamStatusSeconds, fields, observations)
+	}
+
+	if metrics.upstreamConnect != nil && observeLatency {
+		metrics.upstreamConnect.observe(fields, nsCfg.UpstreamTimeAggregation, labelValues, observations)
+		metrics.upstreamHeader.observe(fields, nsCfg.UpstreamTimeAggregation, labelValues, observations)
+	}
+
+	if metrics.cache != nil {
+		if cacheStatus, ok := fields["upstream_cache_status"]; ok {
+			metrics.cache.observe(cacheStatus, len(upstreams) > 0, observations)
+		}
+	}
+
+	if responseTime, ok := floatFromFields(fields, "request_time"); ok && observeLatency {
+		observeWeighted(metrics.responseSeconds.WithLabelValues(labelValues...), responseTime, observations)
+		observeWeightedWithExemplar(metrics.responseSecondsHist.WithLabelValues(labelValues...), responseTime, observations, exemplar)
+
+		if metrics.statsd != nil {
+			metrics.statsd.timing(metrics.statsd.responseTime, responseTime, weight, p.labels.names, labelValues)
+		}
+
+		if metrics.otlp != nil {
+			observeOTLP(metrics.otlp.responseSeconds, responseTime, observations, otlpAttributes)
+		}
+
+		if metrics.responseSecondsBySize != nil {
+			if size, ok := floatFromFields(fields, nsCfg.RequestSizeLatency.Field); ok {
+				sizeClass := nsCfg.RequestSizeLatency.Class(size)
+				observeWeighted(metrics.responseSecondsBySize.WithLabelValues(append(labelValues, sizeClass)...), responseTime, observations)
+			}
+		}
+	}
+}
+
+// lineWeight returns how many log lines a single processed line accounts for
+// (when only every n-th line is processed because of the sample_every option)
+func (p *lineProcessor) lineWeight() float64 {
+	if p.sampleEvery > 1 {
+		return float64(p.sampleEvery)
+	}
+
+	return 1
+}
+
+// observations returns how many observations a single log line accounts
+// for. When sampling, each line represents 1/sample_rate requests; since
+// histograms and summaries cannot be observed with a weight, the observation
+// is repeated instead. Fractional weights are rounded up or down at random,
+// so that the number of observations is correct on average. Lines that were
+// sampled by the sample_every option are observed only once, though, since
+// repeating the observations would defeat the purpose of sampling.
+func (p *lineProcessor) observations() int {
+	weight := p.weight / p.lineWeight()
+	n := int(weight)
+
+	if frac := weight - float64(n); frac > 0 && rand.Float64() < frac {
+		n++
+	}
+
+	return n
+}
+
+// observeWeighted observes a value n times
+func observeWeighted(o prometheus.Observer, value float64, n int) {
+	for i := 0; i < n; i++ {
+		o.Observe(value)
+	}
+}
+
+// observeWeightedWithExemplar observes a value n times, like observeWeighted,
+// attaching the exemplar (if not nil) to the first observation
+func observeWeightedWithExemplar(o prometheus.Observer, value float64, n int, exemplar prometheus.Labels) {
+	if eo, ok := o.(prometheus.ExemplarObserver); ok && exemplar != nil && n > 0 {
+		eo.ObserveWithExemplar(value, exemplar)
+		n--
+	}
+
+	observeWeighted(o, value, n)
+}
+
+// traceExemplar returns the exemplar labels for the given trace ID, or nil if
+// the trace ID is empty (or "-", as logged by NGINX for unset variables) or
+// cannot be used as exemplar label value since it is too long or not valid
+// UTF-8
+func traceExemplar(traceID string) prometheus.Labels {
+	if traceID == "" || traceID == "-" || !utf8.ValidString(traceID) {
+		return nil
+	}
+
+	if utf8.RuneCountInString("trace_id")+utf8.RuneCountInString(traceID) > prometheus.ExemplarMaxRunes {
+		return nil
+	}
+
+	return prometheus.Labels{"trace_id": traceID}
+}
+
+// fillRequestPartFields matches the request line against the request_pattern
+// and stores the "method", "uri" and "protocol" groups in the fields listed in
+// requestPartFields. If the request line does not match, they are empty.
+func fillRequestPartFields(fields gonx.Fields, pattern *regexp.Regexp) {
+	request, ok := fields["request"]
+	if !ok {
+		return
+	}
+
+	fields["request.method"] = ""
+	fields["request.uri"] = ""
+	fields["request.protocol"] = ""
+
+	match := pattern.FindStringSubmatch(request)
+	if match == nil {
+		return
+	}
+
+	for i, name := range pattern.SubexpNames() {
+		if name != "" {
+			fields["request."+name] = match[i]
+		}
+	}
+}
+
+// refererClass classifies a referer as "internal" (if its host is one of the
+// given domains, or a subdomain of one of them), "external" or "none" (if the
+// referer is empty)
+func refererClass(referer string, domains []string) string {
+	if referer == "" || referer == "-" {
+		return "none"
+	}
+
+	u, err := url.Parse(referer)
+	if err != nil {
+		return "external"
+	}
+
+	host := strings.ToLower(u.Hostname())
+	for _, d := range domains {
+		if host == d || strings.HasSuffix(host, "."+d) {
+			return "internal"
+		}
+	}
+
+	return "external"
+}
+
+// fillProtocolField makes sure that the "server_protocol" field contains the
+// protocol of the request. Unless source is "request", a logged
+// $server_protocol variable is preferred; otherwise, the protocol is taken
+// from the request_pattern or the last token of the request line (like
+// "HTTP/1.1").
+func fillProtocolField(fields gonx.Fields, source string) {
+	if _, ok := fields["server_protocol"]; ok && source != "request" {
+		return
+	}
+
+	if protocol, ok := fields["request.protocol"]; ok {
+		fields["server_protocol"] = protocol
+		return
+	}
+
+	request, ok := fields["request"]
+	if !ok {
+		return
+	}
+
+	tokens := strings.Split(request, " ")
+	if len(tokens) < 3 {
+		fields["server_protocol"] = ""
+		return
+	}
+
+	fields["server_protocol"] = tokens[2]
+}
+
+// statusClass maps an HTTP status code to its class (like "2xx"); for
+// anything that is not a three-digit status code, an empty string is returned
+func statusClass(status string) string {
+	if len(status) != 3 || status[0] < '1' || status[0] > '5' {
+		return ""
+	}
+
+	return status[:1] + "xx"
+}
+
+// upstreamListFromFields returns the list of upstream servers that were
+// contacted for a request; it is read from "upstream_addr" or, if that field
+// is not logged, from "upstream_response_time".
+func upstreamListFromFields(fields gonx.Fields) []string {
+	if val, ok := fields["upstream_addr"]; ok {
+		return splitUpstreamList(val, true)
+	}
+
+	if val, ok := fields["upstream_response_time"]; ok {
+		return splitUpstreamList(val, false)
+	}
+
+	return nil
+}
+
+// selectUpstreamAddr returns either the first or the last (by default)
+// address of an $upstream_addr value, or an empty string if no upstream was
+// contacted
+func selectUpstreamAddr(val string, selector string) string {
+	addrs := splitUpstreamList(val, true)
+	if len(addrs) == 0 {
+		return ""
+	}
+
+	if selector == "first" {
+		return addrs[0]
+	}
+
+	return addrs[len(addrs)-1]
+}
+
+// clientIP returns the first address of an X-Forwarded-For header value, or
+// remoteAddr if the header does not contain any address. Empty entries and
+// the "-" and "unknown" placeholders (written by NGINX and some proxies for
+// missing values) are skipped.
+func clientIP(forwardedFor string, remoteAddr string) string {
+	for _, addr := range strings.Split(forwardedFor, ",") {
+		addr = strings.TrimSpace(addr)
+		if addr != "" && addr != "-" && !strings.EqualFold(addr, "unknown") {
+			return addr
+		}
+	}
+
+	return remoteAddr
+}
+
+// splitUpstreamList splits one of NGINX's $upstream_* variables into the
+// values for all upstreams that were actually contacted. A value of "-"
+// (meaning that no upstream was contacted) results in an empty list.
+func splitUpstreamList(val string, isAddress bool) []string {
+	var values []string
+	for _, v := range splitUpstreamValues(val, isAddress) {
+		if v != "-" {
+			values = append(values, v)
+		}
+	}
+
+	return values
+}
+
+// splitUpstreamValues splits one of NGINX's $upstream_* variables into its
+// individual values, including "-" placeholders (so that the values of
+// different $upstream_* variables can be matched by position). NGINX
+// separates the values for multiple servers with commas and the values of
+// different server groups (after an internal redirect) with colons. Since
+// addresses contain colons themselves, only a colon surrounded by spaces
+// counts as separator when isAddress is set.
+func splitUpstreamValues(val string, isAddress bool) []string {
+	groupSep := ":"
+	if isAddress {
+		groupSep = " : "
+	}
+
+	var values []string
+	for _, group := range strings.Split(val, groupSep) {
+		for _, v := range strings.Split(group, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+	}
+
+	return values
+}
+
+// uintFromFields reads an integer field (like a byte count). Unlike with
+// floatFromFields, the value is parsed exactly; the Prometheus client then
+// accumulates integral counter increments in an integer, so that byte
+// counters do not lose precision over time.
+func uintFromFields(fields gonx.Fields, name string) (uint64, bool) {
+	val, ok := fields[name]
+	if !ok {
+		return 0, false
+	}
+
+	i, err := strconv.ParseUint(val, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	return i, true
+}
+
+func floatFromFields(fields gonx.Fields, name string) (float64, bool) {
+	val, ok := fields[name]
+	if !ok {
+		return 0, false
+	}
+
+	f, err := strconv.ParseFloat(val, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	return f, true
+}
+
+// upstreamTimeFromFields reads the "upstream_response_time" field. If a
+// request was passed to multiple upstreams, their response times are combined
+// according to mode: "last" uses the time of the last upstream, "max" the
+// longest time, and "sum" (or an empty mode) the sum of all times. Values that
+// are not numeric (like "-" for upstreams that could not be connected to) are
+// ignored.
+func upstreamTimeFromFields(fields gonx.Fields, mode string) (float64, bool) {
+	return upstreamTimeFromField(fields, "upstream_response_time", mode)
+}
+
+// upstreamTimeFromField reads any of the $upstream_*_time fields, like
+// upstreamTimeFromFields does for "upstream_response_time"
+func upstreamTimeFromField(fields gonx.Fields, name string, mode string) (float64, bool) {
+	val, ok := fields[name]
+	if !ok {
+		return 0, false
+	}
+
+	var result float64
+	found := false
+
+	for _, v := range splitUpstreamValues(val, false) {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			continue
+		}
+
+		switch {
+		case !found || mode == "last":
+			result = f
+		case mode == "max":
+			result = math.Max(result, f)
+		default:
+			result += f
+		}
+
+		found = true
+	}
+
+	return result, found
+}
+
+func getLayout(layout, def string) string {
+	if layout == "" {
+		return def
+	}
+
+	return layout
+}
+
+// timeLocalLayout is the layout of NGINX's $time_local variable. The numeric
+// zone offset is part of the layout, so that timestamps that are logged in a
+// timezone other than UTC still resolve to the correct instant.
+const timeLocalLayout = "02/Jan/2006:15:04:05 -0700"
+
+// timeFromFields reads the request timestamp from either the "time_local" or
+// "time_iso8601" field (whichever is present). The returned time retains the
+// zone offset that it was logged with. If layout is not empty, it is used for
+// parsing either field, instead of their default layouts.
+func timeFromFields(fields gonx.Fields, layout string) (time.Time, bool) {
+	if val, ok := fields["time_local"]; ok {
+		t, err := time.Parse(getLayout(layout, timeLocalLayout), val)
+		return t, err == nil
+	}
+
+	if val, ok := fields["time_iso8601"]; ok {
+		t, err := time.Parse(getLayout(layout, time.RFC3339), val)
+		return t, err == nil
+	}
+
+	return time.Time{}, false
+}
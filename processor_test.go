@@ -0,0 +1,913 @@
+package main
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/config"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/satyrius/gonx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimeFromFieldsHonorsZoneOffset(t *testing.T) {
+	t.Parallel()
+
+	expected := time.Date(2016, 6, 23, 14, 4, 20, 0, time.UTC)
+
+	cases := []struct {
+		name  string
+		field string
+		value string
+		hour  int
+	}{
+		{"utc", "time_local", "23/Jun/2016:14:04:20 +0000", 14},
+		{"cest", "time_local", "23/Jun/2016:16:04:20 +0200", 16},
+		{"edt", "time_local", "23/Jun/2016:10:04:20 -0400", 10},
+		{"ist", "time_local", "23/Jun/2016:19:34:20 +0530", 19},
+		{"iso8601 utc", "time_iso8601", "2016-06-23T14:04:20Z", 14},
+		{"iso8601 cest", "time_iso8601", "2016-06-23T16:04:20+02:00", 16},
+	}
+
+	for _, c := range cases {
+		ts, ok := timeFromFields(gonx.Fields{c.field: c.value}, "")
+
+		require.True(t, ok, c.name)
+		assert.True(t, expected.Equal(ts), "%s: expected %s, got %s", c.name, expected, ts)
+		assert.Equal(t, c.hour, ts.Hour(), c.name)
+	}
+}
+
+func TestTimeFromFieldsRejectsMissingOrInvalidTimestamps(t *testing.T) {
+	t.Parallel()
+
+	_, ok := timeFromFields(gonx.Fields{}, "")
+	assert.False(t, ok)
+
+	_, ok = timeFromFields(gonx.Fields{"time_local": "23/Jun/2016:16:04:20"}, "")
+	assert.False(t, ok)
+}
+
+func TestSplitUpstreamList(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, []string{"10.0.0.1:80"}, splitUpstreamList("10.0.0.1:80", true))
+	assert.Equal(t, []string{"10.0.0.1:80", "10.0.0.2:80", "unix:/tmp/sock"}, splitUpstreamList("10.0.0.1:80, 10.0.0.2:80 : unix:/tmp/sock", true))
+	assert.Equal(t, []string{"0.010", "0.020", "0.030"}, splitUpstreamList("0.010, 0.020 : 0.030", false))
+	assert.Empty(t, splitUpstreamList("-", true))
+	assert.Empty(t, splitUpstreamList("", false))
+
+	assert.Equal(t, []string{"10.0.0.1:80", "-"}, splitUpstreamValues("10.0.0.1:80, -", true))
+}
+
+func TestUintFromFieldsParsesExactly(t *testing.T) {
+	t.Parallel()
+
+	fields := gonx.Fields{
+		"large":    "9007199254740993",
+		"negative": "-1",
+		"float":    "1.5",
+		"dash":     "-",
+	}
+
+	v, ok := uintFromFields(fields, "large")
+	assert.True(t, ok)
+	assert.Equal(t, uint64(9007199254740993), v)
+
+	for _, name := range []string{"negative", "float", "dash", "missing"} {
+		_, ok := uintFromFields(fields, name)
+		assert.False(t, ok, name)
+	}
+}
+
+func TestStatusClass(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "2xx", statusClass("200"))
+	assert.Equal(t, "5xx", statusClass("504"))
+	assert.Equal(t, "", statusClass("UNKNOWN"))
+	assert.Equal(t, "", statusClass("0"))
+	assert.Equal(t, "", statusClass(""))
+}
+
+func TestObservationsAccountForSampleWeight(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, 1, (&lineProcessor{weight: 1}).observations())
+	assert.Equal(t, 4, (&lineProcessor{weight: 4}).observations())
+
+	n := (&lineProcessor{weight: 2.5}).observations()
+	assert.True(t, n == 2 || n == 3)
+}
+
+func TestFillProtocolField(t *testing.T) {
+	t.Parallel()
+
+	fields := gonx.Fields{"request": "GET /foo HTTP/1.1", "server_protocol": "HTTP/2.0"}
+	fillProtocolField(fields, "")
+	assert.Equal(t, "HTTP/2.0", fields["server_protocol"])
+
+	fillProtocolField(fields, "request")
+	assert.Equal(t, "HTTP/1.1", fields["server_protocol"])
+
+	fields = gonx.Fields{"request": "GET /foo HTTP/1.0"}
+	fillProtocolField(fields, "")
+	assert.Equal(t, "HTTP/1.0", fields["server_protocol"])
+
+	fields = gonx.Fields{"request": "-"}
+	fillProtocolField(fields, "")
+	assert.Equal(t, "", fields["server_protocol"])
+}
+
+func TestProcessLineCountsByStatusClass(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.NamespaceConfig{
+		Name:               "test",
+		Format:             "$status $body_bytes_sent",
+		StatusClassMetrics: true,
+	}
+
+	m, err := NewNSMetrics(&cfg)
+	require.Nil(t, err)
+
+	p := newLineProcessor(&cfg, &m.Metrics)
+	p.processLine("200 10")
+	p.processLine("204 5")
+	p.processLine("502 7")
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.classRequestsTotal.WithLabelValues("2xx")))
+	assert.Equal(t, 15.0, testutil.ToFloat64(m.classBytesTotal.WithLabelValues("2xx")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.classRequestsTotal.WithLabelValues("5xx")))
+}
+
+func TestFillRequestPartFields(t *testing.T) {
+	t.Parallel()
+
+	pattern := regexp.MustCompile(`^(?P<method>[A-Z]+) (?P<uri>.+?)(?: (?P<protocol>HTTP/[0-9.]+))?$`)
+
+	fields := gonx.Fields{"request": "GET /search?q=foo bar HTTP/1.1"}
+	fillRequestPartFields(fields, pattern)
+	assert.Equal(t, "GET", fields["request.method"])
+	assert.Equal(t, "/search?q=foo bar", fields["request.uri"])
+	assert.Equal(t, "HTTP/1.1", fields["request.protocol"])
+
+	fields = gonx.Fields{"request": "GET /"}
+	fillRequestPartFields(fields, pattern)
+	assert.Equal(t, "/", fields["request.uri"])
+	assert.Equal(t, "", fields["request.protocol"])
+
+	fields = gonx.Fields{"request": "\x16\x03\x01"}
+	fillRequestPartFields(fields, pattern)
+	assert.Equal(t, "", fields["request.method"])
+}
+
+func TestProcessLineUsesFileGroupLabels(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.NamespaceConfig{
+		Name:   "test",
+		Format: "$request $status",
+		SourceData: config.SourceData{
+			FileGroups: []config.FileGroupSource{
+				{Name: "checkout", Files: config.FileSource{"checkout.log"}, Labels: map[string]string{"service": "checkout"}},
+			},
+		},
+	}
+	require.Nil(t, cfg.Compile())
+
+	m, err := NewNSMetrics(&cfg)
+	require.Nil(t, err)
+
+	p := newLineProcessor(&cfg, &m.Metrics)
+	g := p.withStaticLabels(cfg.FileGroupLabelValues(&cfg.SourceData.FileGroups[0]))
+
+	p.processLine("GET 200")
+	g.processLine("GET 200")
+	g.processLine("GET 200")
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.countTotal.WithLabelValues("", "GET", "200")))
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.countTotal.WithLabelValues("checkout", "GET", "200")))
+}
+
+func TestProcessLineParsesApacheCombinedFormat(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.NamespaceConfig{Name: "test", Format: "apache_combined"}
+	require.Nil(t, cfg.Compile())
+
+	m, err := NewNSMetrics(&cfg)
+	require.Nil(t, err)
+
+	p := newLineProcessor(&cfg, &m.Metrics)
+	p.processLine(`127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326 "http://www.example.com/start.html" "Mozilla/4.08 [en] (Win98; I ;Nav)"`)
+
+	assert.Equal(t, 0.0, testutil.ToFloat64(m.parseErrorsTotal))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.countTotal.WithLabelValues("GET", "200")))
+	assert.Equal(t, 2326.0, testutil.ToFloat64(m.bytesTotal.WithLabelValues("GET", "200")))
+}
+
+func TestProcessLineFillsResponseSizeGauges(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.NamespaceConfig{
+		Name:               "test",
+		Format:             "$request $status $body_bytes_sent",
+		ResponseSizeGauges: true,
+	}
+
+	m, err := NewNSMetrics(&cfg)
+	require.Nil(t, err)
+
+	p := newLineProcessor(&cfg, &m.Metrics)
+	p.processLine("GET 200 10")
+	p.processLine("GET 200 30")
+	p.processLine("GET 200 -")
+
+	assert.Equal(t, 40.0, testutil.ToFloat64(m.responseSizeSum.WithLabelValues("GET", "200")))
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.responseSizeCount.WithLabelValues("GET", "200")))
+}
+
+func TestWatchProcessingTimeCountsSlowLines(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.NamespaceConfig{Name: "test", Format: "$request $status", SlowLineThreshold: "100ms"}
+	require.Nil(t, cfg.Compile())
+
+	m, err := NewNSMetrics(&cfg)
+	require.Nil(t, err)
+
+	p := newLineProcessor(&cfg, &m.Metrics)
+	p.processLine("GET 200")
+	assert.Equal(t, 0.0, testutil.ToFloat64(m.slowLinesTotal))
+
+	p.watchProcessingTime("GET 200", time.Now().Add(-time.Second))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.slowLinesTotal))
+}
+
+func TestProcessLineFillsMetricsWithoutMethod(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.NamespaceConfig{
+		Name:                 "test",
+		Format:               "$request $status $body_bytes_sent",
+		WithoutMethodMetrics: true,
+	}
+
+	m, err := NewNSMetrics(&cfg)
+	require.Nil(t, err)
+
+	p := newLineProcessor(&cfg, &m.Metrics)
+	p.processLine("GET 200 10")
+	p.processLine("POST 200 30")
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.countTotalWithoutMethod.WithLabelValues("200")))
+	assert.Equal(t, 40.0, testutil.ToFloat64(m.bytesTotalWithoutMethod.WithLabelValues("200")))
+}
+
+func TestRefererClass(t *testing.T) {
+	t.Parallel()
+
+	domains := []string{"example.com"}
+
+	assert.Equal(t, "none", refererClass("", domains))
+	assert.Equal(t, "none", refererClass("-", domains))
+	assert.Equal(t, "internal", refererClass("https://example.com/foo", domains))
+	assert.Equal(t, "internal", refererClass("https://WWW.Example.com:8443/foo", domains))
+	assert.Equal(t, "external", refererClass("https://notexample.com/", domains))
+	assert.Equal(t, "external", refererClass("https://www.google.com/search?q=example.com", domains))
+	assert.Equal(t, "external", refererClass("%zz", domains))
+}
+
+func TestProcessLineAddsRefererLabel(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.NamespaceConfig{
+		Name:         "test",
+		Format:       `$request $status "$http_referer"`,
+		RefererLabel: &config.RefererLabelConfig{Domains: []string{".Example.com"}},
+	}
+
+	m, err := NewNSMetrics(&cfg)
+	require.Nil(t, err)
+
+	p := newLineProcessor(&cfg, &m.Metrics)
+	p.processLine(`GET 200 "https://www.example.com/"`)
+	p.processLine(`GET 200 "-"`)
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.countTotal.WithLabelValues("internal", "GET", "200")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.countTotal.WithLabelValues("none", "GET", "200")))
+}
+
+func TestProcessLineCountsAllLines(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.NamespaceConfig{Name: "test", Format: "$request $status"}
+	require.Nil(t, cfg.Compile())
+
+	m, err := NewNSMetrics(&cfg)
+	require.Nil(t, err)
+
+	p := newLineProcessor(&cfg, &m.Metrics)
+	p.processLine("GET 200")
+	p.processLine("garbage")
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.linesTotal))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.parseErrorsTotal))
+}
+
+func TestProcessLineHandlesMissingRequestField(t *testing.T) {
+	t.Parallel()
+
+	for _, mode := range []string{"proceed", "skip", "count"} {
+		cfg := config.NamespaceConfig{Name: "test", Format: "$status", MissingRequest: mode}
+		require.Nil(t, cfg.Compile())
+
+		m, err := NewNSMetrics(&cfg)
+		require.Nil(t, err)
+
+		p := newLineProcessor(&cfg, &m.Metrics)
+		p.processLine("200")
+
+		switch mode {
+		case "proceed":
+			assert.Equal(t, 1, testutil.CollectAndCount(m.countTotal), mode)
+			assert.Nil(t, m.missingRequestTotal)
+		case "skip":
+			assert.Equal(t, 0, testutil.CollectAndCount(m.countTotal), mode)
+			assert.Nil(t, m.missingRequestTotal)
+		case "count":
+			assert.Equal(t, 0, testutil.CollectAndCount(m.countTotal), mode)
+			assert.Equal(t, 1.0, testutil.ToFloat64(m.missingRequestTotal))
+		}
+	}
+}
+
+func TestProcessLineObservesUpstreamLatencyByStatus(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.NamespaceConfig{
+		Name:                  "test",
+		Format:                "$request $status $upstream_status $upstream_response_time",
+		UpstreamStatusLatency: true,
+	}
+	require.Nil(t, cfg.Compile())
+
+	m, err := NewNSMetrics(&cfg)
+	require.Nil(t, err)
+
+	p := newLineProcessor(&cfg, &m.Metrics)
+	p.processLine("GET 200 502,200 0.010,0.200")
+	p.processLine("GET 502 504 30.000")
+	p.processLine("GET 502 502,- 0.010")
+
+	assert.Equal(t, uint64(1), histogramSampleCount(t, m.upstreamStatusSeconds.WithLabelValues("2xx")))
+	assert.Equal(t, uint64(3), histogramSampleCount(t, m.upstreamStatusSeconds.WithLabelValues("5xx")))
+}
+
+func histogramSampleCount(t *testing.T, o prometheus.Observer) uint64 {
+	var metric dto.Metric
+	require.Nil(t, o.(prometheus.Metric).Write(&metric))
+
+	return metric.GetHistogram().GetSampleCount()
+}
+
+func TestUpstreamTimeFromFieldsCombinesMultipleUpstreams(t *testing.T) {
+	t.Parallel()
+
+	fields := gonx.Fields{"upstream_response_time": "0.010, 0.030 : 0.020"}
+
+	for mode, expected := range map[string]float64{"": 0.06, "sum": 0.06, "last": 0.02, "max": 0.03} {
+		v, ok := upstreamTimeFromFields(fields, mode)
+		assert.True(t, ok, mode)
+		assert.InDelta(t, expected, v, 1e-9, mode)
+	}
+
+	v, ok := upstreamTimeFromFields(gonx.Fields{"upstream_response_time": "-, 0.5"}, "sum")
+	assert.True(t, ok)
+	assert.Equal(t, 0.5, v)
+
+	_, ok = upstreamTimeFromFields(gonx.Fields{"upstream_response_time": "-"}, "sum")
+	assert.False(t, ok)
+
+	_, ok = upstreamTimeFromFields(gonx.Fields{}, "sum")
+	assert.False(t, ok)
+}
+
+type stoppableFollower struct {
+	lines   chan string
+	stopped chan struct{}
+}
+
+func (f *stoppableFollower) Lines() chan string  { return f.lines }
+func (f *stoppableFollower) OnError(func(error)) {}
+func (f *stoppableFollower) Stop() error {
+	close(f.stopped)
+	return nil
+}
+
+func TestProcessSourceStopsFollowerWhenCancelled(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.NamespaceConfig{Name: "test", Format: "$request $status"}
+	require.Nil(t, cfg.Compile())
+
+	m, err := NewNSMetrics(&cfg)
+	require.Nil(t, err)
+
+	f := &stoppableFollower{lines: make(chan string), stopped: make(chan struct{})}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		processSource(ctx, f, newLineProcessor(&cfg, &m.Metrics), nil)
+		close(done)
+	}()
+
+	f.lines <- "GET 200"
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("processSource did not return")
+	}
+
+	<-f.stopped
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.countTotal.WithLabelValues("GET", "200")))
+}
+
+func TestProcessLineAddsStatusClassLabel(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.NamespaceConfig{Name: "test", Format: "$request $status", StatusClassLabel: true}
+	require.Nil(t, cfg.Compile())
+
+	m, err := NewNSMetrics(&cfg)
+	require.Nil(t, err)
+
+	p := newLineProcessor(&cfg, &m.Metrics)
+	p.processLine("GET 404")
+	p.processLine("GET 0")
+
+	assert.Equal(t, []string{"status_class", "method", "status"}, p.labels.names)
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.countTotal.WithLabelValues("4xx", "GET", "404")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.countTotal.WithLabelValues("", "GET", "0")))
+}
+
+func TestProcessLineAddsUpstreamAddrLabel(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.NamespaceConfig{Name: "test", Format: "$request $status \"$upstream_addr\"", UpstreamAddrLabel: true}
+	require.Nil(t, cfg.Compile())
+
+	m, err := NewNSMetrics(&cfg)
+	require.Nil(t, err)
+
+	p := newLineProcessor(&cfg, &m.Metrics)
+	p.processLine(`GET 502 "10.0.0.1:80, 10.0.0.2:80"`)
+	p.processLine(`GET 200 "-"`)
+
+	assert.Equal(t, []string{"upstream_addr", "method", "status"}, p.labels.names)
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.countTotal.WithLabelValues("10.0.0.2:80", "GET", "502")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.countTotal.WithLabelValues("none", "GET", "200")))
+}
+
+func TestSelectUpstreamAddr(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "10.0.0.2:80", selectUpstreamAddr("10.0.0.1:80, 10.0.0.2:80", ""))
+	assert.Equal(t, "unix:/tmp/sock", selectUpstreamAddr("10.0.0.1:80 : unix:/tmp/sock", "last"))
+	assert.Equal(t, "10.0.0.1:80", selectUpstreamAddr("10.0.0.1:80, 10.0.0.2:80", "first"))
+	assert.Equal(t, "", selectUpstreamAddr("-", "first"))
+}
+
+func TestProcessLineAddsClientIPLabel(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.NamespaceConfig{Name: "test", Format: "$remote_addr \"$http_x_forwarded_for\" $request $status", ClientIPLabel: true}
+	require.Nil(t, cfg.Compile())
+
+	m, err := NewNSMetrics(&cfg)
+	require.Nil(t, err)
+
+	p := newLineProcessor(&cfg, &m.Metrics)
+	p.processLine(`10.0.0.1 "203.0.113.7, 10.0.0.5" GET 200`)
+	p.processLine(`10.0.0.1 "-" GET 200`)
+
+	assert.Equal(t, []string{"client_ip", "method", "status"}, p.labels.names)
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.countTotal.WithLabelValues("203.0.113.7", "GET", "200")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.countTotal.WithLabelValues("10.0.0.1", "GET", "200")))
+}
+
+func TestClientIP(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "203.0.113.7", clientIP(" 203.0.113.7 , 10.0.0.5", "10.0.0.1"))
+	assert.Equal(t, "203.0.113.7", clientIP("unknown, 203.0.113.7", "10.0.0.1"))
+	assert.Equal(t, "10.0.0.1", clientIP("", "10.0.0.1"))
+	assert.Equal(t, "10.0.0.1", clientIP("-", "10.0.0.1"))
+	assert.Equal(t, "10.0.0.1", clientIP("unknown", "10.0.0.1"))
+}
+
+func TestProcessLineAddsCacheStatusLabel(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.NamespaceConfig{Name: "test", Format: "$request $status $upstream_cache_status", CacheStatusLabel: true}
+	require.Nil(t, cfg.Compile())
+
+	m, err := NewNSMetrics(&cfg)
+	require.Nil(t, err)
+
+	p := newLineProcessor(&cfg, &m.Metrics)
+	p.processLine("GET 200 HIT")
+	p.processLine("GET 200 MISS")
+
+	assert.Equal(t, []string{"upstream_cache_status", "method", "status"}, p.labels.names)
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.countTotal.WithLabelValues("HIT", "GET", "200")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.countTotal.WithLabelValues("MISS", "GET", "200")))
+
+	cfg = config.NamespaceConfig{Name: "test", Format: "$request $status", CacheStatusLabel: true}
+	require.Nil(t, cfg.Compile())
+
+	m, err = NewNSMetrics(&cfg)
+	require.Nil(t, err)
+
+	p = newLineProcessor(&cfg, &m.Metrics)
+	p.processLine("GET 200")
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.countTotal.WithLabelValues("", "GET", "200")))
+}
+
+func TestProcessLineObservesDetailedUpstreamMetrics(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.NamespaceConfig{
+		Name:                    "test",
+		Format:                  "$request $status \"$upstream_connect_time\" \"$upstream_header_time\"",
+		DetailedUpstreamMetrics: true,
+		UpstreamTimeAggregation: "max",
+	}
+	require.Nil(t, cfg.Compile())
+
+	m, err := NewNSMetrics(&cfg)
+	require.Nil(t, err)
+
+	p := newLineProcessor(&cfg, &m.Metrics)
+	p.processLine(`GET 200 "0.010, 0.030" "0.100, 0.200"`)
+	p.processLine(`GET 200 "-" "-"`)
+
+	connect := m.upstreamConnect.hist.WithLabelValues("GET", "200")
+	assert.Equal(t, uint64(1), histogramSampleCount(t, connect))
+
+	var metric dto.Metric
+	require.Nil(t, connect.(prometheus.Metric).Write(&metric))
+	assert.InDelta(t, 0.03, metric.GetHistogram().GetSampleSum(), 1e-9)
+
+	assert.Equal(t, uint64(1), histogramSampleCount(t, m.upstreamHeader.hist.WithLabelValues("GET", "200")))
+	assert.Equal(t, 1, testutil.CollectAndCount(m.upstreamHeader.seconds))
+
+	cfg = config.NamespaceConfig{Name: "test", Format: "$request $status"}
+	require.Nil(t, cfg.Compile())
+
+	m, err = NewNSMetrics(&cfg)
+	require.Nil(t, err)
+	assert.Nil(t, m.upstreamConnect)
+}
+
+func TestProcessLineCountsRequestSize(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.NamespaceConfig{Name: "test", Format: "$request $status $request_length"}
+	require.Nil(t, cfg.Compile())
+
+	m, err := NewNSMetrics(&cfg)
+	require.Nil(t, err)
+
+	p := newLineProcessor(&cfg, &m.Metrics)
+	p.processLine("GET 200 100")
+	p.processLine("GET 200 150")
+
+	assert.Equal(t, 250.0, testutil.ToFloat64(m.requestBytesTotal))
+
+	cfg = config.NamespaceConfig{Name: "test", Format: "$request $status"}
+	require.Nil(t, cfg.Compile())
+
+	m, err = NewNSMetrics(&cfg)
+	require.Nil(t, err)
+
+	p = newLineProcessor(&cfg, &m.Metrics)
+	p.processLine("GET 200")
+
+	assert.Equal(t, 0, testutil.CollectAndCount(m.requestBytesTotal))
+}
+
+func TestProcessLineRecordsLastLineTimestampPerSource(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.NamespaceConfig{
+		Name:              "test",
+		Format:            "[$time_local] $request $status",
+		TimeFormat:        "2006-01-02 15:04:05 -0700",
+		LastLineTimestamp: true,
+	}
+	require.Nil(t, cfg.Compile())
+
+	m, err := NewNSMetrics(&cfg)
+	require.Nil(t, err)
+
+	p := newLineProcessor(&cfg, &m.Metrics)
+	p.forSource("/var/log/nginx/a.log").processLine("[2016-06-23 16:04:20 +0200] GET 200")
+	p.forSource("/var/log/nginx/b.log").processLine("[2016-06-23 16:05:20 +0200] GET 200")
+	p.forSource("/var/log/nginx/b.log").processLine("[23/Jun/2016:16:06:20 +0200] GET 200")
+
+	assert.Equal(t, 1466690660.0, testutil.ToFloat64(m.lastLineTimestamp.WithLabelValues("/var/log/nginx/a.log")))
+	assert.Equal(t, 1466690720.0, testutil.ToFloat64(m.lastLineTimestamp.WithLabelValues("/var/log/nginx/b.log")))
+}
+
+func TestProcessLineCountsRequestsByHourOfLocalTime(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.NamespaceConfig{
+		Name:           "test",
+		Format:         "[$time_local] $request $status",
+		RequestsByHour: true,
+	}
+	require.Nil(t, cfg.Compile())
+
+	m, err := NewNSMetrics(&cfg)
+	require.Nil(t, err)
+
+	p := newLineProcessor(&cfg, &m.Metrics)
+	p.processLine("[23/Jun/2016:23:30:00 +0200] GET 200")
+	p.processLine("[23/Jun/2016:23:59:59 +0200] GET 200")
+	p.processLine("[23/Jun/2016:01:15:00 -0330] GET 200")
+	p.processLine("[-] GET 200")
+
+	// the hour is the one of the timestamp as it was logged, not of UTC
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.requestsByHour.WithLabelValues("23")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.requestsByHour.WithLabelValues("1")))
+	assert.Equal(t, 2, testutil.CollectAndCount(m.requestsByHour))
+}
+
+func TestProcessLineKeepsAndDropsLines(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.NamespaceConfig{
+		Name:   "test",
+		Format: "$request_method $request_uri $status",
+		RelabelConfigs: []config.RelabelConfig{
+			{SourceValue: "request_uri", Action: "drop", Regex: "/healthz.*"},
+			{SourceValue: "request_method", Action: "keep", Regex: "GET|HEAD"},
+		},
+	}
+	require.Nil(t, cfg.Compile())
+
+	m, err := NewNSMetrics(&cfg)
+	require.Nil(t, err)
+
+	p := newLineProcessor(&cfg, &m.Metrics)
+	p.processLine("GET /healthz 200")
+	p.processLine("GET /healthz/ready 200")
+	p.processLine("POST /users 200")
+	p.processLine("GET /users 200")
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.countTotal))
+	assert.Equal(t, 4.0, testutil.ToFloat64(m.parsedLinesTotal))
+}
+
+func TestProcessLineExportsMatchGroupsAsLabels(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.NamespaceConfig{
+		Name:   "test",
+		Format: "$request_uri $status",
+		RelabelConfigs: []config.RelabelConfig{{
+			TargetLabel: "request_uri",
+			SourceValue: "request_uri",
+			Matches: []config.RelabelValueMatch{
+				{RegexpString: `^/(?P<resource>[a-z]+)/\d+/(?P<sub>[a-z]+)`, Replacement: "/$resource/:id/$sub"},
+				{RegexpString: `^/(?P<resource>[a-z]+)`, Replacement: "/$resource"},
+			},
+			GroupLabels:  true,
+			DisableLabel: true,
+		}},
+	}
+	require.Nil(t, cfg.Compile())
+	require.Nil(t, cfg.Compile())
+
+	m, err := NewNSMetrics(&cfg)
+	require.Nil(t, err)
+
+	p := newLineProcessor(&cfg, &m.Metrics)
+	p.processLine("/users/123/posts/45 200")
+	p.processLine("/users 200")
+
+	assert.Equal(t, []string{"resource", "sub", "method", "status"}, p.labels.names)
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.countTotal.WithLabelValues("users", "posts", "", "200")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.countTotal.WithLabelValues("users", "", "", "200")))
+}
+
+func TestProcessLineSamplesEveryNthLine(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.NamespaceConfig{Name: "test", Format: "$request $status $request_time", SampleEvery: 3}
+	require.Nil(t, cfg.Compile())
+
+	m, err := NewNSMetrics(&cfg)
+	require.Nil(t, err)
+
+	p := newLineProcessor(&cfg, &m.Metrics)
+	for i := 0; i < 6; i++ {
+		p.processLine("GET 200 0.1")
+	}
+
+	assert.Equal(t, 6.0, testutil.ToFloat64(m.linesTotal))
+	assert.Equal(t, 6.0, testutil.ToFloat64(m.parsedLinesTotal))
+	assert.Equal(t, 6.0, testutil.ToFloat64(m.countTotal))
+
+	// sampled lines are observed only once
+	assert.Equal(t, uint64(2), histogramSampleCount(t, m.responseSecondsHist.WithLabelValues("GET", "200")))
+}
+
+func TestProcessLineCountsAndObservesSampledLinesWithTheSameWeight(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.NamespaceConfig{Name: "test", Format: "$request $status $request_time", SampleRate: 0.3}
+	require.Nil(t, cfg.Compile())
+
+	m, err := NewNSMetrics(&cfg)
+	require.Nil(t, err)
+
+	p := newLineProcessor(&cfg, &m.Metrics)
+	for i := 0; i < 50; i++ {
+		p.processLine("GET 200 0.1")
+	}
+
+	observed := histogramSampleCount(t, m.responseSecondsHist.WithLabelValues("GET", "200"))
+	assert.Equal(t, float64(observed), testutil.ToFloat64(m.countTotal))
+}
+
+func TestProcessLineObservesUpstreamAttemptsOnlyIfEnabled(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.NamespaceConfig{Name: "test", Format: "$request $status $upstream_addr"}
+	require.Nil(t, cfg.Compile())
+
+	m, err := NewNSMetrics(&cfg)
+	require.Nil(t, err)
+	assert.Nil(t, m.upstreamAttempts)
+
+	newLineProcessor(&cfg, &m.Metrics).processLine("GET 200 10.0.0.1:80, 10.0.0.2:80")
+
+	cfg = config.NamespaceConfig{Name: "test", Format: "$request $status $upstream_addr", UpstreamAttempts: true}
+	require.Nil(t, cfg.Compile())
+
+	m, err = NewNSMetrics(&cfg)
+	require.Nil(t, err)
+
+	newLineProcessor(&cfg, &m.Metrics).processLine("GET 200 10.0.0.1:80, 10.0.0.2:80")
+	assert.Equal(t, uint64(1), histogramSampleCount(t, m.upstreamAttempts.WithLabelValues("GET", "200")))
+}
+
+func BenchmarkProcessLine(b *testing.B) {
+	cfg := config.NamespaceConfig{
+		Name:   "test",
+		Format: `$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent "$http_referer" "$http_user_agent" $request_time $upstream_response_time`,
+		Labels: map[string]string{"app": "magicapp"},
+	}
+	require.Nil(b, cfg.Compile())
+
+	m, err := NewNSMetrics(&cfg)
+	require.Nil(b, err)
+
+	p := newLineProcessor(&cfg, &m.Metrics)
+	line := `10.0.0.1 - - [23/Jun/2016:16:04:20 +0000] "GET /users/123 HTTP/1.1" 200 512 "-" "curl/7.64.1" 0.012 0.010`
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		p.processLine(line)
+	}
+}
+
+func TestProcessLineLimitsSeries(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.NamespaceConfig{Name: "test", Format: "$request $status", MaxSeries: 2}
+	require.Nil(t, cfg.Compile())
+
+	m, err := NewNSMetrics(&cfg)
+	require.Nil(t, err)
+
+	p := newLineProcessor(&cfg, &m.Metrics)
+	for _, line := range []string{"GET 200", "GET 404", "GET 200", "POST 200", "PUT 500", "GET 404"} {
+		p.processLine(line)
+	}
+
+	assert.Equal(t, []string{"over_limit", "method", "status"}, p.labels.names)
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.countTotal.WithLabelValues("false", "GET", "200")))
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.countTotal.WithLabelValues("false", "GET", "404")))
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.countTotal.WithLabelValues("true", "", "")))
+	assert.Equal(t, 3, testutil.CollectAndCount(m.countTotal))
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.seriesLimitExceeded))
+	assert.Contains(t, m.seriesLimitExceeded.Desc().String(), `fqName: "nginxlog_series_limit_exceeded_total"`)
+	assert.Contains(t, m.seriesLimitExceeded.Desc().String(), `namespace="test"`)
+
+	// the limit applies again after the metrics were reset
+	m.reset()
+	p.processLine("POST 200")
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.countTotal.WithLabelValues("false", "POST", "200")))
+}
+
+func TestProcessLineNormalizesMethod(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.NamespaceConfig{Name: "test", Format: "\"$request\" $status", NormalizeMethod: true}
+	require.Nil(t, cfg.Compile())
+
+	m, err := NewNSMetrics(&cfg)
+	require.Nil(t, err)
+
+	p := newLineProcessor(&cfg, &m.Metrics)
+	p.processLine(`"get / HTTP/1.1" 200`)
+	p.processLine(`"GET / HTTP/1.1" 200`)
+	p.processLine(`"propfind / HTTP/1.1" 200`)
+	p.processLine(`"\x16\x03\x01" 400`)
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.countTotal.WithLabelValues("GET", "200")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.countTotal.WithLabelValues("other", "200")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.countTotal.WithLabelValues("other", "400")))
+}
+
+func TestProcessLineCountsOtherMethodsAsUppercaseOther(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.NamespaceConfig{Name: "test", Format: "\"$request\" $status", NormalizeMethod: true, NormalizeOtherMethod: true}
+	require.Nil(t, cfg.Compile())
+
+	m, err := NewNSMetrics(&cfg)
+	require.Nil(t, err)
+
+	p := newLineProcessor(&cfg, &m.Metrics)
+	p.processLine(`"get / HTTP/1.1" 200`)
+	p.processLine(`"propfind / HTTP/1.1" 200`)
+	p.processLine(`"\x16\x03\x01" 200`)
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.countTotal.WithLabelValues("GET", "200")))
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.countTotal.WithLabelValues("OTHER", "200")))
+	assert.Equal(t, 2, testutil.CollectAndCount(m.countTotal))
+}
+
+func TestProcessLineAttachesTraceExemplars(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.NamespaceConfig{
+		Name:             "test",
+		Format:           "\"$request\" $status $request_time $http_x_request_id",
+		HistogramBuckets: []float64{0.1, 1},
+		ExemplarField:    "http_x_request_id",
+	}
+	require.Nil(t, cfg.Compile())
+
+	m, err := NewNSMetrics(&cfg)
+	require.Nil(t, err)
+
+	p := newLineProcessor(&cfg, &m.Metrics)
+	p.processLine(`"GET / HTTP/1.1" 200 0.05 4bf92f3577b34da6a3ce929d0e0e4736`)
+	p.processLine(`"GET / HTTP/1.1" 200 0.5 -`)
+
+	var out dto.Metric
+	require.Nil(t, m.responseSecondsHist.WithLabelValues("GET", "200").(prometheus.Metric).Write(&out))
+
+	buckets := out.GetHistogram().GetBucket()
+	require.Len(t, buckets, 2)
+	assert.Equal(t, uint64(2), out.GetHistogram().GetSampleCount())
+
+	exemplar := buckets[0].GetExemplar()
+	require.NotNil(t, exemplar)
+	assert.Equal(t, 0.05, exemplar.GetValue())
+	assert.Equal(t, "trace_id", exemplar.GetLabel()[0].GetName())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", exemplar.GetLabel()[0].GetValue())
+
+	// no exemplar is attached for unset trace IDs
+	assert.Nil(t, buckets[1].GetExemplar())
+}
+
+func TestTraceExemplar(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, prometheus.Labels{"trace_id": "abc"}, traceExemplar("abc"))
+	assert.Nil(t, traceExemplar(""))
+	assert.Nil(t, traceExemplar("-"))
+	assert.Nil(t, traceExemplar("\xff"))
+	assert.Nil(t, traceExemplar(strings.Repeat("a", prometheus.ExemplarMaxRunes-7)))
+	assert.NotNil(t, traceExemplar(strings.Repeat("a", prometheus.ExemplarMaxRunes-8)))
+}
@@ -17,10 +17,11 @@
 package prof
 
 import (
-	"fmt"
 	"os"
 	"runtime/pprof"
 	"sync"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/logging"
 )
 
 // SetupCPUProfiling starts CPU profiling if an outputFile is specified
@@ -34,7 +35,7 @@ func SetupCPUProfiling(outputFile string, stopChan <-chan bool, stopHandlers *sy
 		panic(err)
 	}
 
-	fmt.Printf("writing CPU profile to file %s\n", outputFile)
+	logging.Info("writing CPU profile", "file", outputFile)
 
 	if err := pprof.StartCPUProfile(f); err != nil {
 		panic(err)
@@ -45,7 +46,7 @@ func SetupCPUProfiling(outputFile string, stopChan <-chan bool, stopHandlers *sy
 	go func() {
 		<-stopChan
 
-		fmt.Printf("stopping CPU profiling...\n")
+		logging.Info("stopping CPU profiling")
 		pprof.StopCPUProfile()
 
 		stopHandlers.Done()
@@ -17,11 +17,12 @@
 package prof
 
 import (
-	"fmt"
 	"os"
 	"runtime"
 	"runtime/pprof"
 	"sync"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/logging"
 )
 
 // SetupMemoryProfiling starts memory profiling if an outputFile is specified
@@ -41,7 +42,7 @@ func SetupMemoryProfiling(outputFile string, stopChan <-chan bool, stopHandlers
 			panic(err)
 		}
 
-		fmt.Printf("writing memory profile to file %s\n", outputFile)
+		logging.Info("writing memory profile", "file", outputFile)
 
 		runtime.GC()
 		if err := pprof.WriteHeapProfile(f); err != nil {
@@ -0,0 +1,59 @@
+/*
+ * Copyright 2019 Martin Helmich <martin@helmich.me>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/logging"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+)
+
+// setupPushgateway starts a goroutine that periodically pushes the metrics
+// collected by gatherer to a Pushgateway (replacing all metrics that were
+// previously pushed for the same job); the metrics are pushed once more when
+// the exporter is stopped.
+func setupPushgateway(url string, job string, interval time.Duration, gatherer prometheus.Gatherer, stopChan <-chan bool, stopHandlers *sync.WaitGroup) {
+	logging.Info("pushing metrics to Pushgateway periodically", "url", url, "job", job, "interval", interval)
+
+	pusher := push.New(url, job).Gatherer(gatherer)
+
+	stopHandlers.Add(1)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := pusher.Push(); err != nil {
+					logging.Error("error while pushing metrics to Pushgateway", "url", url, "error", err)
+				}
+			case <-stopChan:
+				if err := pusher.Push(); err != nil {
+					logging.Error("error while pushing metrics to Pushgateway", "url", url, "error", err)
+				}
+
+				stopHandlers.Done()
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPushgatewayPushesMetricsWhenStopped(t *testing.T) {
+	t.Parallel()
+
+	var mutex sync.Mutex
+	var paths []string
+	var bodies [][]byte
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+
+		mutex.Lock()
+		paths = append(paths, r.Method+" "+r.URL.Path)
+		bodies = append(bodies, body)
+		mutex.Unlock()
+
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	registry := prometheus.NewRegistry()
+	counter := prometheus.NewCounter(prometheus.CounterOpts{Name: "test_total", Help: "Test counter"})
+	registry.MustRegister(counter)
+	counter.Add(3)
+
+	stopChan := make(chan bool)
+	stopHandlers := sync.WaitGroup{}
+
+	setupPushgateway(server.URL, "nginx", time.Hour, registry, stopChan, &stopHandlers)
+	close(stopChan)
+	stopHandlers.Wait()
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	assert.Equal(t, []string{"PUT /metrics/job/nginx"}, paths)
+	if assert.Len(t, bodies, 1) {
+		assert.Contains(t, string(bodies[0]), "test_total")
+	}
+}
@@ -7,14 +7,10 @@ import (
 // Map maps a sourceValue from the access log line according to the relabeling
 // config (matching against whitelists, regular expressions etc.)
 func (r *Relabeling) Map(sourceValue string) (string, error) {
-	if r.Split > 0 {
-		values := strings.Split(sourceValue, " ")
+	sourceValue = r.prepare(sourceValue)
 
-		if len(values) >= r.Split {
-			sourceValue = values[r.Split-1]
-		} else {
-			sourceValue = ""
-		}
+	if r.EmptyValue != "" && (sourceValue == "" || sourceValue == "-") {
+		return r.EmptyValue, nil
 	}
 
 	if r.WhitelistExists {
@@ -22,19 +18,129 @@ func (r *Relabeling) Map(sourceValue string) (string, error) {
 			return sourceValue, nil
 		}
 
-		return "other", nil
+		return r.OtherValueOrDefault(), nil
 	}
 
 	if len(r.Matches) > 0 {
 		replacement := ""
-		for i := range r.Matches {
-			if r.Matches[i].CompiledRegexp.MatchString(sourceValue) {
-				replacement = r.Matches[i].CompiledRegexp.ReplaceAllString(sourceValue, r.Matches[i].Replacement)
-				break
-			}
+		if i := r.firstMatch(sourceValue); i >= 0 {
+			replacement = r.Matches[i].CompiledRegexp.ReplaceAllString(sourceValue, r.Matches[i].Replacement)
 		}
 		sourceValue = replacement
 	}
 
 	return sourceValue, nil
 }
+
+// Drops returns true if a log line with the given source value should not be
+// counted at all, because the relabeling config keeps only lines whose value
+// matches its regex or drops the lines that match. Like in Map, the split,
+// path_segments and replace statements are applied to the value first.
+func (r *Relabeling) Drops(sourceValue string) bool {
+	if !r.FiltersLines() {
+		return false
+	}
+
+	sourceValue = r.prepare(sourceValue)
+
+	switch r.Action {
+	case "keep":
+		return !r.CompiledRegex.MatchString(sourceValue)
+	case "drop":
+		return r.CompiledRegex.MatchString(sourceValue)
+	}
+
+	return false
+}
+
+// Groups returns the values of the named groups (see
+// config.RelabelConfig.GroupNames) of the first match statement that matches
+// the source value. Groups that are not part of that statement, or all
+// groups if no statement matches, are empty.
+func (r *Relabeling) Groups(sourceValue string) []string {
+	values := make([]string, len(r.GroupNames))
+
+	sourceValue = r.prepare(sourceValue)
+	i := r.firstMatch(sourceValue)
+	if i < 0 {
+		return values
+	}
+
+	re := r.Matches[i].CompiledRegexp
+	match := re.FindStringSubmatch(sourceValue)
+	if match == nil {
+		return values
+	}
+
+	for k, name := range re.SubexpNames() {
+		for j := range r.GroupNames {
+			if name != "" && r.GroupNames[j] == name {
+				values[j] = match[k]
+			}
+		}
+	}
+
+	return values
+}
+
+// prepare applies the split, path_segments and replace statements to a
+// source value, before it is mapped
+func (r *Relabeling) prepare(sourceValue string) string {
+	if r.Split > 0 {
+		values := strings.Split(sourceValue, " ")
+
+		if len(values) >= r.Split {
+			sourceValue = values[r.Split-1]
+		} else {
+			sourceValue = ""
+		}
+	}
+
+	if r.Uppercase {
+		sourceValue = strings.ToUpper(sourceValue)
+	}
+
+	if r.PathSegments > 0 {
+		sourceValue = truncatePath(sourceValue, r.PathSegments)
+	}
+
+	for i := range r.Replacements {
+		if r.Replacements[i].CompiledRegexp != nil {
+			sourceValue = r.Replacements[i].CompiledRegexp.ReplaceAllString(sourceValue, r.Replacements[i].Replacement)
+		}
+	}
+
+	return sourceValue
+}
+
+// firstMatch returns the index of the first match statement that matches
+// value, or -1 if none matches
+func (r *Relabeling) firstMatch(value string) int {
+	if r.index != nil {
+		return r.index.first(r.Matches, value)
+	}
+
+	for i := range r.Matches {
+		if r.Matches[i].CompiledRegexp.MatchString(value) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// truncatePath strips the query string from a request path and truncates it
+// to its first n segments (so that "/api/v1/users/123?foo=bar" becomes
+// "/api/v1" for n=2)
+func truncatePath(path string, n int) string {
+	if i := strings.IndexByte(path, '?'); i >= 0 {
+		path = path[:i]
+	}
+
+	parts := strings.SplitN(path, "/", n+2)
+	if len(parts) <= n+1 {
+		return path
+	}
+
+	return strings.Join(parts[:n+1], "/")
+}
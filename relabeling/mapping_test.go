@@ -52,3 +52,117 @@ func TestRequestURIMapping(t *testing.T) {
 	assertMapping(t, r, "GET /users/12345/about HTTP/1.1", "/users/:id/about")
 	assertMapping(t, r, "GET /v1/users/12345 HTTP/1.1", "")
 }
+
+func TestPathSegmentsMapping(t *testing.T) {
+	t.Parallel()
+
+	r, err := buildRelabeling(config.RelabelConfig{
+		Split:        2,
+		PathSegments: 2,
+		Matches: []config.RelabelValueMatch{
+			{RegexpString: "^/api/v1$", Replacement: "/api/v1"},
+		},
+	})
+	if err != nil {
+		t.Error(err)
+	}
+
+	assertMapping(t, r, "GET /api/v1/users/12345 HTTP/1.1", "/api/v1")
+	assertMapping(t, r, "GET /api/v1?foo=bar HTTP/1.1", "/api/v1")
+	assertMapping(t, r, "GET /api HTTP/1.1", "")
+}
+
+func TestReplacementsCollapseHighEntropyValues(t *testing.T) {
+	t.Parallel()
+
+	r, err := buildRelabeling(config.RelabelConfig{
+		Replacements: []config.RelabelValueMatch{
+			{RegexpString: "[0-9a-f]{8,}", Replacement: "X"},
+			{RegexpString: "[0-9]+$", Replacement: "N"},
+		},
+		Whitelist: []string{"session-X.example.com", "node-N"},
+	})
+	if err != nil {
+		t.Error(err)
+	}
+
+	assertMapping(t, r, "session-deadbeef42.example.com", "session-X.example.com")
+	assertMapping(t, r, "node-12", "node-N")
+	assertMapping(t, r, "foo", "other")
+}
+
+func TestEmptyValueMapping(t *testing.T) {
+	t.Parallel()
+
+	r, err := buildRelabeling(config.RelabelConfig{
+		EmptyValue: "none",
+		Whitelist:  []string{"example.com"},
+	})
+	if err != nil {
+		t.Error(err)
+	}
+
+	assertMapping(t, r, "example.com", "example.com")
+	assertMapping(t, r, "example.org", "other")
+	assertMapping(t, r, "-", "none")
+	assertMapping(t, r, "", "none")
+}
+
+func TestGroupsOfFirstMatch(t *testing.T) {
+	t.Parallel()
+
+	r, err := buildRelabeling(config.RelabelConfig{
+		Matches: []config.RelabelValueMatch{
+			{RegexpString: `^/(?P<resource>[a-z]+)/\d+/(?P<sub>[a-z]+)`, Replacement: "/$resource/:id/$sub"},
+			{RegexpString: `^/(?P<resource>[a-z]+)`, Replacement: "/$resource"},
+		},
+		GroupLabels: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(r.GroupNames) != 2 || r.GroupNames[0] != "resource" || r.GroupNames[1] != "sub" {
+		t.Fatalf("unexpected group names %v", r.GroupNames)
+	}
+
+	for in, expected := range map[string][2]string{
+		"/users/123/posts/45": {"users", "posts"},
+		"/users":              {"users", ""},
+		"/123":                {"", ""},
+	} {
+		groups := r.Groups(in)
+		if groups[0] != expected[0] || groups[1] != expected[1] {
+			t.Errorf("expected groups %v of '%s', but got %v", expected, in, groups)
+		}
+	}
+}
+
+func TestUppercaseMappingAppliesBeforeWhitelist(t *testing.T) {
+	t.Parallel()
+
+	r, err := buildRelabeling(config.RelabelConfig{Split: 1, Whitelist: []string{"GET"}, Uppercase: true})
+	if err != nil {
+		t.Error(err)
+	}
+
+	assertMapping(t, r, "get /", "GET")
+	assertMapping(t, r, "PROPFIND /", "other")
+}
+
+func TestDropsAppliesSplitBeforeMatching(t *testing.T) {
+	t.Parallel()
+
+	r, err := buildRelabeling(config.RelabelConfig{SourceValue: "request", Split: 2, Action: "drop", Regex: "/healthz.*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !r.Drops("GET /healthz/ready HTTP/1.1") {
+		t.Error("expected health check request to be dropped")
+	}
+
+	if r.Drops("GET /users HTTP/1.1") {
+		t.Error("expected request not to be dropped")
+	}
+}
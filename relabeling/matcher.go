@@ -0,0 +1,110 @@
+package relabeling
+
+import (
+	"regexp/syntax"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/config"
+)
+
+// matchIndex speeds up finding the first match statement that matches a
+// value. Most route expressions are anchored at the start and begin with a
+// literal path (like "^/users/[0-9]+"); these are stored in a prefix trie, so
+// that only the expressions whose literal prefix matches the value need to be
+// evaluated. All other expressions are always evaluated.
+type matchIndex struct {
+	root      *prefixNode
+	unindexed []int
+}
+
+type prefixNode struct {
+	children map[byte]*prefixNode
+	matches  []int
+}
+
+func newMatchIndex(matches []config.RelabelValueMatch) *matchIndex {
+	m := &matchIndex{root: &prefixNode{}}
+
+	for i := range matches {
+		prefix, ok := anchoredLiteralPrefix(matches[i].RegexpString)
+		if !ok {
+			m.unindexed = append(m.unindexed, i)
+			continue
+		}
+
+		node := m.root
+		for j := 0; j < len(prefix); j++ {
+			if node.children == nil {
+				node.children = make(map[byte]*prefixNode)
+			}
+
+			child, ok := node.children[prefix[j]]
+			if !ok {
+				child = &prefixNode{}
+				node.children[prefix[j]] = child
+			}
+
+			node = child
+		}
+
+		node.matches = append(node.matches, i)
+	}
+
+	return m
+}
+
+// first returns the index of the first match statement that matches value,
+// or -1 if none matches. Just like evaluating all match statements in order,
+// the statement that was declared first wins if several of them match.
+func (m *matchIndex) first(matches []config.RelabelValueMatch, value string) int {
+	var buf [16]int
+	candidates := append(buf[:0], m.unindexed...)
+
+	node := m.root
+	candidates = append(candidates, node.matches...)
+
+	for i := 0; i < len(value) && node.children != nil; i++ {
+		next, ok := node.children[value[i]]
+		if !ok {
+			break
+		}
+
+		node = next
+		candidates = append(candidates, node.matches...)
+	}
+
+	// candidates are usually very few, so insertion sort is sufficient
+	for i := 1; i < len(candidates); i++ {
+		for j := i; j > 0 && candidates[j] < candidates[j-1]; j-- {
+			candidates[j], candidates[j-1] = candidates[j-1], candidates[j]
+		}
+	}
+
+	for _, i := range candidates {
+		if matches[i].CompiledRegexp != nil && matches[i].CompiledRegexp.MatchString(value) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// anchoredLiteralPrefix returns the literal string that every value matched by
+// expr must start with, if expr is anchored at the beginning of the text.
+func anchoredLiteralPrefix(expr string) (string, bool) {
+	re, err := syntax.Parse(expr, syntax.Perl)
+	if err != nil {
+		return "", false
+	}
+
+	re = re.Simplify()
+	if re.Op != syntax.OpConcat || len(re.Sub) < 2 || re.Sub[0].Op != syntax.OpBeginText {
+		return "", false
+	}
+
+	prefix := re.Sub[1]
+	if prefix.Op != syntax.OpLiteral || prefix.Flags&syntax.FoldCase != 0 {
+		return "", false
+	}
+
+	return string(prefix.Rune), true
+}
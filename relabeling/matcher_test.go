@@ -0,0 +1,96 @@
+package relabeling
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/config"
+)
+
+func TestAnchoredLiteralPrefix(t *testing.T) {
+	t.Parallel()
+
+	for expr, expected := range map[string]string{
+		"^/users/[0-9]+": "/users/",
+		"^/profile$":     "/profile",
+		"^/users?":       "/user",
+	} {
+		prefix, ok := anchoredLiteralPrefix(expr)
+		if !ok || prefix != expected {
+			t.Errorf("expected prefix '%s' for '%s', but got '%s'", expected, expr, prefix)
+		}
+	}
+
+	for _, expr := range []string{"/users", "(?i)^/users", "^[a-z]+", "(?m)^/users"} {
+		if _, ok := anchoredLiteralPrefix(expr); ok {
+			t.Errorf("expected no prefix for '%s'", expr)
+		}
+	}
+}
+
+func TestMatchIndexKeepsDeclarationOrder(t *testing.T) {
+	t.Parallel()
+
+	r, err := buildRelabeling(config.RelabelConfig{
+		Matches: []config.RelabelValueMatch{
+			{RegexpString: "^/users/me", Replacement: "/users/me"},
+			{RegexpString: "[0-9]+$", Replacement: ":number"},
+			{RegexpString: "^/users/[0-9]+", Replacement: "/users/:id"},
+			{RegexpString: "^/users", Replacement: "/users"},
+		},
+	})
+	if err != nil {
+		t.Error(err)
+	}
+
+	assertMapping(t, r, "/users/me", "/users/me")
+	assertMapping(t, r, "/users/123", "/users/:number")
+	assertMapping(t, r, "/users/123/profile", "/users/:id/profile")
+	assertMapping(t, r, "/users", "/users")
+	assertMapping(t, r, "/profile", "")
+}
+
+func buildRouteConfig(n int) config.RelabelConfig {
+	cfg := config.RelabelConfig{}
+
+	for i := 0; i < n; i++ {
+		cfg.Matches = append(cfg.Matches, config.RelabelValueMatch{
+			RegexpString: fmt.Sprintf("^/api/v1/resource%d/[0-9]+", i),
+			Replacement:  fmt.Sprintf("/api/v1/resource%d/:id", i),
+		})
+	}
+
+	if err := cfg.Compile(); err != nil {
+		panic(err)
+	}
+
+	return cfg
+}
+
+func benchmarkRoutes(b *testing.B, r *Relabeling, value string) {
+	for i := 0; i < b.N; i++ {
+		if _, err := r.Map(value); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRoutesNaive(b *testing.B) {
+	cfg := buildRouteConfig(60)
+	benchmarkRoutes(b, &Relabeling{RelabelConfig: cfg}, "/api/v1/resource55/12345")
+}
+
+func BenchmarkRoutesIndexed(b *testing.B) {
+	cfg := buildRouteConfig(60)
+	benchmarkRoutes(b, NewRelabeling(&cfg), "/api/v1/resource55/12345")
+}
+
+func BenchmarkRoutesNaiveUnmatched(b *testing.B) {
+	cfg := buildRouteConfig(60)
+	benchmarkRoutes(b, &Relabeling{RelabelConfig: cfg}, "/static/app.js")
+}
+
+func BenchmarkRoutesIndexedUnmatched(b *testing.B) {
+	cfg := buildRouteConfig(60)
+	benchmarkRoutes(b, NewRelabeling(&cfg), "/static/app.js")
+}
@@ -6,6 +6,8 @@ import "github.com/martin-helmich/prometheus-nginxlog-exporter/config"
 // executing the rules specified in the original configuration
 type Relabeling struct {
 	config.RelabelConfig
+
+	index *matchIndex
 }
 
 // NewRelabelings creates a new set of relabelling runners from a list of
@@ -22,7 +24,13 @@ func NewRelabelings(cfgs []config.RelabelConfig) []*Relabeling {
 
 // NewRelabeling creates a single new relabelling runner
 func NewRelabeling(cfg *config.RelabelConfig) *Relabeling {
-	return &Relabeling{*cfg}
+	r := &Relabeling{RelabelConfig: *cfg}
+
+	if len(cfg.Matches) > 0 {
+		r.index = newMatchIndex(cfg.Matches)
+	}
+
+	return r
 }
 
 // UniqueRelabelings creates a unique relabelings, the duplicated one at the end will discard.
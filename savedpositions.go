@@ -0,0 +1,176 @@
+/*
+ * Copyright 2019 Martin Helmich <martin@helmich.me>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/logging"
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/tail"
+)
+
+// positionsSaveInterval is the interval in which the read offsets of log
+// files are saved to the positions file
+const positionsSaveInterval = 5 * time.Second
+
+// savedPosition is the read offset of a log file, as saved in a positions
+// file
+type savedPosition struct {
+	File   string `json:"file"`
+	Inode  uint64 `json:"inode"`
+	Offset int64  `json:"offset"`
+}
+
+// savedPositions contains the read offsets of the log files of a namespace,
+// by inode and file name, so that reading the files can be resumed after a
+// restart (see the read_from source option)
+type savedPositions struct {
+	filename string
+
+	mutex     sync.Mutex
+	positions map[string]savedPosition
+}
+
+func positionKey(file string, inode uint64) string {
+	return fmt.Sprintf("%d:%s", inode, file)
+}
+
+// loadSavedPositions reads a positions file; if it does not exist (yet), no
+// positions are known
+func loadSavedPositions(filename string) (*savedPositions, error) {
+	s := &savedPositions{filename: filename, positions: make(map[string]savedPosition)}
+
+	contents, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(contents, &s.positions); err != nil {
+		return nil, fmt.Errorf("could not parse positions file %s: %s", filename, err.Error())
+	}
+
+	return s, nil
+}
+
+// offset returns the offset at which reading a log file should resume: the
+// saved offset, or the beginning of the file if it was replaced since (as
+// after log rotation). Files without a saved offset are read from their end.
+func (s *savedPositions) offset(filename string) int64 {
+	fi, err := os.Stat(filename)
+	if err != nil {
+		return tail.EndOfFile
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if p, ok := s.positions[positionKey(filename, fileInode(fi))]; ok {
+		return p.Offset
+	}
+
+	for _, p := range s.positions {
+		if p.File == filename {
+			return 0
+		}
+	}
+
+	return tail.EndOfFile
+}
+
+// update records the current read offsets of log files
+func (s *savedPositions) update(positions []tail.Position) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, p := range positions {
+		fi, err := os.Stat(p.Filename)
+		if err != nil {
+			continue
+		}
+
+		for key, saved := range s.positions {
+			if saved.File == p.Filename {
+				delete(s.positions, key)
+			}
+		}
+
+		inode := fileInode(fi)
+		s.positions[positionKey(p.Filename, inode)] = savedPosition{File: p.Filename, Inode: inode, Offset: p.Offset}
+	}
+}
+
+// save writes the positions file. The file is replaced atomically, so that
+// it is not truncated if the exporter is killed while writing it.
+func (s *savedPositions) save() error {
+	s.mutex.Lock()
+	contents, err := json.Marshal(s.positions)
+	s.mutex.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(s.filename), filepath.Base(s.filename)+".tmp")
+	if err != nil {
+		return err
+	}
+
+	if _, err := tmp.Write(contents); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.filename)
+}
+
+// savePositionsPeriodically saves the read offsets of the followers of a
+// namespace until ctx is cancelled, and once more when it is
+func savePositionsPeriodically(ctx context.Context, s *savedPositions, c *filePositionCollector) {
+	ticker := time.NewTicker(positionsSaveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+		}
+
+		s.update(c.positions())
+		if err := s.save(); err != nil {
+			logging.Error("could not save positions file", "file", s.filename, "error", err)
+		}
+
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/tail"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSavedPositionsResumeUnlessFileWasReplaced(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "nginxlog-exporter")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	logFile := filepath.Join(dir, "access.log")
+	otherFile := filepath.Join(dir, "other.log")
+	positionsFile := filepath.Join(dir, "positions.json")
+
+	require.Nil(t, ioutil.WriteFile(logFile, []byte("first\nsecond\n"), 0644))
+	require.Nil(t, ioutil.WriteFile(otherFile, []byte("first\n"), 0644))
+
+	s, err := loadSavedPositions(positionsFile)
+	require.Nil(t, err)
+	assert.Equal(t, tail.EndOfFile, s.offset(logFile))
+
+	s.update([]tail.Position{{Filename: logFile, Offset: 6, Size: 13}})
+	require.Nil(t, s.save())
+
+	s, err = loadSavedPositions(positionsFile)
+	require.Nil(t, err)
+	assert.Equal(t, int64(6), s.offset(logFile))
+	assert.Equal(t, tail.EndOfFile, s.offset(otherFile))
+
+	// after log rotation, the file with the same name is a different one
+	require.Nil(t, os.Rename(otherFile, logFile))
+	assert.Equal(t, int64(0), s.offset(logFile))
+}
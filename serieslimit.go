@@ -0,0 +1,92 @@
+/*
+ * Copyright 2019 Martin Helmich <martin@helmich.me>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import "sync"
+
+// seriesLimit tracks the distinct label value combinations of the per-line
+// metrics of a namespace (by their hashes), and admits new combinations only
+// as long as the limit was not reached yet
+type seriesLimit struct {
+	max int
+
+	mutex sync.RWMutex
+	seen  map[uint64]struct{}
+}
+
+func newSeriesLimit(max int) *seriesLimit {
+	return &seriesLimit{max: max, seen: make(map[uint64]struct{})}
+}
+
+// admit returns true if the given label values were seen before, or could
+// still be added without exceeding the limit
+func (s *seriesLimit) admit(values []string) bool {
+	h := hashLabelValues(values)
+
+	s.mutex.RLock()
+	_, seen := s.seen[h]
+	full := len(s.seen) >= s.max
+	s.mutex.RUnlock()
+
+	if seen || full {
+		return seen
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, seen := s.seen[h]; seen {
+		return true
+	}
+
+	if len(s.seen) >= s.max {
+		return false
+	}
+
+	s.seen[h] = struct{}{}
+	return true
+}
+
+// reset forgets all label value combinations (when the metrics are reset)
+func (s *seriesLimit) reset() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.seen = make(map[uint64]struct{})
+}
+
+// hashLabelValues computes the 64-bit FNV-1a hash of a list of label values
+// (separated by a byte that cannot occur in UTF-8), without allocating
+func hashLabelValues(values []string) uint64 {
+	const (
+		offset64 = 14695981039346656037
+		prime64  = 1099511628211
+	)
+
+	h := uint64(offset64)
+	for _, v := range values {
+		for i := 0; i < len(v); i++ {
+			h ^= uint64(v[i])
+			h *= prime64
+		}
+
+		h ^= 0xff
+		h *= prime64
+	}
+
+	return h
+}
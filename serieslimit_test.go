@@ -0,0 +1,58 @@
+package main
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSeriesLimitAdmitsKnownSeriesOnceFull(t *testing.T) {
+	t.Parallel()
+
+	s := newSeriesLimit(2)
+
+	assert.True(t, s.admit([]string{"GET", "200"}))
+	assert.True(t, s.admit([]string{"GET", "404"}))
+	assert.False(t, s.admit([]string{"POST", "200"}))
+	assert.True(t, s.admit([]string{"GET", "200"}))
+}
+
+func TestSeriesLimitSeparatesLabelValues(t *testing.T) {
+	t.Parallel()
+
+	s := newSeriesLimit(1)
+
+	assert.True(t, s.admit([]string{"ab", "c"}))
+	assert.False(t, s.admit([]string{"a", "bc"}))
+}
+
+func TestSeriesLimitIsConcurrencySafe(t *testing.T) {
+	t.Parallel()
+
+	s := newSeriesLimit(10)
+	wg := sync.WaitGroup{}
+	admitted := make(chan string, 100)
+
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			value := string(rune('a' + i%20))
+			if s.admit([]string{value}) {
+				admitted <- value
+			}
+		}(i)
+	}
+
+	wg.Wait()
+	close(admitted)
+
+	distinct := make(map[string]struct{})
+	for v := range admitted {
+		distinct[v] = struct{}{}
+	}
+
+	assert.Len(t, distinct, 10)
+}
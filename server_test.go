@@ -0,0 +1,17 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListenAndServeRejectsInvalidClientCA(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.ListenConfig{CertFile: "cert.pem", KeyFile: "key.pem", ClientCAFile: "/nonexistent/ca.pem"}
+
+	assert.NotNil(t, listenAndServe(&http.Server{Addr: "127.0.0.1:0"}, &cfg))
+}
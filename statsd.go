@@ -0,0 +1,247 @@
+/*
+ * Copyright 2019 Martin Helmich <martin@helmich.me>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/config"
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/logging"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	statsdErrorLogLimit    = 1
+	statsdErrorLogInterval = time.Minute
+
+	// statsdQueueSize is the number of metrics that are queued for sending;
+	// further metrics are dropped until the queue has room again
+	statsdQueueSize = 10000
+
+	// statsdTimeout limits the time for connecting to the StatsD server, and
+	// for writing a single metric
+	statsdTimeout = 5 * time.Second
+)
+
+// statsdClient sends metrics to a StatsD server. Metrics are queued, and sent
+// in the background; the connection is opened when the first metric is sent,
+// and opened again after an error.
+type statsdClient struct {
+	network   string
+	address   string
+	prefix    string
+	dogstatsd bool
+
+	queue   chan string
+	dropped prometheus.Counter
+	done    chan struct{}
+	stopped chan struct{}
+
+	conn     net.Conn
+	errorLog *logging.Limiter
+}
+
+func newStatsDClient(cfg *config.StatsDConfig) *statsdClient {
+	prefix := cfg.Prefix
+	if prefix != "" && !strings.HasSuffix(prefix, ".") {
+		prefix += "."
+	}
+
+	c := &statsdClient{
+		network:   cfg.ProtocolOrDefault(),
+		address:   cfg.Address,
+		prefix:    prefix,
+		dogstatsd: cfg.Tagging == "dogstatsd",
+		queue:     make(chan string, statsdQueueSize),
+		done:      make(chan struct{}),
+		stopped:   make(chan struct{}),
+		errorLog:  logging.NewLimiter(statsdErrorLogLimit, statsdErrorLogInterval),
+		dropped: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "nginxlog_statsd_dropped_total",
+			Help: "Total number of metrics that were not sent to the StatsD server because its queue was full",
+		}),
+	}
+
+	go c.run()
+
+	return c
+}
+
+// send queues a single metric, given in the StatsD line format without the
+// prefix; if the queue is full, the metric is dropped
+func (c *statsdClient) send(line string) {
+	select {
+	case c.queue <- line:
+	default:
+		c.dropped.Inc()
+	}
+}
+
+// run sends the queued metrics until the client is closed; the metrics that
+// are still queued then are sent before it returns
+func (c *statsdClient) run() {
+	defer close(c.stopped)
+
+	for {
+		select {
+		case line := <-c.queue:
+			c.write(line)
+		case <-c.done:
+			for {
+				select {
+				case line := <-c.queue:
+					c.write(line)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// write sends a single metric to the StatsD server
+func (c *statsdClient) write(line string) {
+	var err error
+	if c.conn == nil {
+		c.conn, err = net.DialTimeout(c.network, c.address, statsdTimeout)
+	}
+
+	if err == nil {
+		payload := c.prefix + line
+		if c.network == "tcp" {
+			payload += "\n"
+		}
+
+		if err = c.conn.SetWriteDeadline(time.Now().Add(statsdTimeout)); err == nil {
+			_, err = c.conn.Write([]byte(payload))
+		}
+	}
+
+	if err != nil {
+		if c.conn != nil {
+			c.conn.Close()
+			c.conn = nil
+		}
+
+		if ok, suppressed := c.errorLog.Allow(); ok {
+			keyvals := []interface{}{"address", c.address, "error", err}
+			if suppressed > 0 {
+				keyvals = append(keyvals, "suppressed", suppressed)
+			}
+
+			logging.Error("could not send metrics to StatsD server", keyvals...)
+		}
+	}
+}
+
+// close sends the metrics that are still queued, and closes the connection;
+// metrics that are queued afterwards are never sent
+func (c *statsdClient) close() {
+	close(c.done)
+	<-c.stopped
+
+	if c.conn != nil {
+		c.conn.Close()
+		c.conn = nil
+	}
+}
+
+// statsdMetrics sends the per-line metrics of a namespace to a StatsD server,
+// using the same names as the Prometheus metrics (except for the timers, which
+// are sent in milliseconds)
+type statsdMetrics struct {
+	client *statsdClient
+
+	countTotal   string
+	bytesTotal   string
+	upstreamTime string
+	responseTime string
+
+	// constTags are the namespace labels, already formatted as DogStatsD tags
+	constTags []string
+}
+
+func newStatsDMetrics(client *statsdClient, cfg *config.NamespaceConfig) *statsdMetrics {
+	name := func(metric string) string {
+		return statsdName(prometheus.BuildFQName(cfg.NamespacePrefix, "", cfg.MetricName(metric)))
+	}
+
+	m := &statsdMetrics{
+		client:       client,
+		countTotal:   name("http_response_count_total"),
+		bytesTotal:   name("http_response_size_bytes"),
+		upstreamTime: name("http_upstream_time"),
+		responseTime: name("http_response_time"),
+	}
+
+	if client.dogstatsd {
+		for label, value := range cfg.NamespaceLabels {
+			m.constTags = append(m.constTags, statsdTag(label, value))
+		}
+		sort.Strings(m.constTags)
+	}
+
+	return m
+}
+
+// count adds value to the counter with the given name
+func (m *statsdMetrics) count(name string, value float64, labelNames []string, labelValues []string) {
+	m.client.send(name + ":" + strconv.FormatFloat(value, 'f', -1, 64) + "|c" + m.tags(labelNames, labelValues))
+}
+
+// timing observes a duration (given in seconds) for the timer with the given
+// name; weight is the number of log lines that the observation accounts for,
+// and is sent as sample rate
+func (m *statsdMetrics) timing(name string, seconds float64, weight float64, labelNames []string, labelValues []string) {
+	line := name + ":" + strconv.FormatFloat(seconds*1000, 'f', -1, 64) + "|ms"
+	if weight > 0 && weight != 1 {
+		line += "|@" + strconv.FormatFloat(1/weight, 'f', -1, 64)
+	}
+
+	m.client.send(line + m.tags(labelNames, labelValues))
+}
+
+// tags formats the namespace labels and the given labels as DogStatsD tags;
+// it returns an empty string if tagging is disabled
+func (m *statsdMetrics) tags(labelNames []string, labelValues []string) string {
+	if !m.client.dogstatsd || len(m.constTags)+len(labelNames) == 0 {
+		return ""
+	}
+
+	tags := append([]string{}, m.constTags...)
+	for i := range labelNames {
+		tags = append(tags, statsdTag(labelNames[i], labelValues[i]))
+	}
+
+	return "|#" + strings.Join(tags, ",")
+}
+
+var statsdNameReplacer = strings.NewReplacer(":", "_", "|", "_", "@", "_", "\n", "_")
+
+func statsdName(name string) string {
+	return statsdNameReplacer.Replace(name)
+}
+
+var statsdTagReplacer = strings.NewReplacer(",", "_", "|", "_", "#", "_", "\n", "_")
+
+func statsdTag(name string, value string) string {
+	return statsdTagReplacer.Replace(name) + ":" + statsdTagReplacer.Replace(value)
+}
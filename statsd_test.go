@@ -0,0 +1,108 @@
+package main
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/config"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// listenStatsD starts a UDP listener that stands in for a StatsD server, and
+// returns it along with a function that reads the next n packets
+func listenStatsD(t *testing.T) (net.PacketConn, func(n int) []string) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.Nil(t, err)
+
+	return conn, func(n int) []string {
+		buf := make([]byte, 1024)
+		packets := make([]string, 0, n)
+
+		for len(packets) < n {
+			require.Nil(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+
+			read, _, err := conn.ReadFrom(buf)
+			require.Nil(t, err)
+
+			packets = append(packets, string(buf[:read]))
+		}
+
+		return packets
+	}
+}
+
+func TestProcessLineSendsMetricsToStatsD(t *testing.T) {
+	t.Parallel()
+
+	server, read := listenStatsD(t)
+	defer server.Close()
+
+	cfg := config.NamespaceConfig{
+		Name:   "test",
+		Format: "$request_method $status $body_bytes_sent $upstream_response_time $request_time",
+	}
+
+	m, err := NewNSMetrics(&cfg)
+	require.Nil(t, err)
+
+	client := newStatsDClient(&config.StatsDConfig{Address: server.LocalAddr().String(), Prefix: "nginx"})
+	defer client.close()
+	m.statsd = newStatsDMetrics(client, &cfg)
+
+	p := newLineProcessor(&cfg, &m.Metrics)
+	p.processLine("GET 200 512 0.25 0.5")
+
+	assert.Equal(t, []string{
+		"nginx.test_http_response_count_total:1|c",
+		"nginx.test_http_response_size_bytes:512|c",
+		"nginx.test_http_upstream_time:250|ms",
+		"nginx.test_http_response_time:500|ms",
+	}, read(4))
+}
+
+func TestStatsDMetricsSendDogStatsDTags(t *testing.T) {
+	t.Parallel()
+
+	server, read := listenStatsD(t)
+	defer server.Close()
+
+	cfg := config.NamespaceConfig{
+		Name:   "test",
+		Format: "$request_method $status",
+		NamespaceLabels: map[string]string{
+			"vhost":   "example.com",
+			"cluster": "a,b",
+		},
+	}
+	require.Nil(t, cfg.Compile())
+
+	client := newStatsDClient(&config.StatsDConfig{Address: server.LocalAddr().String(), Tagging: "dogstatsd"})
+	defer client.close()
+	m := newStatsDMetrics(client, &cfg)
+
+	m.count(m.countTotal, 2, []string{"method", "status"}, []string{"GET", "200"})
+	m.timing(m.responseTime, 0.1, 10, nil, nil)
+
+	packets := read(2)
+	assert.Equal(t, "test_http_response_count_total:2|c|#cluster:a_b,vhost:example.com,method:GET,status:200", packets[0])
+	assert.True(t, strings.HasPrefix(packets[1], "test_http_response_time:100|ms|@0.1|#"), packets[1])
+}
+
+func TestStatsDClientDropsMetricsWhenQueueIsFull(t *testing.T) {
+	t.Parallel()
+
+	client := newStatsDClient(&config.StatsDConfig{Address: "127.0.0.1:1"})
+	close(client.done)
+	<-client.stopped
+
+	// nothing sends the queued metrics anymore
+	for i := 0; i < statsdQueueSize+3; i++ {
+		client.send("test:1|c")
+	}
+
+	assert.Equal(t, float64(3), testutil.ToFloat64(client.dropped))
+}
@@ -37,8 +37,8 @@ func openListener(s *syslog.Server, c string) error {
 	return nil
 }
 
-// Listen opens up a new syslog server on either a TCP or UDP port
-func Listen(conn string, formatSpec string) (syslog.LogPartsChannel, *syslog.Server, error) {
+// Listen opens up a new syslog server on one or more TCP or UDP ports
+func Listen(conns []string, formatSpec string) (syslog.LogPartsChannel, *syslog.Server, error) {
 	channel := make(syslog.LogPartsChannel)
 	handler := syslog.NewChannelHandler(channel)
 
@@ -58,20 +58,20 @@ func Listen(conn string, formatSpec string) (syslog.LogPartsChannel, *syslog.Ser
 	case "":
 		format = syslog.Automatic
 	default:
-		return nil, nil, fmt.Errorf("unknown syslog format: '%s'", format)
+		return nil, nil, fmt.Errorf("unknown syslog format: '%s'", formatSpec)
 	}
 
 	//RFC3164 or RFC5424 or RFC6587. nginx works on RFC3164
 	server.SetFormat(format)
 	server.SetHandler(handler)
 
-	err := openListener(server, conn)
-	if err != nil {
-		return nil, nil, err
+	for _, conn := range conns {
+		if err := openListener(server, conn); err != nil {
+			return nil, nil, err
+		}
 	}
 
-	err = server.Boot()
-	if err != nil {
+	if err := server.Boot(); err != nil {
 		return nil, nil, err
 	}
 
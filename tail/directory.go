@@ -0,0 +1,183 @@
+package tail
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/hpcloud/tail"
+)
+
+type directoryFollower struct {
+	dir     string
+	pattern string
+	opts    Options
+
+	watcher *fsnotify.Watcher
+	line    chan string
+	errors  chan error
+
+	// done is closed when the follower is stopped
+	done     chan struct{}
+	stopOnce sync.Once
+
+	mutex sync.Mutex
+	tails map[string]*trackedTail
+}
+
+// NewDirectoryFollower creates a new Follower instance that follows all files
+// in a directory whose name matches a pattern (in the syntax of
+// filepath.Match). Files that are created in the directory are followed from
+// their beginning, files that are removed or renamed are no longer followed.
+// Of opts, only Poll applies.
+func NewDirectoryFollower(dir string, pattern string, opts Options) (Follower, error) {
+	if pattern == "" {
+		pattern = "*"
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	d := &directoryFollower{
+		dir:     dir,
+		pattern: pattern,
+		opts:    opts,
+		watcher: watcher,
+		line:    make(chan string),
+		errors:  make(chan error),
+		done:    make(chan struct{}),
+		tails:   make(map[string]*trackedTail),
+	}
+
+	if err := watcher.Add(dir); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+
+	existing, err := filepath.Glob(filepath.Join(dir, pattern))
+	if err != nil {
+		watcher.Close()
+		return nil, err
+	}
+
+	for _, filename := range existing {
+		if err := d.follow(filename, true); err != nil {
+			watcher.Close()
+			return nil, err
+		}
+	}
+
+	go d.watch()
+
+	return d, nil
+}
+
+func (d *directoryFollower) matches(filename string) bool {
+	matched, err := filepath.Match(d.pattern, filepath.Base(filename))
+	return err == nil && matched
+}
+
+func (d *directoryFollower) follow(filename string, fromEnd bool) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if _, ok := d.tails[filename]; ok {
+		return nil
+	}
+
+	// the follower was stopped in the meantime
+	select {
+	case <-d.done:
+		return nil
+	default:
+	}
+
+	var seekInfo *tail.SeekInfo
+	if fromEnd {
+		seekInfo = &tail.SeekInfo{Offset: 0, Whence: os.SEEK_END}
+	}
+
+	t, err := tailFile(filename, tail.Config{
+		Follow:   true,
+		ReOpen:   false,
+		Poll:     d.opts.Poll,
+		Location: seekInfo,
+	})
+	if err != nil {
+		return err
+	}
+
+	d.tails[filename] = t
+
+	go forwardLines(t, d.line, d.done, nil)
+
+	return nil
+}
+
+func (d *directoryFollower) unfollow(filename string) {
+	d.mutex.Lock()
+	t, ok := d.tails[filename]
+	delete(d.tails, filename)
+	d.mutex.Unlock()
+
+	if !ok {
+		return
+	}
+
+	if err := stopTail(t); err != nil {
+		d.sendError(err)
+	}
+}
+
+// sendError emits an error, unless the follower is stopped
+func (d *directoryFollower) sendError(err error) {
+	select {
+	case d.errors <- err:
+	case <-d.done:
+	}
+}
+
+func (d *directoryFollower) watch() {
+	for {
+		select {
+		case event, ok := <-d.watcher.Events:
+			if !ok {
+				return
+			}
+
+			if !d.matches(event.Name) {
+				continue
+			}
+
+			switch {
+			case event.Op&fsnotify.Create != 0:
+				if err := d.follow(event.Name, false); err != nil {
+					d.sendError(err)
+				}
+			case event.Op&(fsnotify.Remove|fsnotify.Rename) != 0:
+				d.unfollow(event.Name)
+			}
+		case err, ok := <-d.watcher.Errors:
+			if !ok {
+				return
+			}
+
+			d.sendError(err)
+		}
+	}
+}
+
+func (d *directoryFollower) OnError(cb func(error)) {
+	go func() {
+		for err := range d.errors {
+			cb(err)
+		}
+	}()
+}
+
+func (d *directoryFollower) Lines() chan string {
+	return d.line
+}
@@ -0,0 +1,112 @@
+package tail
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func appendToFile(t *testing.T, filename string, text string) {
+	f, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	require.Nil(t, err)
+	defer f.Close()
+
+	_, err = f.WriteString(text)
+	require.Nil(t, err)
+}
+
+func receiveLine(t *testing.T, lines chan string) string {
+	select {
+	case line := <-lines:
+		return line
+	case <-time.After(5 * time.Second):
+		t.Fatal("no line was read from the directory")
+		return ""
+	}
+}
+
+func TestDirectoryFollowerFollowsExistingAndCreatedFiles(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "nginxlog-exporter")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	existing := filepath.Join(dir, "a.log")
+	require.Nil(t, ioutil.WriteFile(existing, []byte("old\n"), 0644))
+
+	f, err := NewDirectoryFollower(dir, "*.log", DefaultOptions)
+	require.Nil(t, err)
+	defer f.(Stopper).Stop()
+
+	// existing files are followed from their end
+	appendToFile(t, existing, "appended\n")
+	assert.Equal(t, "appended", receiveLine(t, f.Lines()))
+
+	// created files are followed from their beginning, unless they do not
+	// match the pattern
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "c.txt"), []byte("ignored\n"), 0644))
+	created := filepath.Join(dir, "b.log")
+	appendToFile(t, created, "first\n")
+	assert.Equal(t, "first", receiveLine(t, f.Lines()))
+
+	appendToFile(t, created, "second\n")
+	assert.Equal(t, "second", receiveLine(t, f.Lines()))
+
+	select {
+	case line := <-f.Lines():
+		t.Fatalf("unexpected line '%s'", line)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	assert.Equal(t, 2, f.(FileCounter).FollowedFiles())
+}
+
+func TestDirectoryFollowerStopsFollowingRemovedAndRenamedFiles(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "nginxlog-exporter")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	removed := filepath.Join(dir, "a.log")
+	renamed := filepath.Join(dir, "b.log")
+	for _, filename := range []string{removed, renamed} {
+		require.Nil(t, ioutil.WriteFile(filename, nil, 0644))
+	}
+
+	f, err := NewDirectoryFollower(dir, "*.log", DefaultOptions)
+	require.Nil(t, err)
+	defer f.(Stopper).Stop()
+
+	d := f.(*directoryFollower)
+	d.mutex.Lock()
+	tails := []*trackedTail{d.tails[removed], d.tails[renamed]}
+	d.mutex.Unlock()
+
+	require.Nil(t, os.Remove(removed))
+	require.Nil(t, os.Rename(renamed, renamed+".1"))
+
+	for _, tt := range tails {
+		require.NotNil(t, tt)
+
+		select {
+		case <-tt.Dead():
+		case <-time.After(5 * time.Second):
+			t.Fatal("tail of a removed or renamed file was not stopped")
+		}
+	}
+
+	d.mutex.Lock()
+	assert.Len(t, d.tails, 0)
+	d.mutex.Unlock()
+
+	// files that are created again are followed again
+	appendToFile(t, removed, "again\n")
+	assert.Equal(t, "again", receiveLine(t, f.Lines()))
+}
@@ -0,0 +1,84 @@
+package tail
+
+import (
+	"os"
+
+	"github.com/hpcloud/tail"
+)
+
+// FileCounter is implemented by Followers that read from files, and reports
+// how many of these files are currently being followed
+type FileCounter interface {
+	FollowedFiles() int
+}
+
+// following tests if t still follows a file; this is not the case if the
+// file does not exist (yet), or if t was stopped (for example, because the
+// file could not be read or reopened)
+func following(filename string, t *tail.Tail) bool {
+	if t == nil {
+		return false
+	}
+
+	select {
+	case <-t.Dying():
+		return false
+	default:
+	}
+
+	_, err := os.Stat(filename)
+	return err == nil
+}
+
+func countFollowing(filename string, t *trackedTail) int {
+	if t != nil && following(filename, t.Tail) {
+		return 1
+	}
+
+	return 0
+}
+
+func (f *followerImpl) FollowedFiles() int {
+	return countFollowing(f.filename, f.t)
+}
+
+func (d *directoryFollower) FollowedFiles() int {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	n := 0
+	for filename, t := range d.tails {
+		n += countFollowing(filename, t)
+	}
+
+	return n
+}
+
+func (s *symlinkFollower) FollowedFiles() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return countFollowing(s.target, s.t)
+}
+
+// FollowedFiles also counts the file while it is not followed because it is
+// idle, as long as it exists
+func (f *idleFollower) FollowedFiles() int {
+	f.mutex.Lock()
+	t := f.t
+	stopped := f.stopped
+	f.mutex.Unlock()
+
+	switch {
+	case stopped:
+		return 0
+	case t != nil:
+		return countFollowing(f.filename, t)
+	}
+
+	if _, err := os.Stat(f.filename); err != nil {
+		return 0
+	}
+
+	return 1
+}
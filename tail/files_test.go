@@ -0,0 +1,57 @@
+package tail
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileFollowerCountsFollowedFiles(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "nginxlog-exporter")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "access.log")
+
+	f, err := NewFileFollowerAt(filename, EndOfFile, DefaultOptions)
+	require.Nil(t, err)
+
+	lines := f.Lines()
+	go func() {
+		for range lines {
+		}
+	}()
+
+	// files that do not exist yet are not counted
+	assert.Equal(t, 0, f.(FileCounter).FollowedFiles())
+
+	require.Nil(t, ioutil.WriteFile(filename, []byte("first\n"), 0644))
+	assert.Equal(t, 1, f.(FileCounter).FollowedFiles())
+
+	require.Nil(t, f.(Stopper).Stop())
+	assert.Equal(t, 0, f.(FileCounter).FollowedFiles())
+}
+
+func TestDirectoryFollowerCountsFollowedFiles(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "nginxlog-exporter")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"a.log", "b.log", "c.txt"} {
+		require.Nil(t, ioutil.WriteFile(filepath.Join(dir, name), []byte("first\n"), 0644))
+	}
+
+	f, err := NewDirectoryFollower(dir, "*.log", DefaultOptions)
+	require.Nil(t, err)
+	defer f.(Stopper).Stop()
+
+	assert.Equal(t, 2, f.(FileCounter).FollowedFiles())
+}
@@ -0,0 +1,244 @@
+package tail
+
+import (
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hpcloud/tail"
+)
+
+type idleFollower struct {
+	filename string
+	timeout  time.Duration
+	interval time.Duration
+	onIdle   func()
+	onResume func()
+	opts     Options
+
+	line   chan string
+	errors chan error
+
+	// done is closed when the follower is stopped
+	done     chan struct{}
+	stopOnce sync.Once
+
+	// lastLine is the time (in nanoseconds since the epoch) at which the
+	// last line was read; it is accessed atomically
+	lastLine int64
+
+	mutex   sync.Mutex
+	t       *trackedTail
+	stopped bool
+
+	// forwarded is closed once all lines read by t were consumed
+	forwarded chan struct{}
+
+	// offset and file describe where following the file was stopped while
+	// it is idle
+	offset int64
+	file   os.FileInfo
+}
+
+// NewIdleFollower creates a new Follower instance for a given file (given by
+// name), which stops following the file once no line was read from it for
+// the given timeout. This closes the file and frees all resources that are
+// needed to follow it. The file is then checked (using stat) every interval;
+// as soon as it grows, it is followed again from where it was left (or from
+// its beginning, if it was truncated or replaced). onIdle and onResume (both
+// optional) are called when the follower stops and resumes following.
+func NewIdleFollower(filename string, timeout time.Duration, interval time.Duration, onIdle func(), onResume func(), opts Options) (Follower, error) {
+	f := &idleFollower{
+		filename: filename,
+		timeout:  timeout,
+		interval: interval,
+		opts:     opts,
+		onIdle:   onIdle,
+		onResume: onResume,
+		line:     make(chan string),
+		errors:   make(chan error),
+		done:     make(chan struct{}),
+	}
+
+	var seekInfo *tail.SeekInfo
+	if _, err := os.Stat(filename); err == nil {
+		seekInfo = &tail.SeekInfo{Offset: 0, Whence: os.SEEK_END}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if err := f.follow(seekInfo); err != nil {
+		return nil, err
+	}
+
+	go f.watch()
+
+	return f, nil
+}
+
+func (f *idleFollower) follow(seekInfo *tail.SeekInfo) error {
+	t, err := tailFile(f.filename, tail.Config{
+		Follow:   true,
+		ReOpen:   f.opts.ReOpen,
+		Poll:     f.opts.Poll,
+		Location: seekInfo,
+	})
+	if err != nil {
+		return err
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.stopped {
+		return stopTail(t)
+	}
+
+	forwarded := make(chan struct{})
+	f.t = t
+	f.forwarded = forwarded
+	atomic.StoreInt64(&f.lastLine, time.Now().UnixNano())
+
+	go func() {
+		defer close(forwarded)
+
+		forwardLines(t, f.line, f.done, func() {
+			atomic.StoreInt64(&f.lastLine, time.Now().UnixNano())
+		})
+	}()
+
+	return nil
+}
+
+func (f *idleFollower) watch() {
+	ticker := time.NewTicker(f.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-f.done:
+			return
+		case <-ticker.C:
+		}
+
+		f.mutex.Lock()
+		t := f.t
+		f.mutex.Unlock()
+
+		if t != nil {
+			if time.Since(time.Unix(0, atomic.LoadInt64(&f.lastLine))) > f.timeout {
+				f.stop(t)
+			}
+			continue
+		}
+
+		f.resumeIfWritten()
+	}
+}
+
+// stop stops following the file, remembering the position after the last
+// line that was read
+func (f *idleFollower) stop(t *trackedTail) {
+	fi, err := os.Stat(f.filename)
+	if err != nil {
+		// the file is probably being rotated right now; try again later
+		return
+	}
+
+	f.mutex.Lock()
+
+	// the follower may have been stopped in the meantime
+	if f.t != t {
+		f.mutex.Unlock()
+		return
+	}
+
+	err = stopTail(t)
+	<-f.forwarded
+
+	f.t = nil
+	f.offset = t.Offset()
+	f.file = fi
+	f.mutex.Unlock()
+
+	if err != nil {
+		f.sendError(err)
+	}
+
+	if f.onIdle != nil {
+		f.onIdle()
+	}
+}
+
+// resumeIfWritten follows the file again if it was written to since it
+// became idle
+func (f *idleFollower) resumeIfWritten() {
+	fi, err := os.Stat(f.filename)
+	if err != nil {
+		return
+	}
+
+	f.mutex.Lock()
+	offset := f.offset
+	stopped := f.file
+	f.mutex.Unlock()
+
+	switch {
+	case !os.SameFile(fi, stopped) || fi.Size() < offset:
+		offset = 0
+	case fi.Size() == offset:
+		return
+	}
+
+	if err := f.follow(&tail.SeekInfo{Offset: offset, Whence: os.SEEK_SET}); err != nil {
+		f.sendError(err)
+		return
+	}
+
+	if f.onResume != nil {
+		f.onResume()
+	}
+}
+
+// sendError emits an error, unless the follower is stopped
+func (f *idleFollower) sendError(err error) {
+	select {
+	case f.errors <- err:
+	case <-f.done:
+	}
+}
+
+func (f *idleFollower) Positions() []Position {
+	f.mutex.Lock()
+	t := f.t
+	offset := f.offset
+	f.mutex.Unlock()
+
+	if t != nil {
+		if p, ok := tailPosition(f.filename, t); ok {
+			return []Position{p}
+		}
+
+		return nil
+	}
+
+	fi, err := os.Stat(f.filename)
+	if err != nil {
+		return nil
+	}
+
+	return []Position{{Filename: f.filename, Offset: offset, Size: fi.Size()}}
+}
+
+func (f *idleFollower) OnError(cb func(error)) {
+	go func() {
+		for err := range f.errors {
+			cb(err)
+		}
+	}()
+}
+
+func (f *idleFollower) Lines() chan string {
+	return f.line
+}
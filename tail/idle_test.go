@@ -0,0 +1,58 @@
+package tail
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdleFollowerStopsAndResumesFollowing(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "nginxlog-exporter")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "access.log")
+	require.Nil(t, ioutil.WriteFile(filename, []byte("old\n"), 0644))
+
+	idle := make(chan struct{}, 1)
+	resumed := make(chan struct{}, 1)
+
+	f, err := NewIdleFollower(filename, 100*time.Millisecond, 20*time.Millisecond,
+		func() { idle <- struct{}{} },
+		func() { resumed <- struct{}{} },
+		DefaultOptions,
+	)
+	require.Nil(t, err)
+
+	select {
+	case <-idle:
+	case <-time.After(5 * time.Second):
+		t.Fatal("follower did not become idle")
+	}
+
+	file, err := os.OpenFile(filename, os.O_APPEND|os.O_WRONLY, 0644)
+	require.Nil(t, err)
+	_, err = file.WriteString("new\n")
+	require.Nil(t, err)
+	require.Nil(t, file.Close())
+
+	select {
+	case <-resumed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("follower did not resume following")
+	}
+
+	select {
+	case line := <-f.Lines():
+		assert.Equal(t, "new", line)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no line was read after resuming")
+	}
+}
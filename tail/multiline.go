@@ -0,0 +1,81 @@
+package tail
+
+import (
+	"regexp"
+	"time"
+)
+
+type multilineFollower struct {
+	Follower
+
+	start      *regexp.Regexp
+	flushAfter time.Duration
+	line       chan string
+}
+
+// NewMultilineFollower wraps a Follower so that log entries spanning multiple
+// lines are joined into a single line. Each entry starts with a line
+// matching start; all following lines that do not match start are appended
+// (separated by a space) to that entry. Since the end of an entry is only
+// known when the next one starts, an entry is also emitted when no further
+// line was read within flushAfter.
+func NewMultilineFollower(f Follower, start *regexp.Regexp, flushAfter time.Duration) Follower {
+	return &multilineFollower{
+		Follower:   f,
+		start:      start,
+		flushAfter: flushAfter,
+		line:       make(chan string),
+	}
+}
+
+func (m *multilineFollower) Lines() chan string {
+	go m.join(m.Follower.Lines())
+	return m.line
+}
+
+func (m *multilineFollower) join(lines chan string) {
+	var pending string
+	var hasPending bool
+
+	timer := time.NewTimer(m.flushAfter)
+	timer.Stop()
+
+	flush := func() {
+		if hasPending {
+			m.line <- pending
+			pending, hasPending = "", false
+		}
+	}
+
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				flush()
+				close(m.line)
+				return
+			}
+
+			switch {
+			case m.start.MatchString(line):
+				flush()
+				pending, hasPending = line, true
+			case hasPending:
+				pending += " " + line
+			default:
+				m.line <- line
+				continue
+			}
+
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(m.flushAfter)
+		case <-timer.C:
+			flush()
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package tail
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type sliceFollower struct {
+	lines []string
+}
+
+func (s *sliceFollower) OnError(func(error)) {}
+
+func (s *sliceFollower) Lines() chan string {
+	c := make(chan string)
+	go func() {
+		for _, l := range s.lines {
+			c <- l
+		}
+		close(c)
+	}()
+	return c
+}
+
+func TestMultilineFollowerJoinsContinuationLines(t *testing.T) {
+	t.Parallel()
+
+	f := NewMultilineFollower(&sliceFollower{lines: []string{
+		"stray",
+		"10.0.0.1 - GET /foo",
+		"continued",
+		"10.0.0.2 - GET /bar",
+	}}, regexp.MustCompile(`^\d+\.\d+\.\d+\.\d+ `), time.Minute)
+
+	var result []string
+	for l := range f.Lines() {
+		result = append(result, l)
+	}
+
+	assert.Equal(t, []string{"stray", "10.0.0.1 - GET /foo continued", "10.0.0.2 - GET /bar"}, result)
+}
+
+func TestMultilineFollowerFlushesAfterTimeout(t *testing.T) {
+	t.Parallel()
+
+	lines := make(chan string)
+	f := NewMultilineFollower(&channelFollower{lines}, regexp.MustCompile(`^start`), 10*time.Millisecond)
+	out := f.Lines()
+
+	lines <- "start of entry"
+
+	select {
+	case l := <-out:
+		assert.Equal(t, "start of entry", l)
+	case <-time.After(time.Second):
+		t.Error("entry was not flushed")
+	}
+}
+
+type channelFollower struct {
+	lines chan string
+}
+
+func (c *channelFollower) OnError(func(error)) {}
+
+func (c *channelFollower) Lines() chan string {
+	return c.lines
+}
@@ -0,0 +1,140 @@
+package tail
+
+import (
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/hpcloud/tail"
+)
+
+// errReopened marks the point in the lines of a tail at which the file was
+// reopened (see reopenDetector)
+var errReopened = errors.New("file was reopened")
+
+// trackedTail follows a file like tail.Tail, and keeps track of the read
+// position in the file from the lines that were consumed. (*tail.Tail).Tell
+// cannot be used for this, since it races with the goroutine of the tail that
+// reads (and reopens) the file.
+type trackedTail struct {
+	*tail.Tail
+
+	// offset is the position after the last consumed line; it is accessed
+	// atomically
+	offset int64
+}
+
+// tailFile starts following a file like tail.TailFile. A location relative
+// to the end of the file is turned into an absolute one, so that the read
+// position is known from the beginning.
+func tailFile(filename string, cfg tail.Config) (*trackedTail, error) {
+	t := &trackedTail{}
+
+	if cfg.Location != nil {
+		switch cfg.Location.Whence {
+		case os.SEEK_SET:
+			t.offset = cfg.Location.Offset
+		case os.SEEK_END:
+			if fi, err := os.Stat(filename); err == nil {
+				t.offset = fi.Size() + cfg.Location.Offset
+				cfg.Location = &tail.SeekInfo{Offset: t.offset, Whence: os.SEEK_SET}
+			}
+		}
+	}
+
+	detector := &reopenDetector{}
+	cfg.Logger = log.New(detector, "", 0)
+
+	tt, err := tail.TailFile(filename, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	detector.setTail(tt)
+	t.Tail = tt
+
+	return t, nil
+}
+
+// consume returns the text of a line that was read from the tail, and
+// advances the read position past it. Lines that only mark that the file was
+// reopened reset the read position instead, and are not returned.
+func (t *trackedTail) consume(line *tail.Line) (string, bool) {
+	if line.Err == errReopened {
+		atomic.StoreInt64(&t.offset, 0)
+		return "", false
+	}
+
+	// the newline was stripped from the text; lines without one are only
+	// emitted at the end of files that are read once
+	atomic.AddInt64(&t.offset, int64(len(line.Text))+1)
+	return line.Text, true
+}
+
+// Offset returns the position after the last consumed line
+func (t *trackedTail) Offset() int64 {
+	return atomic.LoadInt64(&t.offset)
+}
+
+// forwardLines emits the text of the lines read by t on out, until t is
+// stopped. Once done is closed, the lines are no longer emitted, but are still
+// consumed so that t can be stopped. onLine (if not nil) is called whenever a
+// line was read.
+func forwardLines(t *trackedTail, out chan<- string, done <-chan struct{}, onLine func()) {
+	for n := range t.Lines {
+		text, ok := t.consume(n)
+		if !ok {
+			continue
+		}
+
+		if onLine != nil {
+			onLine()
+		}
+
+		select {
+		case out <- text:
+		case <-done:
+		}
+	}
+}
+
+// reopenDetector receives the log messages of a tail, and passes them on to
+// tailLogger. Whenever the tail reports that it reopened its file, a line
+// marking this (with errReopened) is emitted. Since the tail logs this on the
+// goroutine that also emits its lines, the marker is emitted exactly between
+// the last line of the old file and the first line of the new one.
+type reopenDetector struct {
+	mutex sync.Mutex
+	t     *tail.Tail
+}
+
+func (d *reopenDetector) setTail(t *tail.Tail) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.t = t
+}
+
+func (d *reopenDetector) Write(p []byte) (int, error) {
+	tailLogger.Writer().Write(p)
+
+	if !strings.HasPrefix(string(p), "Successfully reopened") {
+		return len(p), nil
+	}
+
+	d.mutex.Lock()
+	t := d.t
+	d.mutex.Unlock()
+
+	if t != nil {
+		select {
+		case t.Lines <- &tail.Line{Err: errReopened}:
+		case <-t.Dying():
+		}
+	}
+
+	return len(p), nil
+}
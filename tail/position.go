@@ -0,0 +1,72 @@
+package tail
+
+import (
+	"os"
+)
+
+// Position describes how far a file has been read
+type Position struct {
+	Filename string
+	Offset   int64
+	Size     int64
+}
+
+// PositionReporter is implemented by Followers that read from files, and
+// reports the read positions in all of these files
+type PositionReporter interface {
+	Positions() []Position
+}
+
+// tailPosition returns the position after the last line that was consumed
+// from t
+func tailPosition(filename string, t *trackedTail) (Position, bool) {
+	fi, err := os.Stat(filename)
+	if err != nil {
+		return Position{}, false
+	}
+
+	// the last line of a file that is read once may lack a newline, and
+	// truncated files are only reopened after a short delay
+	offset := t.Offset()
+	if offset > fi.Size() {
+		offset = fi.Size()
+	}
+
+	return Position{Filename: filename, Offset: offset, Size: fi.Size()}, true
+}
+
+func (f *followerImpl) Positions() []Position {
+	if p, ok := tailPosition(f.filename, f.t); ok {
+		return []Position{p}
+	}
+
+	return nil
+}
+
+func (d *directoryFollower) Positions() []Position {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	positions := make([]Position, 0, len(d.tails))
+	for filename, t := range d.tails {
+		if p, ok := tailPosition(filename, t); ok {
+			positions = append(positions, p)
+		}
+	}
+
+	return positions
+}
+
+func (s *symlinkFollower) Positions() []Position {
+	s.mutex.Lock()
+	t := s.t
+	target := s.target
+	s.mutex.Unlock()
+
+	if p, ok := tailPosition(target, t); ok {
+		p.Filename = s.link
+		return []Position{p}
+	}
+
+	return nil
+}
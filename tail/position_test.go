@@ -0,0 +1,102 @@
+package tail
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileFollowerReportsPosition(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "nginxlog-exporter")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "access.log")
+	require.Nil(t, ioutil.WriteFile(filename, []byte("first\nsecond\n"), 0644))
+
+	f, err := NewFileFollowerAt(filename, 0, DefaultOptions)
+	require.Nil(t, err)
+	defer f.(Stopper).Stop()
+
+	for _, expected := range []string{"first", "second"} {
+		select {
+		case line := <-f.Lines():
+			assert.Equal(t, expected, line)
+		case <-time.After(5 * time.Second):
+			t.Fatal("no line was read")
+		}
+	}
+
+	positions := f.(PositionReporter).Positions()
+	require.Len(t, positions, 1)
+	assert.Equal(t, filename, positions[0].Filename)
+	assert.Equal(t, int64(13), positions[0].Size)
+	assert.Equal(t, int64(13), positions[0].Offset)
+}
+
+func TestFileFollowerStartsAtOffset(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "nginxlog-exporter")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "access.log")
+	require.Nil(t, ioutil.WriteFile(filename, []byte("first\nsecond\n"), 0644))
+
+	// offsets beyond the end of the file start over from its beginning
+	for offset, expected := range map[int64]string{0: "first", 6: "second", 100: "first"} {
+		f, err := NewFileFollowerAt(filename, offset, DefaultOptions)
+		require.Nil(t, err)
+
+		select {
+		case line := <-f.Lines():
+			assert.Equal(t, expected, line)
+		case <-time.After(5 * time.Second):
+			t.Fatal("no line was read")
+		}
+
+		require.Nil(t, f.(Stopper).Stop())
+	}
+}
+
+func TestFileFollowerPositionStartsOverWhenFileIsReplaced(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "nginxlog-exporter")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "access.log")
+	require.Nil(t, ioutil.WriteFile(filename, []byte("first\n"), 0644))
+
+	f, err := NewFileFollowerAt(filename, 0, DefaultOptions)
+	require.Nil(t, err)
+	defer f.(Stopper).Stop()
+
+	read := func(expected string) {
+		select {
+		case line := <-f.Lines():
+			assert.Equal(t, expected, line)
+		case <-time.After(5 * time.Second):
+			t.Fatal("no line was read")
+		}
+	}
+
+	read("first")
+
+	require.Nil(t, os.Rename(filename, filename+".1"))
+	require.Nil(t, ioutil.WriteFile(filename, []byte("x\n"), 0644))
+	read("x")
+
+	positions := f.(PositionReporter).Positions()
+	require.Len(t, positions, 1)
+	assert.Equal(t, int64(2), positions[0].Offset)
+}
@@ -0,0 +1,71 @@
+package tail
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"sync"
+)
+
+type readerFollower struct {
+	r      io.Reader
+	closer io.Closer
+	line   chan string
+	errors chan error
+
+	readOnce sync.Once
+}
+
+// NewReaderFollower creates a new Follower instance that emits the lines read
+// from r (like the standard input). Once the end of r is reached, the
+// channel returned by Lines is closed.
+func NewReaderFollower(r io.Reader) Follower {
+	return &readerFollower{
+		r:      r,
+		line:   make(chan string),
+		errors: make(chan error, 1),
+	}
+}
+
+func (f *readerFollower) OnError(cb func(error)) {
+	go func() {
+		for err := range f.errors {
+			cb(err)
+		}
+	}()
+}
+
+func (f *readerFollower) Lines() chan string {
+	f.readOnce.Do(func() {
+		go f.read()
+	})
+
+	return f.line
+}
+
+// read emits all lines of the reader; unlike with a bufio.Scanner, the lines
+// may be of any length
+func (f *readerFollower) read() {
+	reader := bufio.NewReader(f.r)
+
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			f.line <- strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+		}
+
+		if err != nil {
+			if err != io.EOF {
+				f.errors <- err
+			}
+			break
+		}
+	}
+
+	if f.closer != nil {
+		f.closer.Close()
+	}
+
+	close(f.line)
+	close(f.errors)
+}
@@ -0,0 +1,47 @@
+package tail
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReaderFollowerEmitsLinesUntilEOF(t *testing.T) {
+	t.Parallel()
+
+	f := NewReaderFollower(strings.NewReader("first\nsecond\n"))
+
+	var lines []string
+	for line := range f.Lines() {
+		lines = append(lines, line)
+	}
+
+	assert.Equal(t, []string{"first", "second"}, lines)
+}
+
+func TestReaderFollowerEmitsLongLines(t *testing.T) {
+	t.Parallel()
+
+	long := strings.Repeat("x", 1<<20)
+	f := NewReaderFollower(strings.NewReader(long + "\r\nlast"))
+
+	var lines []string
+	for line := range f.Lines() {
+		lines = append(lines, line)
+	}
+
+	assert.Equal(t, []string{long, "last"}, lines)
+}
+
+func TestReaderFollowerReadsOnlyOnce(t *testing.T) {
+	t.Parallel()
+
+	f := NewReaderFollower(strings.NewReader("first\nsecond\n"))
+
+	assert.Equal(t, "first", <-f.Lines())
+	assert.Equal(t, "second", <-f.Lines())
+
+	_, ok := <-f.Lines()
+	assert.False(t, ok)
+}
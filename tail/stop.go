@@ -0,0 +1,84 @@
+package tail
+
+// Stopper is implemented by Followers that can stop following their sources;
+// this closes all files and frees all resources that are needed to follow
+// them. No further lines are emitted after Stop has returned.
+type Stopper interface {
+	Stop() error
+}
+
+func stopTail(t *trackedTail) error {
+	err := t.Stop()
+	t.Cleanup()
+
+	return err
+}
+
+func (f *followerImpl) Stop() error {
+	return stopTail(f.t)
+}
+
+func (d *directoryFollower) Stop() error {
+	// lines that are still being forwarded are dropped
+	d.stopOnce.Do(func() { close(d.done) })
+
+	// closing the watcher also ends the watch goroutine
+	err := d.watcher.Close()
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	for filename, t := range d.tails {
+		if stopErr := stopTail(t); stopErr != nil && err == nil {
+			err = stopErr
+		}
+
+		delete(d.tails, filename)
+	}
+
+	return err
+}
+
+func (s *symlinkFollower) Stop() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.stopped = true
+	err := stopTail(s.t)
+
+	for t := range s.draining {
+		if stopErr := stopTail(t); stopErr != nil && err == nil {
+			err = stopErr
+		}
+
+		delete(s.draining, t)
+	}
+
+	return err
+}
+
+func (f *idleFollower) Stop() error {
+	// lines that are still being forwarded are dropped
+	f.stopOnce.Do(func() { close(f.done) })
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.stopped = true
+	if f.t == nil {
+		return nil
+	}
+
+	err := stopTail(f.t)
+	f.t = nil
+
+	return err
+}
+
+func (m *multilineFollower) Stop() error {
+	if s, ok := m.Follower.(Stopper); ok {
+		return s.Stop()
+	}
+
+	return nil
+}
@@ -0,0 +1,66 @@
+package tail
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFollowersCanBeStopped(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "nginxlog-exporter")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "access.log")
+	require.Nil(t, ioutil.WriteFile(filename, []byte("first\n"), 0644))
+
+	file, err := NewFileFollower(filename)
+	require.Nil(t, err)
+
+	directory, err := NewDirectoryFollower(dir, "*.log", DefaultOptions)
+	require.Nil(t, err)
+
+	wrapped, err := NewFileFollower(filename)
+	require.Nil(t, err)
+
+	for _, f := range []Follower{file, directory, NewMultilineFollower(wrapped, nil, 0)} {
+		s, ok := f.(Stopper)
+		require.True(t, ok)
+		assert.Nil(t, s.Stop())
+	}
+}
+
+func TestDirectoryFollowerCanBeStoppedWhileLinesArePending(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "nginxlog-exporter")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	f, err := NewDirectoryFollower(dir, "*.log", DefaultOptions)
+	require.Nil(t, err)
+
+	// created files are read from their beginning, but the lines are never
+	// consumed
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "access.log"), []byte("first\nsecond\nthird\n"), 0644))
+	time.Sleep(200 * time.Millisecond)
+
+	stopped := make(chan error)
+	go func() {
+		stopped <- f.(Stopper).Stop()
+	}()
+
+	select {
+	case err := <-stopped:
+		assert.Nil(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("directory follower could not be stopped")
+	}
+}
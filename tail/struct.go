@@ -1,5 +1,40 @@
 package tail
 
+import (
+	"time"
+
+	"github.com/hpcloud/tail/watch"
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/logging"
+)
+
+// Options describes how files are followed
+type Options struct {
+	// Poll makes files be polled for changes, instead of being watched
+	// using inotify (or the equivalent mechanism of the platform)
+	Poll bool
+
+	// ReOpen makes files be opened again when they are recreated (for
+	// example, by a log rotation). Files in watched directories and targets
+	// of symbolic links are never reopened, since they are handled on their
+	// own.
+	ReOpen bool
+}
+
+// DefaultOptions are the options that files are followed with unless
+// configured otherwise
+var DefaultOptions = Options{Poll: true, ReOpen: true}
+
+// tailLogger logs the messages of the followed files (like files that are
+// reopened) along with the exporter's own messages
+var tailLogger = logging.StdLogger(logging.LevelInfo)
+
+// SetPollInterval sets the interval in which files are polled for changes
+// (see Options.Poll). It applies to all followed files, and must be called
+// before any file is followed.
+func SetPollInterval(interval time.Duration) {
+	watch.POLL_DURATION = interval
+}
+
 // Follower describes an object that continuously emits a stream of lines
 type Follower interface {
 	Lines() chan string
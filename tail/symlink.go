@@ -0,0 +1,194 @@
+package tail
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/hpcloud/tail"
+)
+
+// symlinkCheckInterval is the interval in which the target of a followed
+// symbolic link is checked for changes
+const symlinkCheckInterval = time.Second
+
+// symlinkDrainPeriod is the time for which the previous target of a repointed
+// link is still followed, unless all of it was read before; this keeps lines
+// that are written to it shortly after the link was repointed.
+// symlinkDrainCheckInterval is the interval in which it is checked for that.
+const (
+	symlinkDrainPeriod        = 5 * time.Second
+	symlinkDrainCheckInterval = 100 * time.Millisecond
+)
+
+type symlinkFollower struct {
+	link      string
+	pin       bool
+	onRepoint func(target string)
+	opts      Options
+
+	line   chan string
+	errors chan error
+
+	mutex   sync.Mutex
+	target  string
+	t       *trackedTail
+	stopped bool
+
+	// draining contains the tails of previous targets that are still being
+	// read (see drain)
+	draining map[*trackedTail]struct{}
+}
+
+// NewSymlinkFollower creates a new Follower instance for a file that is a
+// symbolic link. Instead of the link, its target is followed (starting at its
+// end). Unless pin is set, the link is checked periodically; when it is
+// repointed (for example, by a log rotation), the new target is followed
+// from its beginning and onRepoint is called; the previous target is still
+// read for a while (see symlinkDrainPeriod). With pin set, the original
+// target is followed even after the link was repointed. Of opts, only Poll
+// applies.
+func NewSymlinkFollower(link string, pin bool, onRepoint func(target string), opts Options) (Follower, error) {
+	target, err := filepath.EvalSymlinks(link)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &symlinkFollower{
+		link:      link,
+		pin:       pin,
+		onRepoint: onRepoint,
+		opts:      opts,
+		line:      make(chan string),
+		errors:    make(chan error),
+		draining:  make(map[*trackedTail]struct{}),
+	}
+
+	if err := s.follow(target, true); err != nil {
+		return nil, err
+	}
+
+	if !pin {
+		go s.watch()
+	}
+
+	return s, nil
+}
+
+// IsSymlink tests if a file is a symbolic link
+func IsSymlink(filename string) bool {
+	fi, err := os.Lstat(filename)
+	return err == nil && fi.Mode()&os.ModeSymlink != 0
+}
+
+func (s *symlinkFollower) follow(target string, fromEnd bool) error {
+	var seekInfo *tail.SeekInfo
+	if fromEnd {
+		seekInfo = &tail.SeekInfo{Offset: 0, Whence: os.SEEK_END}
+	}
+
+	t, err := tailFile(target, tail.Config{
+		Follow:   true,
+		ReOpen:   false,
+		Poll:     s.opts.Poll,
+		Location: seekInfo,
+	})
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	previous, previousTarget := s.t, s.target
+	s.target = target
+	s.t = t
+	if previous != nil {
+		s.draining[previous] = struct{}{}
+	}
+	s.mutex.Unlock()
+
+	if previous != nil {
+		go s.drain(previous, previousTarget)
+	}
+
+	go forwardLines(t, s.line, nil, nil)
+
+	return nil
+}
+
+// drain stops following the previous target of the link once all of it was
+// read, or symlinkDrainPeriod has passed
+func (s *symlinkFollower) drain(t *trackedTail, target string) {
+	ticker := time.NewTicker(symlinkDrainCheckInterval)
+	defer ticker.Stop()
+
+	deadline := time.Now().Add(symlinkDrainPeriod)
+
+	for range ticker.C {
+		fi, err := os.Stat(target)
+		if err != nil || fi.Size() <= t.Offset() || time.Now().After(deadline) {
+			break
+		}
+	}
+
+	s.mutex.Lock()
+	_, ok := s.draining[t]
+	delete(s.draining, t)
+	s.mutex.Unlock()
+
+	// Stop already stopped it
+	if !ok {
+		return
+	}
+
+	if err := stopTail(t); err != nil {
+		s.errors <- err
+	}
+}
+
+func (s *symlinkFollower) watch() {
+	ticker := time.NewTicker(symlinkCheckInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		target, err := filepath.EvalSymlinks(s.link)
+		if err != nil {
+			// the link is probably being replaced right now; try again later
+			continue
+		}
+
+		s.mutex.Lock()
+		changed := target != s.target
+		stopped := s.stopped
+		s.mutex.Unlock()
+
+		if stopped {
+			return
+		}
+
+		if !changed {
+			continue
+		}
+
+		if err := s.follow(target, false); err != nil {
+			s.errors <- err
+			continue
+		}
+
+		if s.onRepoint != nil {
+			s.onRepoint(target)
+		}
+	}
+}
+
+func (s *symlinkFollower) OnError(cb func(error)) {
+	go func() {
+		for err := range s.errors {
+			cb(err)
+		}
+	}()
+}
+
+func (s *symlinkFollower) Lines() chan string {
+	return s.line
+}
@@ -0,0 +1,85 @@
+package tail
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSymlinkFollowerFollowsRepointedLink(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "nginxlog-exporter")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	first := filepath.Join(dir, "access.log-1")
+	second := filepath.Join(dir, "access.log-2")
+	link := filepath.Join(dir, "access.log")
+
+	require.Nil(t, ioutil.WriteFile(first, []byte("old\n"), 0644))
+	require.Nil(t, ioutil.WriteFile(second, []byte("new\n"), 0644))
+	require.Nil(t, os.Symlink(first, link))
+	assert.True(t, IsSymlink(link))
+	assert.False(t, IsSymlink(first))
+
+	repointed := make(chan string, 1)
+	f, err := NewSymlinkFollower(link, false, func(target string) { repointed <- target }, DefaultOptions)
+	require.Nil(t, err)
+
+	require.Nil(t, os.Remove(link))
+	require.Nil(t, os.Symlink(second, link))
+
+	select {
+	case line := <-f.Lines():
+		assert.Equal(t, "new", line)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no line was read from the new link target")
+	}
+
+	assert.Equal(t, second, <-repointed)
+}
+
+func TestSymlinkFollowerReadsPreviousTargetAfterRepoint(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "nginxlog-exporter")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	first := filepath.Join(dir, "access.log-1")
+	second := filepath.Join(dir, "access.log-2")
+	link := filepath.Join(dir, "access.log")
+
+	require.Nil(t, ioutil.WriteFile(first, nil, 0644))
+	require.Nil(t, ioutil.WriteFile(second, nil, 0644))
+	require.Nil(t, os.Symlink(first, link))
+
+	repointed := make(chan string, 1)
+	f, err := NewSymlinkFollower(link, false, func(target string) { repointed <- target }, DefaultOptions)
+	require.Nil(t, err)
+	defer f.(Stopper).Stop()
+
+	require.Nil(t, os.Remove(link))
+	require.Nil(t, os.Symlink(second, link))
+	assert.Equal(t, second, <-repointed)
+
+	// NGINX may still write to the previous target until it reopens its logs
+	file, err := os.OpenFile(first, os.O_APPEND|os.O_WRONLY, 0644)
+	require.Nil(t, err)
+	_, err = file.WriteString("late\n")
+	require.Nil(t, err)
+	require.Nil(t, file.Close())
+
+	select {
+	case line := <-f.Lines():
+		assert.Equal(t, "late", line)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no line was read from the previous link target")
+	}
+}
@@ -1,21 +1,66 @@
 package tail
 
 import (
+	"compress/gzip"
+	"fmt"
 	"os"
+	"strings"
+	"sync"
 
 	"github.com/hpcloud/tail"
 )
 
+// EndOfFile is the offset (see NewFileFollowerAt) at which only lines that
+// are appended to a file are read
+const EndOfFile int64 = -1
+
 type followerImpl struct {
 	filename string
-	t        *tail.Tail
+	offset   int64
+	once     bool
+	opts     Options
+	t        *trackedTail
 	line     chan string
+
+	forwardOnce sync.Once
 }
 
 // NewFollower creates a new Follower instance for a given file (given by name)
 func NewFileFollower(filename string) (Follower, error) {
+	return NewFileFollowerAt(filename, EndOfFile, DefaultOptions)
+}
+
+// NewFileFollowerAt creates a new Follower instance for a given file (given by
+// name) that starts reading the file at the given offset, if the file exists.
+// If the file is smaller than offset (because it was truncated or replaced in
+// the meantime), it is read from its beginning.
+func NewFileFollowerAt(filename string, offset int64, opts Options) (Follower, error) {
+	f := &followerImpl{
+		filename: filename,
+		offset:   offset,
+		opts:     opts,
+		line:     make(chan string),
+	}
+
+	if err := f.start(); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// NewFileReader creates a new Follower instance that reads a given file
+// (given by name) once from its beginning to its end; the channel returned by
+// Lines is closed afterwards. The file must exist. Files whose names end with
+// ".gz" are decompressed while they are read.
+func NewFileReader(filename string) (Follower, error) {
+	if strings.HasSuffix(filename, ".gz") {
+		return newGzipFileReader(filename)
+	}
+
 	f := &followerImpl{
 		filename: filename,
+		once:     true,
 		line:     make(chan string),
 	}
 
@@ -26,22 +71,54 @@ func NewFileFollower(filename string) (Follower, error) {
 	return f, nil
 }
 
+func newGzipFileReader(filename string) (Follower, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := gzip.NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("could not decompress %s: %s", filename, err.Error())
+	}
+
+	return &readerFollower{
+		r:      r,
+		closer: file,
+		line:   make(chan string),
+		errors: make(chan error, 1),
+	}, nil
+}
+
 func (f *followerImpl) start() error {
+	if f.once {
+		t, err := tailFile(f.filename, tail.Config{MustExist: true})
+		if err != nil {
+			return err
+		}
+
+		f.t = t
+		return nil
+	}
+
 	var seekInfo *tail.SeekInfo
 
-	_, err := os.Stat(f.filename)
+	fi, err := os.Stat(f.filename)
 	if err != nil {
 		if !os.IsNotExist(err) {
 			return err
 		}
-	} else {
+	} else if f.offset == EndOfFile {
 		seekInfo = &tail.SeekInfo{Offset: 0, Whence: os.SEEK_END}
+	} else if f.offset <= fi.Size() {
+		seekInfo = &tail.SeekInfo{Offset: f.offset, Whence: os.SEEK_SET}
 	}
 
-	t, err := tail.TailFile(f.filename, tail.Config{
+	t, err := tailFile(f.filename, tail.Config{
 		Follow:   true,
-		ReOpen:   true,
-		Poll:     true,
+		ReOpen:   f.opts.ReOpen,
+		Poll:     f.opts.Poll,
 		Location: seekInfo,
 	})
 
@@ -63,10 +140,15 @@ func (f *followerImpl) OnError(cb func(error)) {
 }
 
 func (f *followerImpl) Lines() chan string {
-	go func() {
-		for n := range f.t.Lines {
-			f.line <- n.Text
-		}
-	}()
+	f.forwardOnce.Do(func() {
+		go func() {
+			forwardLines(f.t, f.line, nil, nil)
+
+			if f.once {
+				close(f.line)
+			}
+		}()
+	})
+
 	return f.line
 }
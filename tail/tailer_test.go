@@ -0,0 +1,139 @@
+package tail
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileReaderEmitsLinesUntilEOF(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "nginxlog-exporter")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "access.log")
+	require.Nil(t, ioutil.WriteFile(filename, []byte("first\nsecond\n"), 0644))
+
+	f, err := NewFileReader(filename)
+	require.Nil(t, err)
+
+	var linesRead []string
+	timeout := time.After(5 * time.Second)
+
+	for lines := f.Lines(); lines != nil; {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				lines = nil
+				continue
+			}
+
+			linesRead = append(linesRead, line)
+		case <-timeout:
+			t.Fatal("the lines channel was not closed")
+		}
+	}
+
+	assert.Equal(t, []string{"first", "second"}, linesRead)
+}
+
+func TestFileReaderRequiresExistingFile(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "nginxlog-exporter")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	_, err = NewFileReader(filepath.Join(dir, "access.log"))
+	assert.NotNil(t, err)
+}
+
+func TestFileReaderDecompressesGzipFiles(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "nginxlog-exporter")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	_, err = w.Write([]byte("first\nsecond\n"))
+	require.Nil(t, err)
+	require.Nil(t, w.Close())
+
+	filename := filepath.Join(dir, "access.log.1.gz")
+	require.Nil(t, ioutil.WriteFile(filename, buf.Bytes(), 0644))
+
+	f, err := NewFileReader(filename)
+	require.Nil(t, err)
+
+	var lines []string
+	for line := range f.Lines() {
+		lines = append(lines, line)
+	}
+
+	assert.Equal(t, []string{"first", "second"}, lines)
+}
+
+func TestFileReaderRejectsInvalidGzipFiles(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "nginxlog-exporter")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "access.log.1.gz")
+	require.Nil(t, ioutil.WriteFile(filename, []byte("first\n"), 0644))
+
+	_, err = NewFileReader(filename)
+	assert.NotNil(t, err)
+}
+
+func TestFileFollowerWithoutPolling(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "nginxlog-exporter")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "access.log")
+	require.Nil(t, ioutil.WriteFile(filename, []byte("old\n"), 0644))
+
+	f, err := NewFileFollowerAt(filename, EndOfFile, Options{Poll: false, ReOpen: false})
+	require.Nil(t, err)
+	defer f.(Stopper).Stop()
+
+	lines := f.Lines()
+
+	file, err := os.OpenFile(filename, os.O_APPEND|os.O_WRONLY, 0644)
+	require.Nil(t, err)
+	defer file.Close()
+
+	// the follower seeks to the end of the file asynchronously, so lines that
+	// are appended before are skipped; keep appending until one is read
+	timeout := time.After(5 * time.Second)
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			_, err = file.WriteString("new\n")
+			require.Nil(t, err)
+		case line := <-lines:
+			assert.Equal(t, "new", line)
+			return
+		case <-timeout:
+			t.Fatal("no line was read")
+		}
+	}
+}
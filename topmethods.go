@@ -0,0 +1,152 @@
+/*
+ * Copyright 2019 Martin Helmich <martin@helmich.me>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/config"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// topMethodsTracked is the maximum number of distinct request methods that a
+// topMethodsCollector counts separately; requests with further methods are
+// only counted as "other"
+const topMethodsTracked = 1000
+
+// topMethodsCollector counts requests by request method, but only exports the
+// methods with the k highest counts; all other requests are lumped together
+// into the "other" method. This keeps the cardinality of the metric bounded
+// even if clients send arbitrary methods. The exported methods are chosen
+// whenever the metric is collected, among the most frequent methods so far,
+// until k methods are exported; they are exported from then on. To keep all
+// values monotonic, a method only counts the requests since it was chosen,
+// and the ones before remain counted as "other".
+type topMethodsCollector struct {
+	desc *prometheus.Desc
+	k    int
+
+	mutex     sync.Mutex
+	counts    map[string]float64
+	untracked float64
+
+	// exported contains the count of each exported method at the time it
+	// was chosen
+	exported map[string]float64
+}
+
+type methodCount struct {
+	method string
+	count  float64
+}
+
+func newTopMethodsCollector(cfg *config.NamespaceConfig) *topMethodsCollector {
+	return &topMethodsCollector{
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.NamespacePrefix, "", cfg.MetricName("http_requests_by_top_method_total")),
+			"Amount of processed HTTP requests, by request method (for the most frequent methods only)",
+			[]string{"method"},
+			cfg.NamespaceLabels,
+		),
+		k:        cfg.TopMethods,
+		counts:   make(map[string]float64),
+		exported: make(map[string]float64),
+	}
+}
+
+// observe counts requests with the given method
+func (c *topMethodsCollector) observe(method string, n float64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if _, ok := c.counts[method]; !ok && len(c.counts) >= topMethodsTracked {
+		c.untracked += n
+		return
+	}
+
+	c.counts[method] += n
+}
+
+// top chooses further methods to export if less than k methods are exported
+// yet, and returns the counts of the exported methods (ordered by method),
+// and the total count of all other requests
+func (c *topMethodsCollector) top() ([]methodCount, float64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if len(c.exported) < c.k {
+		candidates := make([]methodCount, 0, len(c.counts))
+		for method, count := range c.counts {
+			if _, ok := c.exported[method]; !ok {
+				candidates = append(candidates, methodCount{method, count})
+			}
+		}
+
+		sort.Slice(candidates, func(i, j int) bool {
+			if candidates[i].count != candidates[j].count {
+				return candidates[i].count > candidates[j].count
+			}
+
+			return candidates[i].method < candidates[j].method
+		})
+
+		for _, mc := range candidates {
+			if len(c.exported) >= c.k {
+				break
+			}
+
+			c.exported[mc.method] = mc.count
+		}
+	}
+
+	top := make([]methodCount, 0, len(c.exported))
+	other := c.untracked
+
+	for method, count := range c.counts {
+		chosenAt, ok := c.exported[method]
+		if !ok {
+			other += count
+			continue
+		}
+
+		top = append(top, methodCount{method, count - chosenAt})
+		other += chosenAt
+	}
+
+	sort.Slice(top, func(i, j int) bool {
+		return top[i].method < top[j].method
+	})
+
+	return top, other
+}
+
+func (c *topMethodsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *topMethodsCollector) Collect(ch chan<- prometheus.Metric) {
+	top, other := c.top()
+
+	for _, mc := range top {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.CounterValue, mc.count, mc.method)
+	}
+
+	if other > 0 {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.CounterValue, other, "other")
+	}
+}
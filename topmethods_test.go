@@ -0,0 +1,57 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTopMethodsLumpsRarelyUsedMethodsIntoOther(t *testing.T) {
+	t.Parallel()
+
+	c := newTopMethodsCollector(&config.NamespaceConfig{Name: "test", TopMethods: 2})
+
+	c.observe("GET", 10)
+	c.observe("POST", 5)
+	c.observe("PUT", 2)
+	c.observe("FOO", 1)
+
+	top, other := c.top()
+	assert.Equal(t, []methodCount{{"GET", 0}, {"POST", 0}}, top)
+	assert.Equal(t, 18.0, other)
+
+	c.observe("GET", 3)
+	c.observe("POST", 1)
+	c.observe("FOO", 1)
+
+	top, other = c.top()
+	assert.Equal(t, []methodCount{{"GET", 3}, {"POST", 1}}, top)
+	assert.Equal(t, 19.0, other)
+}
+
+func TestTopMethodsKeepsExportedMethodsSoThatValuesNeverDecrease(t *testing.T) {
+	t.Parallel()
+
+	c := newTopMethodsCollector(&config.NamespaceConfig{Name: "test", TopMethods: 2})
+
+	c.observe("GET", 10)
+
+	top, other := c.top()
+	assert.Equal(t, []methodCount{{"GET", 0}}, top)
+	assert.Equal(t, 10.0, other)
+
+	c.observe("PUT", 2)
+	c.observe("POST", 5)
+
+	top, other = c.top()
+	assert.Equal(t, []methodCount{{"GET", 0}, {"POST", 0}}, top)
+	assert.Equal(t, 17.0, other)
+
+	// PUT becomes more frequent than POST, but POST stays exported
+	c.observe("PUT", 10)
+
+	top, other = c.top()
+	assert.Equal(t, []methodCount{{"GET", 0}, {"POST", 0}}, top)
+	assert.Equal(t, 27.0, other)
+}
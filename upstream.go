@@ -0,0 +1,148 @@
+/*
+ * Copyright 2019 Martin Helmich <martin@helmich.me>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"strconv"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/config"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/satyrius/gonx"
+)
+
+// upstreamLatencyMetrics observes the response time of each individual
+// upstream server that was contacted for a request
+type upstreamLatencyMetrics struct {
+	cfg     *config.UpstreamLatencyConfig
+	seconds *prometheus.HistogramVec
+}
+
+func newUpstreamLatencyMetrics(cfg *config.NamespaceConfig) *upstreamLatencyMetrics {
+	return &upstreamLatencyMetrics{
+		cfg: cfg.UpstreamLatency,
+		seconds: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   cfg.NamespacePrefix,
+			ConstLabels: cfg.NamespaceLabels,
+			Name:        cfg.MetricName("http_upstream_address_time_seconds"),
+			Help:        "Time needed by individual upstream servers to handle requests",
+			Buckets:     cfg.HistogramBuckets,
+		}, []string{"upstream"}),
+	}
+}
+
+// observe pairs each address from $upstream_addr with the response time at
+// the same position in $upstream_response_time. If both lists have different
+// lengths, only the pairs up to the length of the shorter list are observed.
+// Each pair is observed n times (see lineProcessor.observations).
+func (u *upstreamLatencyMetrics) observe(fields gonx.Fields, n int) {
+	addrs := splitUpstreamValues(fields["upstream_addr"], true)
+	times := splitUpstreamValues(fields["upstream_response_time"], false)
+
+	for i := 0; i < len(addrs) && i < len(times); i++ {
+		if addrs[i] == "-" {
+			continue
+		}
+
+		seconds, err := strconv.ParseFloat(times[i], 64)
+		if err != nil {
+			continue
+		}
+
+		observeWeighted(u.seconds.WithLabelValues(u.cfg.UpstreamLabel(addrs[i])), seconds, n)
+	}
+}
+
+// newUpstreamStatusLatency creates the histogram that the response times of
+// individual upstream servers are observed into, by the class of the status
+// code that they responded with
+func newUpstreamStatusLatency(cfg *config.NamespaceConfig) *prometheus.HistogramVec {
+	return prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace:   cfg.NamespacePrefix,
+		ConstLabels: cfg.NamespaceLabels,
+		Name:        cfg.MetricName("http_upstream_status_time_seconds"),
+		Help:        "Time needed by upstream servers to handle requests, by the class of their status code",
+		Buckets:     cfg.HistogramBuckets,
+	}, []string{"upstream_status"})
+}
+
+// observeUpstreamStatusLatency pairs each status code from $upstream_status
+// with the response time at the same position in $upstream_response_time,
+// like upstreamLatencyMetrics.observe does for addresses. Pairs without a
+// valid status code or response time (like for upstreams that could not be
+// connected to) are not observed.
+func observeUpstreamStatusLatency(h *prometheus.HistogramVec, fields gonx.Fields, n int) {
+	statuses := splitUpstreamValues(fields["upstream_status"], false)
+	times := splitUpstreamValues(fields["upstream_response_time"], false)
+
+	for i := 0; i < len(statuses) && i < len(times); i++ {
+		class := statusClass(statuses[i])
+		if class == "" {
+			continue
+		}
+
+		seconds, err := strconv.ParseFloat(times[i], 64)
+		if err != nil {
+			continue
+		}
+
+		observeWeighted(h.WithLabelValues(class), seconds, n)
+	}
+}
+
+// upstreamPhaseMetrics observes the time that upstream servers needed for a
+// phase of handling a request (like establishing the connection), as read
+// from the corresponding $upstream_<phase>_time variable
+type upstreamPhaseMetrics struct {
+	field   string
+	seconds *prometheus.SummaryVec
+	hist    *prometheus.HistogramVec
+}
+
+func newUpstreamPhaseMetrics(cfg *config.NamespaceConfig, labels []string, phase string, help string) *upstreamPhaseMetrics {
+	return &upstreamPhaseMetrics{
+		field: "upstream_" + phase + "_time",
+		seconds: prometheus.NewSummaryVec(prometheus.SummaryOpts{
+			Namespace:   cfg.NamespacePrefix,
+			ConstLabels: cfg.NamespaceLabels,
+			Name:        cfg.MetricName("http_upstream_" + phase + "_time_seconds"),
+			Help:        help,
+			Objectives:  cfg.CompiledSummaryObjectives,
+			MaxAge:      cfg.SummaryMaxAgeDuration,
+			AgeBuckets:  cfg.SummaryAgeBuckets,
+		}, labels),
+		hist: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   cfg.NamespacePrefix,
+			ConstLabels: cfg.NamespaceLabels,
+			Name:        cfg.MetricName("http_upstream_" + phase + "_time_seconds_hist"),
+			Help:        help,
+			Buckets:     cfg.HistogramBuckets,
+		}, labels),
+	}
+}
+
+// observe observes the time of the phase, with the times of multiple
+// upstreams combined like the upstream response times (according to mode).
+// Lines without this phase's field are ignored.
+func (u *upstreamPhaseMetrics) observe(fields gonx.Fields, mode string, labelValues []string, n int) {
+	seconds, ok := upstreamTimeFromField(fields, u.field, mode)
+	if !ok {
+		return
+	}
+
+	observeWeighted(u.seconds.WithLabelValues(labelValues...), seconds, n)
+	observeWeighted(u.hist.WithLabelValues(labelValues...), seconds, n)
+}
@@ -0,0 +1,84 @@
+/*
+ * Copyright 2019 Martin Helmich <martin@helmich.me>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import "sync"
+
+// lineJob is a single log line, tagged with the processor of the namespace
+// that it belongs to
+type lineJob struct {
+	processor *lineProcessor
+	line      string
+}
+
+// workerPool is a fixed set of goroutines that process lines from all
+// sources of all namespaces (or of a single namespace). This bounds the
+// number of goroutines that parse log lines, regardless of how many files
+// are being tailed.
+type workerPool struct {
+	jobs         chan lineJob
+	dropWhenFull bool
+	workers      sync.WaitGroup
+}
+
+func newWorkerPool(size int, queueSize int) *workerPool {
+	w := &workerPool{
+		jobs: make(chan lineJob, queueSize),
+	}
+
+	w.workers.Add(size)
+	for i := 0; i < size; i++ {
+		go w.work()
+	}
+
+	return w
+}
+
+// submit queues a line for processing. If the queue is full, it blocks
+// until a worker becomes available, or drops the line if the pool was
+// configured to do so.
+func (w *workerPool) submit(p *lineProcessor, line string) {
+	job := lineJob{processor: p, line: line}
+
+	if !w.dropWhenFull {
+		w.jobs <- job
+		return
+	}
+
+	select {
+	case w.jobs <- job:
+	default:
+		if p.metrics.linesDroppedTotal != nil {
+			p.metrics.linesDroppedTotal.Inc()
+		}
+	}
+}
+
+// stop stops all workers once they processed all queued lines; no lines may
+// be submitted afterwards
+func (w *workerPool) stop() {
+	close(w.jobs)
+	w.workers.Wait()
+}
+
+func (w *workerPool) work() {
+	defer w.workers.Done()
+
+	for job := range w.jobs {
+		job.processor.processLine(job.line)
+	}
+}
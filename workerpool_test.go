@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/config"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorkerPoolDropsLinesWhenFull(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.NamespaceConfig{
+		Name:       "test",
+		Format:     "$request $status",
+		WorkerPool: &config.WorkerPoolConfig{Size: 1, QueueSize: 1, DropWhenFull: true},
+	}
+	require.Nil(t, cfg.Compile())
+
+	m, err := NewNSMetrics(&cfg)
+	require.Nil(t, err)
+
+	p := newLineProcessor(&cfg, &m.Metrics)
+
+	// without workers, only as many lines fit as can be queued
+	pool := newWorkerPool(0, 1)
+	pool.dropWhenFull = true
+	pool.submit(p, "GET 200")
+	pool.submit(p, "GET 200")
+	pool.submit(p, "GET 200")
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.linesDroppedTotal))
+}
+
+func TestWorkerPoolProcessesQueuedLinesWhenStopped(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.NamespaceConfig{Name: "test", Format: "$request $status"}
+	require.Nil(t, cfg.Compile())
+
+	m, err := NewNSMetrics(&cfg)
+	require.Nil(t, err)
+
+	p := newLineProcessor(&cfg, &m.Metrics)
+
+	pool := newWorkerPool(2, 10)
+	for i := 0; i < 10; i++ {
+		pool.submit(p, "GET 200")
+	}
+	pool.stop()
+
+	assert.Equal(t, 10.0, testutil.ToFloat64(m.countTotal))
+}
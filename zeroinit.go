@@ -0,0 +1,114 @@
+/*
+ * Copyright 2019 Martin Helmich <martin@helmich.me>
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"strings"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/config"
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/relabeling"
+)
+
+// zeroInitMethods are the request methods that counters are initialized for
+// (unless the values of the "method" label are restricted by a whitelist)
+var zeroInitMethods = []string{"GET", "HEAD", "POST", "PUT", "DELETE", "PATCH", "OPTIONS"}
+
+// zeroInitLimit is the maximum number of label combinations that the counters
+// of a namespace are initialized for
+const zeroInitLimit = 10000
+
+// knownValues returns all values that a relabeling is known to map log values
+// to, or false if they cannot be known in advance
+func knownValues(r *relabeling.Relabeling, zeroInit *config.ZeroInitConfig) ([]string, bool) {
+	var values []string
+
+	switch {
+	case len(r.Whitelist) > 0:
+		values = append(append(values, r.Whitelist...), r.OtherValueOrDefault())
+	case len(r.Matches) > 0:
+		seen := make(map[string]bool)
+		for _, m := range r.Matches {
+			// replacements referring to groups of the regexp yield different
+			// values for each request
+			if strings.Contains(m.Replacement, "$") || seen[m.Replacement] {
+				continue
+			}
+
+			seen[m.Replacement] = true
+			values = append(values, m.Replacement)
+		}
+	case r.TargetLabel == "method":
+		values = zeroInitMethods
+	case r.TargetLabel == "status":
+		values = zeroInit.StatusOrDefault()
+	default:
+		return nil, false
+	}
+
+	if r.EmptyValue != "" {
+		values = append(values, r.EmptyValue)
+	}
+
+	return values, len(values) > 0
+}
+
+// zeroInitLabelValues returns the label values of all label combinations that
+// are known in advance, or false if the values of a label cannot be known (or
+// there are too many combinations)
+func (l *labelLayout) zeroInitLabelValues(zeroInit *config.ZeroInitConfig) ([][]string, bool) {
+	candidates := make([][]string, len(l.relabelings))
+	combinations := 1
+
+	for i, r := range l.relabelings {
+		if l.exportIndex[i] < 0 && i != l.endpointMethod {
+			// the value is not exported, so any value will do
+			candidates[i] = []string{""}
+			continue
+		}
+
+		values, ok := knownValues(r, zeroInit)
+		if !ok {
+			return nil, false
+		}
+
+		candidates[i] = values
+		combinations *= len(values)
+
+		if combinations > zeroInitLimit {
+			return nil, false
+		}
+	}
+
+	result := make([][]string, 0, combinations)
+	relabelValues := make([]string, len(l.relabelings))
+
+	var build func(i int)
+	build = func(i int) {
+		if i == len(candidates) {
+			result = append(result, l.labelValues(relabelValues))
+			return
+		}
+
+		for _, v := range candidates[i] {
+			relabelValues[i] = v
+			build(i + 1)
+		}
+	}
+
+	build(0)
+	return result, true
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/martin-helmich/prometheus-nginxlog-exporter/config"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestZeroInitCreatesAllKnownCombinations(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.NamespaceConfig{
+		Name:     "test",
+		Format:   "$request $status",
+		ZeroInit: &config.ZeroInitConfig{Status: []string{"200", "500"}},
+	}
+	require.Nil(t, cfg.Compile())
+
+	m, err := NewNSMetrics(&cfg)
+	require.Nil(t, err)
+
+	assert.Equal(t, len(zeroInitMethods)*2, testutil.CollectAndCount(m.countTotal))
+	assert.Equal(t, 0.0, testutil.ToFloat64(m.countTotal.WithLabelValues("GET", "500")))
+	assert.Equal(t, 0.0, testutil.ToFloat64(m.bytesTotal.WithLabelValues("POST", "200")))
+}
+
+func TestZeroInitUsesWhitelist(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.NamespaceConfig{
+		Name:   "test",
+		Format: "$request $status",
+		RelabelConfigs: []config.RelabelConfig{
+			{TargetLabel: "method", SourceValue: "request_method", Whitelist: []string{"GET"}},
+		},
+		ZeroInit: &config.ZeroInitConfig{},
+	}
+	require.Nil(t, cfg.Compile())
+
+	m, err := NewNSMetrics(&cfg)
+	require.Nil(t, err)
+
+	// "GET" and "other" for each of the default status codes
+	assert.Equal(t, 6, testutil.CollectAndCount(m.countTotal))
+}
+
+func TestZeroInitSkipsUnknownLabelValues(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.NamespaceConfig{
+		Name:           "test",
+		Format:         "$remote_user $request $status",
+		RelabelConfigs: []config.RelabelConfig{{TargetLabel: "user", SourceValue: "remote_user"}},
+		ZeroInit:       &config.ZeroInitConfig{},
+	}
+	require.Nil(t, cfg.Compile())
+
+	m, err := NewNSMetrics(&cfg)
+	require.Nil(t, err)
+
+	assert.Equal(t, 0, testutil.CollectAndCount(m.countTotal))
+}